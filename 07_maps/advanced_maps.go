@@ -2,6 +2,8 @@ package main
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sort"
 	"sync"
@@ -95,19 +97,35 @@ func main() {
 
 	// Example 4: Concurrent-safe map
 	safeMap := NewSafeMap()
-	var wg sync.WaitGroup
 
-	// Concurrent writes
-	for i := 0; i < 10; i++ {
-		wg.Add(1)
-		go func(n int) {
-			defer wg.Done()
-			safeMap.Set(fmt.Sprintf("key%d", n), n)
-		}(i)
+	// Concurrent writes through a bounded worker pool (see worker_pool.go)
+	// instead of one goroutine per item
+	ctx := context.Background()
+	pool := NewWorkerPool[int](ctx, 3, 4)
+	go func() {
+		defer pool.Close()
+		for i := 0; i < 10; i++ {
+			n := i
+			pool.Submit(ctx, func(ctx context.Context) (int, error) {
+				if n == 7 {
+					panic("unlucky number")
+				}
+				safeMap.Set(fmt.Sprintf("key%d", n), n)
+				return n * n, nil
+			})
+		}
+	}()
+
+	fmt.Println("\nWorker pool results in submission order:")
+	for r := range pool.OrderedResults() {
+		var panicErr *PanicError
+		if errors.As(r.Err, &panicErr) {
+			fmt.Printf("task %d: %v\n", r.Index, panicErr)
+			continue
+		}
+		fmt.Printf("task %d: %d\n", r.Index, r.Value)
 	}
 
-	wg.Wait()
-
 	// Print safe map contents
 	fmt.Println("\nSafe map contents:")
 	for i := 0; i < 10; i++ {
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+var ErrPoolClosed = errors.New("worker pool is closed")
+
+// Task is a unit of work; it should stop early when ctx is cancelled
+type Task[T any] func(ctx context.Context) (T, error)
+
+// TaskResult carries a task's output and its submission index
+type TaskResult[T any] struct {
+	Index int
+	Value T
+	Err   error
+}
+
+// PanicError reports a task that panicked instead of returning
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panicked: %v", e.Value)
+}
+
+type job[T any] struct {
+	index int
+	ctx   context.Context
+	task  Task[T]
+}
+
+// WorkerPool runs tasks on a fixed number of goroutines.
+// Submit blocks while the queue is full, which gives producers backpressure.
+// Results must be consumed, otherwise workers stop once it fills up.
+type WorkerPool[T any] struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	jobs    chan job[T]
+	results chan TaskResult[T]
+	wg      sync.WaitGroup
+
+	// closing is closed first so producers blocked in Submit let go of mu
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	mu     sync.Mutex
+	closed bool
+	next   int
+}
+
+func NewWorkerPool[T any](ctx context.Context, workers, queueSize int) *WorkerPool[T] {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	p := &WorkerPool[T]{
+		ctx:     ctx,
+		cancel:  cancel,
+		jobs:    make(chan job[T], queueSize),
+		results: make(chan TaskResult[T], workers),
+		closing: make(chan struct{}),
+	}
+
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+	go func() {
+		p.wg.Wait()
+		close(p.results)
+	}()
+	return p
+}
+
+// Submit queues task. ctx cancels this task only; cancelling the pool's
+// context cancels every task.
+func (p *WorkerPool[T]) Submit(ctx context.Context, task Task[T]) error {
+	// Submissions are serialized so indexes have no gaps
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+
+	select {
+	case p.jobs <- job[T]{index: p.next, ctx: ctx, task: task}:
+		p.next++
+		return nil
+	case <-p.closing:
+		return ErrPoolClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+}
+
+// Close stops accepting tasks; Results is closed once queued tasks finish.
+// A Submit blocked on a full queue returns ErrPoolClosed.
+func (p *WorkerPool[T]) Close() {
+	p.closeOnce.Do(func() { close(p.closing) })
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+}
+
+// Cancel cancels the pool's context, so running and queued tasks see ctx.Done
+func (p *WorkerPool[T]) Cancel() {
+	p.cancel()
+	p.Close()
+}
+
+// Results yields results as tasks complete
+func (p *WorkerPool[T]) Results() <-chan TaskResult[T] {
+	return p.results
+}
+
+// OrderedResults yields results in submission order, buffering
+// results that complete early
+func (p *WorkerPool[T]) OrderedResults() <-chan TaskResult[T] {
+	out := make(chan TaskResult[T])
+	go func() {
+		defer close(out)
+		pending := make(map[int]TaskResult[T])
+		next := 0
+		for r := range p.results {
+			pending[r.Index] = r
+			for {
+				ready, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				out <- ready
+				next++
+			}
+		}
+	}()
+	return out
+}
+
+func (p *WorkerPool[T]) worker() {
+	defer p.wg.Done()
+	for j := range p.jobs {
+		p.results <- p.run(j)
+	}
+}
+
+func (p *WorkerPool[T]) run(j job[T]) (result TaskResult[T]) {
+	result.Index = j.index
+
+	// The task sees both its own and the pool's cancellation
+	ctx, cancel := context.WithCancel(j.ctx)
+	defer cancel()
+	stop := context.AfterFunc(p.ctx, cancel)
+	defer stop()
+
+	if err := ctx.Err(); err != nil {
+		result.Err = err
+		return result
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			result.Err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	result.Value, result.Err = j.task(ctx)
+	return result
+}
@@ -1,48 +1,54 @@
 package main
-package main
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
 	"time"
 )
 
 // Custom error type
 type ValidationError struct {
-	Field string
-	Error string
+	Field   string
+	Message string
 }
 
 func (e *ValidationError) Error() string {
-	return fmt.Sprintf("validation failed for %s: %s", e.Field, e.Error)
+	return fmt.Sprintf("validation failed for %s: %s", e.Field, e.Message)
 }
 
 // Function decorator (middleware) example
 type HttpHandler func(string) (string, error)
 
-func withLogging(handler HttpHandler) HttpHandler {
+func withLogging(logger *slog.Logger, handler HttpHandler) HttpHandler {
 	return func(req string) (string, error) {
 		start := time.Now()
 		result, err := handler(req)
 		duration := time.Since(start)
-		log.Printf("Request: %s, Duration: %v, Error: %v\n", req, duration, err)
+		if err != nil {
+			logger.Error("request failed", "request", req, "duration", duration, "error", err)
+		} else {
+			logger.Info("request handled", "request", req, "duration", duration)
+		}
 		return result, err
 	}
 }
 
-func withRetry(attempts int, handler HttpHandler) HttpHandler {
+func withRetry(logger *slog.Logger, attempts int, handler HttpHandler) HttpHandler {
 	return func(req string) (string, error) {
-		var lastErr error
+		// Keep every attempt's error so callers can inspect the causes
+		errs := &MultiError{Message: fmt.Sprintf("all %d attempts failed", attempts)}
 		for i := 0; i < attempts; i++ {
 			result, err := handler(req)
 			if err == nil {
 				return result, nil
 			}
-			lastErr = err
-			log.Printf("Attempt %d failed: %v\n", i+1, err)
+			errs.Append(Wrap(err, "attempt failed", "attempt", i+1, "request", req))
+			logger.Warn("attempt failed", "request", req, "attempt", i+1, "max_attempts", attempts, "error", err)
 			time.Sleep(time.Millisecond * 100) // Simple backoff
 		}
-		return "", fmt.Errorf("all %d attempts failed. Last error: %v", attempts, lastErr)
+		return "", errs.ErrorOrNil()
 	}
 }
 
@@ -85,57 +91,37 @@ func sum[T Number](numbers ...T) T {
 }
 
 // Builder pattern with functional options
+// ServerOption, the WithX functions and newServer are generated from the
+// tags below into server_options_gen.go
+//
+//go:generate go run ../tools/genbuilder/genbuilder.go -type Server -mode options -output server_options_gen.go advanced_functions.go
 type Server struct {
-	host    string
-	port    int
-	timeout time.Duration
-	maxConn int
-}
-
-type ServerOption func(*Server)
-
-func WithPort(port int) ServerOption {
-	return func(s *Server) {
-		s.port = port
-	}
-}
-
-func WithTimeout(timeout time.Duration) ServerOption {
-	return func(s *Server) {
-		s.timeout = timeout
-	}
-}
-
-func WithMaxConn(maxConn int) ServerOption {
-	return func(s *Server) {
-		s.maxConn = maxConn
-	}
+	host    string        `validate:"required"`
+	port    int           `default:"8080" validate:"min=1,max=65535"`
+	timeout time.Duration `default:"30s" validate:"min=1ms"`
+	maxConn int           `default:"100" validate:"min=1"`
 }
 
-func NewServer(host string, options ...ServerOption) *Server {
-	server := &Server{
-		host:    host,
-		port:    8080,    // default
-		timeout: 30 * time.Second, // default
-		maxConn: 100,     // default
-	}
-	
-	for _, option := range options {
-		option(server)
-	}
-	
-	return server
+func NewServer(host string, options ...ServerOption) (*Server, error) {
+	return newServer(append([]ServerOption{WithHost(host)}, options...)...)
 }
 
 func main() {
-	// Example 1: Function decorators
+	// Example 1: Function decorators with structured logging
+	logs := NewLogRegistry(os.Stderr, LogFormatText, slog.LevelInfo).
+		WithSampling(SamplingConfig{First: 10, Thereafter: 100, Tick: time.Second})
+	logs.SetLevel("retry", slog.LevelWarn) // Levels can be changed at runtime
+
 	handler := handleRequest
-	loggedHandler := withLogging(handler)
-	retryingLoggedHandler := withRetry(3, loggedHandler)
+	loggedHandler := withLogging(logs.Logger("http"), handler)
+	retryingLoggedHandler := withRetry(logs.Logger("retry"), 3, loggedHandler)
 
 	fmt.Println("Testing decorated handler:")
 	result, err := retryingLoggedHandler("test-request")
 	fmt.Printf("Final result: %v, err: %v\n", result, err)
+	if err != nil {
+		fmt.Print(FormatErrorTree(err))
+	}
 
 	// Example 2: Multiple function returns and closures
 	square, addBase := mathOperations()
@@ -147,34 +133,48 @@ func main() {
 	fmt.Printf("Sum of floats: %.2f\n", sum(1.1, 2.2, 3.3))
 
 	// Example 4: Builder pattern with functional options
-	server := NewServer(
+	server, err := NewServer(
 		"localhost",
 		WithPort(9000),
 		WithTimeout(1*time.Minute),
 		WithMaxConn(1000),
 	)
-	
-	fmt.Printf("\nServer configuration:\nHost: %s\nPort: %d\nTimeout: %v\nMax Connections: %d\n",
-		server.host, server.port, server.timeout, server.maxConn)
+	if err != nil {
+		fmt.Printf("\nServer configuration: %v\n", err)
+	} else {
+		fmt.Printf("\nServer configuration:\nHost: %s\nPort: %d\nTimeout: %v\nMax Connections: %d\n",
+			server.host, server.port, server.timeout, server.maxConn)
+	}
+	_, err = NewServer("", WithPort(70000))
+	fmt.Printf("Invalid server:\n%v\n", err)
 
 	// Example 5: Error handling
 	if err := validateUser("", 15); err != nil {
 		fmt.Printf("\nValidation error: %v\n", err)
+		fmt.Print(FormatErrorTree(err))
+
+		// Every aggregated error is still reachable with errors.As
+		var vErr *ValidationError
+		if errors.As(err, &vErr) {
+			fmt.Printf("First invalid field: %s\n", vErr.Field)
+		}
 	}
 }
 
+// validateUser reports every invalid field, not just the first one
 func validateUser(name string, age int) error {
+	errs := &MultiError{Message: "invalid user"}
 	if name == "" {
-		return &ValidationError{
-			Field: "name",
-			Error: "cannot be empty",
-		}
+		errs.Append(&ValidationError{
+			Field:   "name",
+			Message: "cannot be empty",
+		})
 	}
 	if age < 18 {
-		return &ValidationError{
-			Field: "age",
-			Error: "must be 18 or older",
-		}
+		errs.Append(&ValidationError{
+			Field:   "age",
+			Message: "must be 18 or older",
+		})
 	}
-	return nil
+	return errs.ErrorOrNil()
 }
\ No newline at end of file
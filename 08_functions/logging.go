@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// LogFormat selects the slog handler used for output
+type LogFormat int
+
+const (
+	LogFormatText LogFormat = iota
+	LogFormatJSON
+)
+
+// SamplingConfig keeps the first N records per message in each tick,
+// then only every Thereafter-th one. Warnings and errors are never sampled.
+type SamplingConfig struct {
+	First      int
+	Thereafter int
+	Tick       time.Duration
+}
+
+// LogRegistry hands out per-package loggers whose levels can be changed at runtime
+type LogRegistry struct {
+	mu       sync.Mutex
+	base     slog.Handler
+	levels   map[string]*slog.LevelVar
+	defLevel slog.Level
+	sampler  *sampler
+}
+
+func NewLogRegistry(w io.Writer, format LogFormat, level slog.Level) *LogRegistry {
+	// The base handler lets everything through; filtering happens per package
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug - 4}
+
+	var base slog.Handler
+	switch format {
+	case LogFormatJSON:
+		base = slog.NewJSONHandler(w, opts)
+	default:
+		base = slog.NewTextHandler(w, opts)
+	}
+
+	return &LogRegistry{
+		base:     base,
+		levels:   make(map[string]*slog.LevelVar),
+		defLevel: level,
+	}
+}
+
+// WithSampling enables sampling of success (below Warn) records for all loggers
+func (r *LogRegistry) WithSampling(cfg SamplingConfig) *LogRegistry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sampler = newSampler(cfg)
+	return r
+}
+
+// Logger returns a logger for pkg, tagged with a "package" attribute
+func (r *LogRegistry) Logger(pkg string) *slog.Logger {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slog.New(&packageHandler{
+		next:    r.base.WithAttrs([]slog.Attr{slog.String("package", pkg)}),
+		level:   r.levelVar(pkg),
+		sampler: r.sampler,
+	})
+}
+
+// SetLevel changes the level of pkg, including loggers already handed out
+func (r *LogRegistry) SetLevel(pkg string, level slog.Level) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.levelVar(pkg).Set(level)
+}
+
+// Level reports the current level of pkg
+func (r *LogRegistry) Level(pkg string) slog.Level {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.levelVar(pkg).Level()
+}
+
+// levelVar must be called with r.mu held
+func (r *LogRegistry) levelVar(pkg string) *slog.LevelVar {
+	lv, ok := r.levels[pkg]
+	if !ok {
+		lv = new(slog.LevelVar)
+		lv.Set(r.defLevel)
+		r.levels[pkg] = lv
+	}
+	return lv
+}
+
+// packageHandler filters by a package level and applies sampling before
+// passing records on to the shared base handler
+type packageHandler struct {
+	next    slog.Handler
+	level   *slog.LevelVar
+	sampler *sampler
+}
+
+func (h *packageHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level() && h.next.Enabled(ctx, level)
+}
+
+func (h *packageHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if h.sampler != nil && rec.Level < slog.LevelWarn && !h.sampler.allow(rec.Message, rec.Time) {
+		return nil
+	}
+	return h.next.Handle(ctx, rec)
+}
+
+func (h *packageHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &packageHandler{next: h.next.WithAttrs(attrs), level: h.level, sampler: h.sampler}
+}
+
+func (h *packageHandler) WithGroup(name string) slog.Handler {
+	return &packageHandler{next: h.next.WithGroup(name), level: h.level, sampler: h.sampler}
+}
+
+// sampler counts records per message within the current tick
+type sampler struct {
+	mu     sync.Mutex
+	cfg    SamplingConfig
+	start  time.Time
+	counts map[string]int
+}
+
+func newSampler(cfg SamplingConfig) *sampler {
+	if cfg.Tick <= 0 {
+		cfg.Tick = time.Second
+	}
+	return &sampler{cfg: cfg, counts: make(map[string]int)}
+}
+
+func (s *sampler) allow(msg string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.start) >= s.cfg.Tick {
+		s.start = now
+		clear(s.counts)
+	}
+
+	s.counts[msg]++
+	n := s.counts[msg]
+	if n <= s.cfg.First {
+		return true
+	}
+	return s.cfg.Thereafter > 0 && (n-s.cfg.First)%s.cfg.Thereafter == 0
+}
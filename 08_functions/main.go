@@ -3,6 +3,9 @@ package main
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 )
 
 // Basic function
@@ -88,4 +91,37 @@ func main() {
 	fmt.Printf("Counter: %d\n", incrementCounter())
 	fmt.Printf("Counter: %d\n", incrementCounter())
 	fmt.Printf("Counter: %d\n", incrementCounter())
+
+	// Generic higher-order functions (see functional.go)
+	doubled := Map(numbers, func(n int) int { return n * 2 })
+	evens := Filter(numbers, func(n int) bool { return n%2 == 0 })
+	total := Reduce(numbers, 0, add)
+	fmt.Printf("\nMap: %v, Filter: %v, Reduce: %d\n", doubled, evens, total)
+
+	small, large := Partition(numbers, func(n int) bool { return n <= 2 })
+	fmt.Printf("Partition: %v %v\n", small, large)
+	fmt.Printf("GroupBy parity: %v\n", GroupBy(numbers, func(n int) string {
+		if n%2 == 0 {
+			return "even"
+		}
+		return "odd"
+	}))
+	fmt.Printf("FlatMap: %v\n", FlatMap([]string{"a b", "c"}, strings.Fields))
+
+	// The same helpers work lazily over iter.Seq
+	squares := MapSeq(slices.Values(numbers), func(n int) int { return n * n })
+	fmt.Printf("Squares over 5: %v\n", slices.Collect(FilterSeq(squares, func(n int) bool { return n > 5 })))
+
+	// Currying, partial application and composition
+	addFive := Curry(add)(5)
+	triple := Partial(multiply, 3)
+	fmt.Printf("Pipe(addFive, triple)(1): %d\n", Pipe(addFive, triple)(1))
+	describe := Compose(triple, strconv.Itoa)
+	fmt.Printf("Compose(triple, Itoa)(7): %q\n", describe(7))
+
+	// Option and Result
+	fmt.Printf("Find > 3: %v\n", Find(slices.Values(numbers), func(n int) bool { return n > 3 }))
+	fmt.Printf("Find > 9: %v\n", Find(slices.Values(numbers), func(n int) bool { return n > 9 }))
+	fmt.Printf("Parse \"42\": %v\n", MapResult(Try(strconv.Atoi("42")), triple))
+	fmt.Printf("Parse \"x\": %v\n", MapResult(Try(strconv.Atoi("x")), triple))
 }
\ No newline at end of file
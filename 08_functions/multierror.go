@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// MultiError collects several errors under one message.
+// errors.Is and errors.As see every collected error through Unwrap.
+type MultiError struct {
+	Message string
+	Errors  []error
+}
+
+// Append adds the non-nil errors to m
+func (m *MultiError) Append(errs ...error) {
+	for _, err := range errs {
+		if err != nil {
+			m.Errors = append(m.Errors, err)
+		}
+	}
+}
+
+// ErrorOrNil returns nil when nothing was collected, so callers can
+// `return errs.ErrorOrNil()` without returning a typed nil
+func (m *MultiError) ErrorOrNil() error {
+	if m == nil || len(m.Errors) == 0 {
+		return nil
+	}
+	return m
+}
+
+func (m *MultiError) Error() string {
+	msgs := make([]string, len(m.Errors))
+	for i, err := range m.Errors {
+		msgs[i] = err.Error()
+	}
+	joined := strings.Join(msgs, "; ")
+	if m.Message == "" {
+		return joined
+	}
+	return fmt.Sprintf("%s: %s", m.Message, joined)
+}
+
+func (m *MultiError) Unwrap() []error {
+	return m.Errors
+}
+
+// ContextError wraps an error with a message, key/value context
+// and the stack trace of the place it was created
+type ContextError struct {
+	msg    string
+	cause  error
+	fields []any
+	stack  []uintptr
+}
+
+// Wrap annotates err; it returns nil when err is nil.
+// keyvals are alternating keys and values, like log/slog.
+func Wrap(err error, msg string, keyvals ...any) error {
+	if err == nil {
+		return nil
+	}
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	return &ContextError{msg: msg, cause: err, fields: keyvals, stack: pcs[:n]}
+}
+
+func (e *ContextError) Error() string {
+	if e.msg == "" {
+		return e.cause.Error()
+	}
+	return fmt.Sprintf("%s: %v", e.msg, e.cause)
+}
+
+func (e *ContextError) Unwrap() error {
+	return e.cause
+}
+
+// Fields returns the key/value context attached to e
+func (e *ContextError) Fields() map[string]any {
+	fields := make(map[string]any, len(e.fields)/2)
+	for i := 0; i < len(e.fields); i += 2 {
+		key := fmt.Sprint(e.fields[i])
+		if i+1 < len(e.fields) {
+			fields[key] = e.fields[i+1]
+		} else {
+			fields[key] = "(missing)"
+		}
+	}
+	return fields
+}
+
+// StackTrace returns the frames captured by Wrap
+func (e *ContextError) StackTrace() []runtime.Frame {
+	var result []runtime.Frame
+	frames := runtime.CallersFrames(e.stack)
+	for {
+		frame, more := frames.Next()
+		result = append(result, frame)
+		if !more {
+			break
+		}
+	}
+	return result
+}
+
+// Format prints the stack trace with %+v
+func (e *ContextError) Format(s fmt.State, verb rune) {
+	switch {
+	case verb == 'v' && s.Flag('+'):
+		io.WriteString(s, e.Error())
+		for _, frame := range e.StackTrace() {
+			fmt.Fprintf(s, "\n\t%s\n\t\t%s:%d", frame.Function, frame.File, frame.Line)
+		}
+	case verb == 'q':
+		fmt.Fprintf(s, "%q", e.Error())
+	default:
+		io.WriteString(s, e.Error())
+	}
+}
+
+// label is how e appears as a node in FormatErrorTree
+func (e *ContextError) label() string {
+	msg := e.msg
+	if msg == "" {
+		msg = "(wrapped)"
+	}
+	fields := e.Fields()
+	if len(fields) == 0 {
+		return msg
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%v", k, fields[k])
+	}
+	return fmt.Sprintf("%s [%s]", msg, strings.Join(pairs, " "))
+}
+
+// FormatErrorTree renders err and everything it wraps as an indented tree
+func FormatErrorTree(err error) string {
+	var sb strings.Builder
+	writeErrorNode(&sb, err, "", "")
+	return sb.String()
+}
+
+func writeErrorNode(sb *strings.Builder, err error, prefix, childPrefix string) {
+	var label string
+	var children []error
+
+	switch e := err.(type) {
+	case *MultiError:
+		label = e.Message
+		if label == "" {
+			label = fmt.Sprintf("%d errors", len(e.Errors))
+		}
+		children = e.Errors
+	case *ContextError:
+		label = e.label()
+		children = []error{e.cause}
+	case interface{ Unwrap() []error }:
+		label = fmt.Sprintf("%T", err)
+		children = e.Unwrap()
+	default:
+		// Leaves (and %w chains) print their full message
+		label = err.Error()
+	}
+
+	sb.WriteString(prefix + label + "\n")
+	for i, child := range children {
+		if i == len(children)-1 {
+			writeErrorNode(sb, child, childPrefix+"└── ", childPrefix+"    ")
+		} else {
+			writeErrorNode(sb, child, childPrefix+"├── ", childPrefix+"│   ")
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Code generated by genbuilder -type Server -mode options; DO NOT EDIT.
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// defaultServer returns a Server with the defaults from its struct tags
+func defaultServer() Server {
+	return Server{port: 8080, timeout: 30 * time.Second, maxConn: 100}
+}
+
+// ServerOption configures a Server built by newServer
+type ServerOption func(*Server)
+
+func WithHost(host string) ServerOption {
+	return func(s *Server) {
+		s.host = host
+	}
+}
+
+func WithPort(port int) ServerOption {
+	return func(s *Server) {
+		s.port = port
+	}
+}
+
+func WithTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.timeout = timeout
+	}
+}
+
+func WithMaxConn(maxConn int) ServerOption {
+	return func(s *Server) {
+		s.maxConn = maxConn
+	}
+}
+
+// newServer applies the defaults, then options, then the validate tags
+func newServer(options ...ServerOption) (*Server, error) {
+	s := defaultServer()
+	for _, option := range options {
+		option(&s)
+	}
+	var errs []error
+	validateServer(&s, func(field, message string) {
+		errs = append(errs, errors.New(field+" "+message))
+	})
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return &s, nil
+}
+
+// validateServer reports every field that breaks its validate tag
+func validateServer(v *Server, report func(field, message string)) {
+	if v.host == "" {
+		report("host", "is required")
+	}
+	if v.port < 1 {
+		report("port", "must be at least 1")
+	}
+	if v.port > 65535 {
+		report("port", "must be at most 65535")
+	}
+	if v.timeout < 1*time.Millisecond {
+		report("timeout", "must be at least 1ms")
+	}
+	if v.maxConn < 1 {
+		report("maxConn", "must be at least 1")
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	ErrUnknownCountry    = errors.New("unknown country")
+	ErrInvalidPostalCode = errors.New("invalid postal code")
+	ErrMissingField      = errors.New("required")
+)
+
+// address_countries.json is compiled into the binary, so normalization
+// never needs the network or files at run time
+//
+//go:embed address_countries.json
+var countriesJSON []byte
+
+// Country holds the conventions of one ISO 3166-1 country
+type Country struct {
+	Code    string   `json:"code"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+
+	// Postal codes are compacted, split by PostalSep at PostalSplit
+	// (negative counts from the end) and then matched against Postal
+	Postal         string `json:"postal"`
+	PostalSplit    int    `json:"postal_split"`
+	PostalSep      string `json:"postal_sep"`
+	PostalOptional bool   `json:"postal_optional"`
+
+	// Format lines use {street}, {city}, {region}, {postal} and {country};
+	// an upper-case placeholder such as {CITY} upper-cases the value
+	Format         []string `json:"format"`
+	StreetSuffixes bool     `json:"street_suffixes"` // Abbreviate "Street" to "St" and so on
+
+	postal *regexp.Regexp
+}
+
+var countries, countryByName = loadCountries(countriesJSON)
+
+func loadCountries(data []byte) (map[string]*Country, map[string]*Country) {
+	var list []*Country
+	if err := json.Unmarshal(data, &list); err != nil {
+		panic("address_countries.json: " + err.Error())
+	}
+	byCode := make(map[string]*Country, len(list))
+	byName := make(map[string]*Country)
+	for _, c := range list {
+		if c.Postal != "" {
+			c.postal = regexp.MustCompile(c.Postal)
+		}
+		byCode[c.Code] = c
+		for _, name := range append([]string{c.Code, c.Name}, c.Aliases...) {
+			byName[countryKey(name)] = c
+		}
+	}
+	return byCode, byName
+}
+
+// countryKey folds case, dots and spacing so "u.s.a." finds "USA"
+func countryKey(s string) string {
+	return strings.Join(strings.Fields(strings.ToUpper(strings.ReplaceAll(s, ".", ""))), " ")
+}
+
+// LookupCountry finds a country by ISO code, English name or common alias
+func LookupCountry(name string) (*Country, bool) {
+	c, ok := countryByName[countryKey(name)]
+	return c, ok
+}
+
+// NormalizePostalCode puts code into the country's canonical form
+func (c *Country) NormalizePostalCode(code string) (string, error) {
+	compact := strings.ToUpper(strings.Join(strings.Fields(code), ""))
+	if c.PostalSep != "" {
+		compact = strings.ReplaceAll(compact, c.PostalSep, "")
+	}
+	if compact == "" {
+		if c.postal != nil && !c.PostalOptional {
+			return "", fmt.Errorf("postal code: %w", ErrMissingField)
+		}
+		return "", nil
+	}
+	if c.postal == nil {
+		return "", fmt.Errorf("%w %q: %s does not use postal codes", ErrInvalidPostalCode, code, c.Name)
+	}
+
+	split := c.PostalSplit
+	if split < 0 {
+		split += len(compact)
+	}
+	if split > 0 && split < len(compact) {
+		sep := c.PostalSep
+		if sep == "" {
+			sep = " "
+		}
+		compact = compact[:split] + sep + compact[split:]
+	}
+	if !c.postal.MatchString(compact) {
+		return "", fmt.Errorf("%w %q for %s", ErrInvalidPostalCode, code, c.Name)
+	}
+	return compact, nil
+}
+
+// streetSuffixes are the USPS-style abbreviations; only the last
+// suffix in a street is abbreviated, so "1 Court Street" keeps "Court"
+var streetSuffixes = map[string]string{
+	"street": "St", "st": "St",
+	"avenue": "Ave", "ave": "Ave", "av": "Ave",
+	"boulevard": "Blvd", "blvd": "Blvd",
+	"road": "Rd", "rd": "Rd",
+	"drive": "Dr", "dr": "Dr",
+	"lane": "Ln", "ln": "Ln",
+	"court": "Ct", "ct": "Ct",
+	"place": "Pl", "pl": "Pl",
+	"terrace": "Ter", "ter": "Ter",
+	"parkway": "Pkwy", "pkwy": "Pkwy",
+	"highway": "Hwy", "hwy": "Hwy",
+	"square": "Sq", "sq": "Sq",
+	"circle": "Cir", "cir": "Cir",
+}
+
+var unitDesignators = map[string]string{
+	"apartment": "Apt", "apt": "Apt",
+	"suite": "Ste", "ste": "Ste",
+	"floor": "Fl", "fl": "Fl",
+	"unit": "Unit",
+}
+
+// NormalizeAddress cleans up whitespace and casing, maps the country to
+// its ISO code and canonicalizes the postal code. The result is as
+// normalized as possible even when an error reports what is invalid.
+func NormalizeAddress(a Address) (Address, error) {
+	out := Address{
+		Street:     normalizeCase(a.Street),
+		City:       normalizeCase(a.City),
+		Region:     normalizeRegion(a.Region),
+		PostalCode: strings.Join(strings.Fields(a.PostalCode), " "),
+		Country:    strings.TrimSpace(a.Country),
+	}
+
+	var errs []error
+	c, ok := LookupCountry(a.Country)
+	if !ok {
+		if out.Country == "" {
+			errs = append(errs, fmt.Errorf("country: %w", ErrMissingField))
+		} else {
+			errs = append(errs, fmt.Errorf("%w %q", ErrUnknownCountry, out.Country))
+		}
+	} else {
+		out.Country = c.Code
+		if c.StreetSuffixes {
+			out.Street = abbreviateStreet(out.Street)
+		}
+		if postal, err := c.NormalizePostalCode(a.PostalCode); err != nil {
+			errs = append(errs, err)
+		} else {
+			out.PostalCode = postal
+		}
+	}
+
+	if out.Street == "" {
+		errs = append(errs, fmt.Errorf("street: %w", ErrMissingField))
+	}
+	if out.City == "" && (c == nil || c.uses("city")) {
+		errs = append(errs, fmt.Errorf("city: %w", ErrMissingField))
+	}
+	return out, errors.Join(errs...)
+}
+
+// uses reports whether the country's address format has the field
+func (c *Country) uses(field string) bool {
+	return strings.Contains(strings.ToLower(strings.Join(c.Format, "\n")), "{"+field+"}")
+}
+
+// normalizeCase collapses whitespace and title-cases text typed in all
+// upper or all lower case. In mixed-case text only shouted words longer
+// than three letters are fixed, so "NW" and "den" are kept as typed.
+func normalizeCase(s string) string {
+	words := strings.Fields(s)
+	joined := strings.Join(words, "")
+	allSame := joined == strings.ToUpper(joined) || joined == strings.ToLower(joined)
+	for i, w := range words {
+		shouted := w == strings.ToUpper(w) && w != strings.ToLower(w) && utf8.RuneCountInString(w) > 3
+		if allSame || shouted {
+			words[i] = titleWord(strings.ToLower(w))
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// titleWord capitalizes w and the letter after a hyphen or an O'-style
+// prefix; words starting with a digit ("5th", "12b") stay lower case
+func titleWord(w string) string {
+	r := []rune(w)
+	if len(r) == 0 || unicode.IsDigit(r[0]) {
+		return w
+	}
+	for i := range r {
+		switch {
+		case i == 0:
+			r[i] = unicode.ToUpper(r[i])
+		case r[i-1] == '-':
+			r[i] = unicode.ToUpper(r[i])
+		case r[i-1] == '\'' && i == 2:
+			r[i] = unicode.ToUpper(r[i])
+		}
+	}
+	return string(r)
+}
+
+// normalizeRegion upper-cases state and province codes such as "ny"
+func normalizeRegion(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if n := utf8.RuneCountInString(s); n > 0 && n <= 3 && !strings.Contains(s, " ") {
+		return strings.ToUpper(s)
+	}
+	return normalizeCase(s)
+}
+
+func abbreviateStreet(street string) string {
+	words := strings.Fields(street)
+	suffixDone := false
+	for i := len(words) - 1; i >= 0; i-- {
+		key := strings.ToLower(strings.TrimSuffix(words[i], "."))
+		if abbr, ok := unitDesignators[key]; ok {
+			words[i] = abbr
+			continue
+		}
+		if abbr, ok := streetSuffixes[key]; ok && !suffixDone && i > 0 {
+			words[i] = abbr
+			suffixDone = true
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// Format normalizes a and lays it out the way the destination country
+// expects. The country line is left out when mailing within from.
+func (a Address) Format(from string) (string, error) {
+	n, err := NormalizeAddress(a)
+	if err != nil {
+		return "", err
+	}
+	c := countries[n.Country]
+	fields := map[string]string{
+		"street":  n.Street,
+		"city":    n.City,
+		"region":  n.Region,
+		"postal":  n.PostalCode,
+		"country": strings.ToUpper(c.Name),
+	}
+	if home, ok := LookupCountry(from); ok && home == c {
+		fields["country"] = ""
+	}
+
+	var lines []string
+	for _, tmpl := range c.Format {
+		line := placeholder.ReplaceAllStringFunc(tmpl, func(p string) string {
+			name := p[1 : len(p)-1]
+			value := fields[strings.ToLower(name)]
+			if name == strings.ToUpper(name) {
+				value = strings.ToUpper(value)
+			}
+			return value
+		})
+		// Drop separators left dangling by empty fields
+		line = strings.Join(strings.Fields(line), " ")
+		line = strings.Trim(strings.ReplaceAll(line, " ,", ","), " ,-")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+var placeholder = regexp.MustCompile(`\{[A-Za-z]+\}`)
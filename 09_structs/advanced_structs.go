@@ -2,28 +2,39 @@ package main
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
 // Example 1: Struct with tags
 type User struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email,omitempty"`
-	CreatedAt time.Time `json:"created_at" validate:"required"`
-	UpdatedAt time.Time `json:"updated_at,omitempty"`
-	Password  string    `json:"-"` // Will be omitted from JSON
+	ID        int       `json:"id" xml:"id"`
+	Name      string    `json:"name" xml:"name"`
+	Email     string    `json:"email,omitempty" xml:"email,omitempty" sensitive:"encrypt,mask=email"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at" validate:"required"`
+	UpdatedAt time.Time `json:"updated_at,omitempty" xml:"updated_at"`
+	Version   int       `json:"version" xml:"version"`        // Bumped on every update, see user_repository.go
+	Password  string    `json:"-" xml:"-" sensitive:"redact"` // PHC hash (see password.go), omitted from JSON
 }
 
 // Example 2: Custom JSON marshaling
+// Duration also accepts "7d", "2w" and ISO 8601 forms like "P1DT2H" (see duration.go)
 type Duration struct {
 	time.Duration
 }
 
 func (d Duration) MarshalJSON() ([]byte, error) {
-	return json.Marshal(d.String())
+	return json.Marshal(FormatExtendedDuration(d.Duration))
 }
 
 func (d *Duration) UnmarshalJSON(b []byte) error {
@@ -34,11 +45,15 @@ func (d *Duration) UnmarshalJSON(b []byte) error {
 	
 	switch value := v.(type) {
 	case float64:
+		// Raw nanoseconds
+		if math.IsNaN(value) || value >= math.MaxInt64 || value < math.MinInt64 {
+			return fmt.Errorf("%w: %v nanoseconds", ErrDurationRange, value)
+		}
 		d.Duration = time.Duration(value)
 		return nil
 	case string:
 		var err error
-		d.Duration, err = time.ParseDuration(value)
+		d.Duration, err = ParseExtendedDuration(value)
 		if err != nil {
 			return err
 		}
@@ -48,60 +63,97 @@ func (d *Duration) UnmarshalJSON(b []byte) error {
 	}
 }
 
-// Example 3: Builder Pattern
-type Computer struct {
-	CPU       string
-	RAM       int
-	Storage   int
-	GPU       string
-	Monitor   bool
-	Keyboard  bool
-	Mouse     bool
+// MarshalText and UnmarshalText let Duration work with flag.TextVar,
+// environment variables and any other text-based encoding
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(FormatExtendedDuration(d.Duration)), nil
 }
 
-type ComputerBuilder struct {
-	computer *Computer
+func (d *Duration) UnmarshalText(b []byte) error {
+	parsed, err := ParseExtendedDuration(string(b))
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
 }
 
-func NewComputerBuilder() *ComputerBuilder {
-	return &ComputerBuilder{computer: &Computer{}}
+func (d Duration) ISO8601() string {
+	return FormatISODuration(d.Duration)
 }
 
-func (b *ComputerBuilder) WithCPU(cpu string) *ComputerBuilder {
-	b.computer.CPU = cpu
-	return b
+// Example 3: Builder Pattern
+// The WithX methods, defaultComputer and validateComputer are generated
+// from the tags below into computer_builder_gen.go
+//
+//go:generate go run ../tools/genbuilder/genbuilder.go -type Computer -mode builder -output computer_builder_gen.go advanced_structs.go
+type Computer struct {
+	CPU      string `json:"cpu" xml:"cpu" validate:"required"`
+	RAM      int    `json:"ram" xml:"ram" validate:"min=1"`         // GB
+	Storage  int    `json:"storage" xml:"storage" validate:"min=1"` // GB
+	GPU      string `json:"gpu,omitempty" xml:"gpu,omitempty"`
+	Monitor  bool   `json:"monitor,omitempty" xml:"monitor,omitempty"`
+	Keyboard bool   `json:"keyboard,omitempty" xml:"keyboard,omitempty"`
+	Mouse    bool   `json:"mouse,omitempty" xml:"mouse,omitempty"`
 }
 
-func (b *ComputerBuilder) WithRAM(ram int) *ComputerBuilder {
-	b.computer.RAM = ram
-	return b
+// ComputerBuilder holds a spec by value, so every Build returns a new
+// Computer and a builder can be cloned and reused (see computer.go)
+type ComputerBuilder struct {
+	spec    Computer
+	catalog *ComputerCatalog
+	err     error // Set by ComputerCatalog.Builder for an unknown preset
 }
 
-func (b *ComputerBuilder) WithStorage(storage int) *ComputerBuilder {
-	b.computer.Storage = storage
-	return b
+func NewComputerBuilder() *ComputerBuilder {
+	return &ComputerBuilder{spec: defaultComputer(), catalog: DefaultComputerCatalog}
+}
+
+// Clone returns an independent copy to customize
+func (b *ComputerBuilder) Clone() *ComputerBuilder {
+	c := *b
+	return &c
 }
 
-func (b *ComputerBuilder) WithGPU(gpu string) *ComputerBuilder {
-	b.computer.GPU = gpu
+// WithCatalog checks parts against catalog; nil checks only the basics
+func (b *ComputerBuilder) WithCatalog(catalog *ComputerCatalog) *ComputerBuilder {
+	b.catalog = catalog
 	return b
 }
 
 func (b *ComputerBuilder) WithPeripherals(monitor, keyboard, mouse bool) *ComputerBuilder {
-	b.computer.Monitor = monitor
-	b.computer.Keyboard = keyboard
-	b.computer.Mouse = mouse
+	b.spec.Monitor = monitor
+	b.spec.Keyboard = keyboard
+	b.spec.Mouse = mouse
 	return b
 }
 
-func (b *ComputerBuilder) Build() *Computer {
-	return b.computer
+// Build checks the spec and returns a new Computer. Every broken rule
+// is reported as a *ValidationError inside ValidationErrors.
+func (b *ComputerBuilder) Build() (*Computer, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	var errs ValidationErrors
+	validateComputer(&b.spec, errs.Add)
+	if b.catalog != nil {
+		b.catalog.check(&b.spec, &errs)
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	computer := b.spec
+	return &computer, nil
 }
 
 // Example 4: Inheritance-like behavior with embedding
+// Species types such as Dog embed Animal (see shelter.go)
 type Animal struct {
-	Name   string
-	Species string
+	ID           int           `json:"id"`
+	Name         string        `json:"name"`
+	Species      string        `json:"species"`
+	Born         time.Time     `json:"born,omitzero"`
+	Vaccinations []Vaccination `json:"vaccinations,omitempty"`
 }
 
 func (a *Animal) Describe() string {
@@ -119,22 +171,29 @@ func (p *Pet) FullInfo() string {
 }
 
 // Example 5: Method chaining
+// StringBuilder appends to a growable byte buffer, indenting and
+// prefixing each new line (see string_builder.go)
 type StringBuilder struct {
-	str string
+	buf        []byte
+	indent     int
+	indentUnit string // "\t" when empty
+	prefix     string
+	midLine    bool // Set once the current line has content
 }
 
 func (sb *StringBuilder) Append(s string) *StringBuilder {
-	sb.str += s
+	sb.WriteString(s)
 	return sb
 }
 
 func (sb *StringBuilder) AppendLine(s string) *StringBuilder {
-	sb.str += s + "\n"
+	sb.WriteString(s)
+	sb.newline()
 	return sb
 }
 
 func (sb *StringBuilder) ToString() string {
-	return sb.str
+	return string(sb.buf)
 }
 
 func main() {
@@ -144,8 +203,18 @@ func main() {
 		Name:      "John Doe",
 		Email:     "john@example.com",
 		CreatedAt: time.Now(),
-		Password:  "secret123",
 	}
+
+	// Passwords are stored as PBKDF2 hashes (see password.go)
+	hasher := NewPasswordHasher()
+	policy := DefaultPasswordPolicy()
+	if err := user.SetPassword(hasher, policy, "secret123"); err != nil {
+		fmt.Printf("Rejected password: %v\n", err)
+	}
+	if err := user.SetPassword(hasher, policy, "Correct-Horse-42"); err != nil {
+		fmt.Printf("Rejected password: %v\n", err)
+	}
+	fmt.Printf("Stored hash: %s\n", user.Password)
 	
 	jsonData, _ := json.MarshalIndent(user, "", "  ")
 	fmt.Printf("JSON with struct tags:\n%s\n\n", jsonData)
@@ -160,16 +229,56 @@ func main() {
 	jsonConfig, _ := json.MarshalIndent(config, "", "  ")
 	fmt.Printf("Custom marshaled JSON:\n%s\n\n", jsonConfig)
 
+	for _, input := range []string{`"7d"`, `"2w3d"`, `"P1DT2H"`, `"PT0.5S"`, `"P1M"`, `"300000w"`, `90000000000`} {
+		var parsed Duration
+		if err := json.Unmarshal([]byte(input), &parsed); err != nil {
+			fmt.Printf("%-10s error: %v\n", input, err)
+			continue
+		}
+		text, _ := parsed.MarshalText()
+		fmt.Printf("%-10s %-8s %s\n", input, text, parsed.ISO8601())
+	}
+
+	// The same type works as a flag and in environment variables
+	flags := flag.NewFlagSet("example", flag.ContinueOnError)
+	var retention Duration
+	flags.TextVar(&retention, "retention", Duration{week}, "how long to keep data")
+	flags.Parse([]string{"-retention", "P30D"})
+	os.Setenv("EXAMPLE_GRACE", "1d12h")
+	grace, _ := DurationFromEnv("EXAMPLE_GRACE", Duration{time.Hour})
+	limited, err := DurationRange{Min: time.Minute, Max: week, Clamp: true}.Apply(retention.Duration)
+	fmt.Printf("Flag: %s, env: %s, clamped to a week: %s (err: %v)\n\n",
+		FormatExtendedDuration(retention.Duration), FormatExtendedDuration(grace.Duration),
+		FormatExtendedDuration(limited), err)
+
 	// Example 3: Builder Pattern
-	computer := NewComputerBuilder().
+	computer, err := NewComputerBuilder().
 		WithCPU("Intel i7").
 		WithRAM(32).
 		WithStorage(1000).
 		WithGPU("NVIDIA RTX 3080").
 		WithPeripherals(true, true, true).
 		Build()
-	
-	fmt.Printf("Built computer: %+v\n\n", computer)
+	fmt.Printf("Built computer: %+v (err: %v)\n", computer, err)
+
+	// Builders are reusable: each Build returns a separate Computer
+	workstation := NewComputerBuilder().WithCPU("Intel i9").WithRAM(64).WithStorage(2000)
+	base, _ := workstation.Build()
+	withGPU, _ := workstation.Clone().WithGPU("NVIDIA RTX 4090").Build()
+	fmt.Printf("Base: %+v, with GPU: %+v\n", base, withGPU)
+
+	_, err = NewComputerBuilder().WithCPU("Intel i5").WithGPU("NVIDIA RTX 3080").WithStorage(256).Build()
+	fmt.Printf("Invalid build: %v\n", err)
+
+	// Named presets from the catalog (see computer_catalog.json)
+	catalog := DefaultComputerCatalog
+	for _, name := range catalog.PresetNames() {
+		preset, _ := catalog.Builder(name).Build()
+		fmt.Printf("  %-10s %s %dGB/%dGB %s  %s\n", name, preset.CPU, preset.RAM, preset.Storage, preset.GPU,
+			FormatCents(catalog.Price(preset)))
+	}
+	_, err = catalog.Builder("gaming").Clone().WithRAM(16).Build()
+	fmt.Printf("Gaming preset with 16GB: %v\n\n", err)
 
 	// Example 4: Inheritance-like behavior
 	pet := &Pet{
@@ -183,6 +292,56 @@ func main() {
 	
 	fmt.Println(pet.FullInfo())
 
+	// Shelter registry with species types and adoptions (see shelter.go)
+	clock := time.Date(2024, time.March, 1, 10, 0, 0, 0, time.UTC)
+	shelter := NewShelterRegistry()
+	shelter.Now = func() time.Time { return clock }
+	alice := shelter.AddOwner(Owner{Name: "Alice", Email: "alice@example.com", Address: "123 Pet Street"})
+	bob := shelter.AddOwner(Owner{Name: "Bob", Email: "bob@example.com", Address: "9 Elm Road"})
+
+	rex, _ := shelter.Intake(NewDog("Rex", "Beagle", time.Date(2021, time.May, 2, 0, 0, 0, 0, time.UTC)))
+	luna, _ := shelter.Intake(NewCat("Luna", true, time.Date(2023, time.August, 20, 0, 0, 0, 0, time.UTC)))
+	shelter.Intake(NewRabbit("Clover", "Lionhead", time.Date(2023, time.December, 1, 0, 0, 0, 0, time.UTC)))
+
+	fmt.Printf("Rex available before shots: %v\n", shelter.MakeAvailable(rex))
+	for _, v := range []string{"rabies", "DHPP", "bordetella"} {
+		shelter.Vaccinate(rex, v)
+	}
+	shelter.Vaccinate(luna, "rabies")
+	shelter.Vaccinate(luna, "FVRCP")
+	fmt.Printf("Rex available after shots: %v\n", shelter.MakeAvailable(rex))
+	shelter.MakeAvailable(luna)
+
+	clock = clock.AddDate(0, 0, 3)
+	shelter.PlaceHold(rex, alice.ID)
+	fmt.Printf("Bob adopts Rex on hold for Alice: %v\n", shelter.Adopt(rex, bob.ID))
+	shelter.Adopt(rex, alice.ID)
+	adopted, _ := shelter.Pet(rex)
+	fmt.Println(adopted.FullInfo())
+	fmt.Printf("Listing adopted Rex again: %v\n", shelter.MakeAvailable(rex))
+
+	young := shelter.Search(AnimalQuery{MaxAge: 1, Statuses: []AdoptionStatus{StatusAvailable, StatusIntake}})
+	for _, e := range young {
+		a := e.Animal.animal()
+		fmt.Printf("  %s the %s (%s)\n", a.Name, a.Species, e.Status)
+	}
+	if entry, err := shelter.Get(rex); err == nil {
+		if next := DueVaccinations(entry.Animal, entry.IntakeAt, clock); len(next) > 0 {
+			fmt.Printf("Rex's next shot: %s on %s\n", next[0].Vaccine, next[0].Due.Format(time.DateOnly))
+		}
+	}
+
+	shelterPath := filepath.Join(os.TempDir(), "shelter.json")
+	defer os.Remove(shelterPath)
+	if err := shelter.Save(shelterPath); err == nil {
+		reloaded, err := LoadShelterRegistry(shelterPath)
+		if err == nil {
+			entry, _ := reloaded.Get(rex)
+			dog := entry.Animal.(*Dog)
+			fmt.Printf("Reloaded %s (%s), %s, %d status changes\n", dog.Name, dog.Breed, entry.Status, len(entry.History))
+		}
+	}
+
 	// Example 5: Method chaining
 	sb := &StringBuilder{}
 	result := sb.Append("Hello").
@@ -192,4 +351,279 @@ func main() {
 		ToString()
 	
 	fmt.Printf("\nMethod chaining result:\n%s", result)
+
+	// Generating code with indentation, prefixes and io.Writer
+	gen := &StringBuilder{}
+	gen.WithPrefix("// ").AppendLine("Code generated for the demo. DO NOT EDIT.").AppendLine("").WithPrefix("")
+	gen.Block("func describe(c Computer) string {", func(sb *StringBuilder) {
+		sb.Block("if c.GPU != \"\" {", func(sb *StringBuilder) {
+			sb.Appendf("return %q\n", "gaming")
+		}, "}")
+		sb.Appendf("return fmt.Sprintf(%q, c.RAM)\n", "desktop with %dGB")
+	}, "}")
+	gen.Append("// Parts: ").Join([]string{"CPU", "RAM", "Storage"}, ", ").AppendLine("")
+	json.NewEncoder(gen.Indent()).Encode(map[string]int{"ram": 64})
+	fmt.Printf("\nGenerated:\n%s", gen)
+
+	// Example 6: Storing users (see user_repository.go)
+	dir, _ := os.MkdirTemp("", "users")
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	path := filepath.Join(dir, "users.jsonl")
+	stored := &User{Name: "John Doe", Email: "john@example.com"}
+	repo, err := OpenFileUserRepository(path)
+	if err == nil {
+		err = repo.Create(ctx, stored)
+	}
+	if err == nil {
+		stored.Name = "John A. Doe"
+		err = repo.Update(ctx, stored)
+	}
+	var loaded *User
+	if err == nil {
+		var reopened *FileUserRepository
+		if reopened, err = OpenFileUserRepository(path); err == nil {
+			loaded, err = reopened.Get(ctx, stored.ID)
+		}
+	}
+	if err != nil {
+		fmt.Printf("Storing users: %v\n", err)
+	} else {
+		fmt.Printf("Reloaded from %s: %s (version %d)\n", filepath.Base(path), loaded.Name, loaded.Version)
+	}
+
+	// Example 7: Upgrading password hashes on login
+	legacy := &User{Name: "Legacy", Password: LegacyPasswordPrefix + "secret123"} // Plaintext from before hashing
+	rehashed, err := legacy.CheckPassword(hasher, "secret123")
+	fmt.Printf("\nLegacy login: rehashed=%v err=%v\n", rehashed, err)
+
+	weak := &PasswordHasher{Algorithm: "pbkdf2-sha256", Iterations: 1000, SaltLength: 16, KeyLength: 32}
+	legacy.Password, _ = weak.Hash("secret123")
+	rehashed, err = legacy.CheckPassword(hasher, "secret123")
+	fmt.Printf("Weak hash login: rehashed=%v err=%v\n", rehashed, err)
+	rehashed, err = legacy.CheckPassword(hasher, "secret123")
+	fmt.Printf("Second login: rehashed=%v err=%v\n", rehashed, err)
+	_, err = legacy.CheckPassword(hasher, "wrong")
+	fmt.Printf("Wrong password: %v\n", err)
+	_, err = (&User{Name: "No password"}).CheckPassword(hasher, "")
+	fmt.Printf("Empty stored password: %v\n", err)
+
+	// Example 8: REST API over the repository (see user_api.go)
+	api := NewUserAPI(NewMemoryUserRepository(), hasher, policy)
+	created := httptest.NewRecorder()
+	api.ServeHTTP(created, httptest.NewRequest(http.MethodPost, "/users",
+		strings.NewReader(`{"name":"Ann","email":"ann@example.com","password":"Correct-Horse-42"}`)))
+	fmt.Printf("\nPOST /users: %d %s", created.Code, created.Body)
+
+	fetch := httptest.NewRequest(http.MethodGet, created.Header().Get("Location"), nil)
+	fetch.Header.Set("If-None-Match", created.Header().Get("ETag"))
+	cached := httptest.NewRecorder()
+	api.ServeHTTP(cached, fetch)
+	fmt.Printf("GET with If-None-Match %s: %d\n", created.Header().Get("ETag"), cached.Code)
+
+	// Example 9: Diffing records as JSON Patch (see struct_diff.go)
+	before := user
+	after := user
+	after.Name = "John A. Doe"
+	after.Email = ""
+	after.Version++
+	after.Password = "changed, but never diffed"
+	patch, _ := Diff(before, after)
+	fmt.Printf("\nUser patch: %s\n", patch)
+
+	replica := before
+	err = ApplyPatch(&replica, patch)
+	fmt.Printf("Applied: name=%q email=%q version=%d, password kept: %v (err: %v)\n",
+		replica.Name, replica.Email, replica.Version, replica.Password == before.Password, err)
+	err = ApplyPatch(&replica, JSONPatch{
+		{Op: "replace", Path: "/name", Value: json.RawMessage(`"Nobody"`)},
+		{Op: "test", Path: "/version", Value: json.RawMessage(`0`)},
+	})
+	fmt.Printf("Failed test leaves the user alone: %q (err: %v)\n", replica.Name, err)
+
+	// Example 10: Audit trail with point-in-time history (see user_audit.go)
+	auditPath := filepath.Join(dir, "audit.jsonl")
+	auditLog, err := OpenAuditLog(auditPath)
+	if err != nil {
+		fmt.Printf("Audit log: %v\n", err)
+	} else {
+		auditClock := time.Date(2024, time.June, 1, 9, 0, 0, 0, time.UTC)
+		auditLog.Now = func() time.Time { return auditClock }
+		audited := NewAuditedUserRepository(NewMemoryUserRepository(), auditLog)
+
+		carol := &User{Name: "Carol", Email: "carol@example.com"}
+		err = audited.Create(WithAuditInfo(ctx, "signup-form", "self registration"), carol)
+		if err == nil {
+			auditClock = auditClock.Add(24 * time.Hour)
+			carol.Name = "Carol Smith"
+			err = audited.Update(WithAuditInfo(ctx, "admin:dave", "name change after marriage"), carol)
+		}
+		if err == nil {
+			auditClock = auditClock.Add(24 * time.Hour)
+			err = carol.SetPassword(hasher, policy, "Another-Strong-99")
+		}
+		if err == nil {
+			err = audited.Update(WithAuditInfo(ctx, "carol", "password reset"), carol)
+		}
+		if err == nil {
+			auditClock = auditClock.Add(24 * time.Hour)
+			err = audited.Delete(WithAuditInfo(ctx, "admin:dave", "GDPR erasure request"), carol.ID, carol.Version)
+		}
+		auditLog.Close()
+		if err != nil {
+			fmt.Printf("Audited change: %v\n", err)
+		}
+
+		fmt.Println("\nAudit trail:")
+		for _, e := range auditLog.Query(AuditQuery{UserID: carol.ID}) {
+			fmt.Printf("  #%d %s %s by %s (%s): %v\n", e.Seq, e.At.Format(time.DateOnly), e.Action, e.Actor, e.Reason, e.Fields)
+		}
+		secondDay := auditLog.Query(AuditQuery{From: time.Date(2024, time.June, 2, 0, 0, 0, 0, time.UTC), To: time.Date(2024, time.June, 3, 0, 0, 0, 0, time.UTC)})
+		fmt.Printf("Changes on 2 June: %d\n", len(secondDay))
+		then, err := auditLog.UserAt(carol.ID, time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC))
+		if err == nil {
+			fmt.Printf("Carol at noon on 1 June: %s, version %d, email kept out of the log: %v\n", then.Name, then.Version, then.Email == "")
+		}
+		_, err = auditLog.UserAt(carol.ID, time.Date(2024, time.June, 5, 0, 0, 0, 0, time.UTC))
+		fmt.Printf("Carol on 5 June: %v\n", err)
+
+		// Editing an entry breaks the hash chain; tamper with a copy
+		raw, _ := os.ReadFile(auditPath)
+		tamperedPath := filepath.Join(dir, "audit-tampered.jsonl")
+		os.WriteFile(tamperedPath, []byte(strings.Replace(string(raw), "admin:dave", "admin:eve", 1)), 0o600)
+		_, err = OpenAuditLog(tamperedPath)
+		fmt.Printf("Opening an edited copy: %v\n", err)
+		if original, err := OpenAuditLog(auditPath); err == nil {
+			fmt.Printf("The original still verifies: %d entries\n", len(original.Query(AuditQuery{})))
+			original.Close()
+		}
+	}
+
+	// Example 11: One set of tags, four formats (see codecs.go)
+	codecs := DefaultCodecs()
+	for _, accept := range []string{"", "application/yaml", "text/html, application/toml;q=0.9, */*;q=0.1", "application/*;q=0.5, application/json;q=0", "image/png"} {
+		if c, err := codecs.Negotiate(accept); err != nil {
+			fmt.Printf("Accept %q: %v\n", accept, err)
+		} else {
+			fmt.Printf("Accept %q: %s\n", accept, c.ContentType())
+		}
+	}
+	for _, c := range []Codec{YAMLCodec{}, TOMLCodec{}} {
+		doc, _ := c.Marshal(user)
+		fmt.Printf("User as %s:\n%s\n", c.ContentType(), doc)
+	}
+	var fromYAML Computer
+	err = YAMLCodec{}.Unmarshal([]byte("# hand-written\ncpu: Apple M3\nram: 24\nstorage: 1024\nmonitor: true\n"), &fromYAML)
+	fmt.Printf("Hand-written YAML: %+v, %v\n", fromYAML, err)
+
+	// Example 12: JSON Schema from the same tags (see json_schema.go)
+	computerSchema, err := GenerateJSONSchema[Computer]()
+	if err != nil {
+		fmt.Printf("Schema: %v\n", err)
+	} else {
+		fmt.Printf("Computer schema:\n%s\n", computerSchema)
+		err = computerSchema.Validate([]byte(`{"cpu": "", "ram": 0, "storage": 512, "rgb": true}`))
+		fmt.Printf("Validating a bad computer: %v\n", err)
+	}
+
+	// Example 13: Sensitive fields stay out of logs and off disk (see sensitive.go)
+	fmt.Printf("User with %%+v: %+v\n", user)
+	slog.New(slog.NewTextHandler(os.Stdout, nil)).Info("signed up", "user", user)
+
+	keys, err := OpenKeyRing(filepath.Join(dir, "keys.json"))
+	if err != nil {
+		fmt.Printf("Key ring: %v\n", err)
+	} else {
+		sealedPath := filepath.Join(dir, "sealed.jsonl")
+		dana := &User{Name: "Dana", Email: "dana@example.com", Password: user.Password}
+		sealedRepo, err := OpenEncryptedFileUserRepository(sealedPath, keys, RequireSealed)
+		if err == nil {
+			err = sealedRepo.Create(ctx, dana)
+		}
+		var raw []byte
+		if err == nil {
+			raw, err = os.ReadFile(sealedPath)
+		}
+		if err == nil {
+			fmt.Printf("On disk: %s", raw)
+			oldKey := keys.Active()
+			var newKey string
+			if newKey, err = keys.Rotate(); err == nil {
+				fmt.Printf("Retire the active key: %v\n", keys.Retire(newKey))
+				if err = sealedRepo.Reseal(); err == nil {
+					err = keys.Retire(oldKey)
+				}
+				fmt.Printf("Resealed with %s, retired %s: %v, keys now %v\n", newKey, oldKey, err, keys.KeyIDs())
+			}
+		}
+		var reloadedKeys *KeyRing
+		if err == nil {
+			reloadedKeys, err = OpenKeyRing(filepath.Join(dir, "keys.json"))
+		}
+		var back *User
+		if err == nil {
+			var sealedAgain *FileUserRepository
+			if sealedAgain, err = OpenEncryptedFileUserRepository(sealedPath, reloadedKeys, RequireSealed); err == nil {
+				back, err = sealedAgain.Get(ctx, dana.ID)
+			}
+		}
+
+		if err != nil {
+			fmt.Printf("Sealed repository: %v\n", err)
+		} else {
+			fmt.Printf("Reopened with the key file: %s, password kept: %v\n", back.Email, back.Password == dana.Password)
+			if wrongKeys, err := NewKeyRing(); err == nil {
+				_, err = OpenEncryptedFileUserRepository(sealedPath, wrongKeys, RequireSealed)
+				fmt.Printf("Reopened with the wrong keys: %v\n", err)
+			}
+
+			// Plaintext is only read when migrating an unencrypted file
+			plainPath := filepath.Join(dir, "plain.jsonl")
+			plainRepo, err := OpenFileUserRepository(plainPath)
+			if err == nil {
+				err = plainRepo.Create(ctx, &User{Name: "Eve", Email: "eve@example.com"})
+			}
+			if err != nil {
+				fmt.Printf("Plaintext repository: %v\n", err)
+			} else {
+				_, err = OpenEncryptedFileUserRepository(plainPath, reloadedKeys, RequireSealed)
+				fmt.Printf("Opening a plaintext file: %v\n", err)
+				migrated, err := OpenEncryptedFileUserRepository(plainPath, reloadedKeys, MigratePlaintext)
+				if err == nil {
+					err = migrated.Reseal()
+				}
+				_, reopenErr := OpenEncryptedFileUserRepository(plainPath, reloadedKeys, RequireSealed)
+				fmt.Printf("Migrated: %v, reopened sealed: %v\n", err, reopenErr)
+			}
+		}
+	}
+
+	// Example 14: Deep copies don't share embedded pointers (see deep_copy.go)
+	buddy := Pet{
+		Animal: &Animal{Name: "Buddy", Species: "Dog", Vaccinations: []Vaccination{{Vaccine: "Rabies"}}},
+		Owner:  "Alice",
+	}
+	shallow, deep := buddy, DeepCopy(buddy)
+	buddy.Name = "Bud"
+	buddy.Vaccinations[0].Vaccine = "Distemper"
+	fmt.Printf("Plain copy: %s, deep copy: %s\n", shallow.Name, deep.Name)
+	if equal, diff := DeepEqual(buddy, deep); !equal {
+		fmt.Printf("First difference: %v\n", diff)
+	}
+	deep.Name = "Bud"
+	_, diff := DeepEqual(buddy, deep)
+	fmt.Printf("After renaming: %v\n", diff)
+
+	type node struct {
+		Value int
+		next  *node
+	}
+	ring := &node{Value: 1}
+	ring.next = &node{Value: 2, next: ring}
+	ringCopy := DeepCopy(ring)
+	fmt.Printf("Cycle kept: %v, shares nodes: %v\n", ringCopy.next.next == ringCopy, ringCopy.next == ring.next)
+	ringCopy.next.Value = 3
+	_, diff = DeepEqual(ring, ringCopy)
+	fmt.Printf("Ring difference: %v\n", diff)
 }
\ No newline at end of file
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Date is a calendar date with no time of day or time zone,
+// encoded in JSON as "2006-01-02"
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+func NewDate(year int, month time.Month, day int) Date {
+	return Date{Year: year, Month: month, Day: day}
+}
+
+// DateOf returns the calendar date of t in t's own location
+func DateOf(t time.Time) Date {
+	y, m, d := t.Date()
+	return Date{Year: y, Month: m, Day: d}
+}
+
+func (d Date) IsZero() bool {
+	return d == Date{}
+}
+
+func (d Date) Before(other Date) bool {
+	if d.Year != other.Year {
+		return d.Year < other.Year
+	}
+	if d.Month != other.Month {
+		return d.Month < other.Month
+	}
+	return d.Day < other.Day
+}
+
+// In returns midnight at the start of d in loc
+func (d Date) In(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+// DaysUntil counts calendar days from d to other
+func (d Date) DaysUntil(other Date) int {
+	return int(other.In(time.UTC).Sub(d.In(time.UTC)).Hours() / 24)
+}
+
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.String())
+}
+
+func (d *Date) UnmarshalJSON(b []byte) error {
+	var s *string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if s == nil {
+		*d = Date{}
+		return nil
+	}
+	t, err := time.Parse(time.DateOnly, *s)
+	if err != nil {
+		return fmt.Errorf("invalid date %q, want YYYY-MM-DD", *s)
+	}
+	*d = DateOf(t)
+	return nil
+}
+
+// MarshalText and UnmarshalText use the same form for CSV cells and
+// other text encodings; the zero Date is an empty string
+func (d Date) MarshalText() ([]byte, error) {
+	if d.IsZero() {
+		return nil, nil
+	}
+	return []byte(d.String()), nil
+}
+
+func (d *Date) UnmarshalText(b []byte) error {
+	if len(b) == 0 {
+		*d = Date{}
+		return nil
+	}
+	t, err := time.Parse(time.DateOnly, string(b))
+	if err != nil {
+		return fmt.Errorf("invalid date %q, want YYYY-MM-DD", b)
+	}
+	*d = DateOf(t)
+	return nil
+}
+
+// LeapDayRule decides when someone born on 29 February has their
+// birthday in a common year; jurisdictions differ
+type LeapDayRule int
+
+const (
+	LeapDayMarch1 LeapDayRule = iota
+	LeapDayFebruary28
+)
+
+// DefaultLeapDayRule is used by Person.Age and UpcomingBirthdays
+var DefaultLeapDayRule = LeapDayMarch1
+
+func isLeapYear(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+// anniversary returns the date d is celebrated in year
+func (d Date) anniversary(year int, rule LeapDayRule) Date {
+	if d.Month == time.February && d.Day == 29 && !isLeapYear(year) {
+		if rule == LeapDayFebruary28 {
+			return Date{year, time.February, 28}
+		}
+		return Date{year, time.March, 1}
+	}
+	return Date{year, d.Month, d.Day}
+}
+
+// AgeOn returns the age in whole years of someone born on d; ok is
+// false when d is the zero Date, meaning the birth date is unknown
+func (d Date) AgeOn(today Date, rule LeapDayRule) (age int, ok bool) {
+	if d.IsZero() {
+		return 0, false
+	}
+	age = today.Year - d.Year
+	if today.Before(d.anniversary(today.Year, rule)) {
+		age--
+	}
+	return age, true
+}
+
+// Age is p's age at the moment at, and false when p has no date of
+// birth. The calendar day is taken in at's location, so pass
+// time.Now().In(loc) for someone living in loc.
+func (p Person) Age(at time.Time) (int, bool) {
+	return p.DateOfBirth.AgeOn(DateOf(at), DefaultLeapDayRule)
+}
+
+// NextBirthday returns the first birthday on or after at's calendar day
+func (p Person) NextBirthday(at time.Time) Date {
+	today := DateOf(at)
+	next := p.DateOfBirth.anniversary(today.Year, DefaultLeapDayRule)
+	if next.Before(today) {
+		next = p.DateOfBirth.anniversary(today.Year+1, DefaultLeapDayRule)
+	}
+	return next
+}
+
+// UpcomingBirthday is one result of UpcomingBirthdays
+type UpcomingBirthday struct {
+	Person    Person
+	Date      Date
+	TurnsAge  int
+	DaysUntil int
+}
+
+// UpcomingBirthdays lists birthdays within the next `days` days of from,
+// soonest first. Today's birthdays have DaysUntil 0.
+func UpcomingBirthdays(people []Person, from time.Time, days int) []UpcomingBirthday {
+	today := DateOf(from)
+	var result []UpcomingBirthday
+	for _, p := range people {
+		if p.DateOfBirth.IsZero() {
+			continue
+		}
+		next := p.NextBirthday(from)
+		until := today.DaysUntil(next)
+		if until > days {
+			continue
+		}
+		result = append(result, UpcomingBirthday{
+			Person:    p,
+			Date:      next,
+			TurnsAge:  next.Year - p.DateOfBirth.Year,
+			DaysUntil: until,
+		})
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].DaysUntil < result[j].DaysUntil })
+	return result
+}
+
+// UnmarshalJSON also accepts records written before Person stored a date
+// of birth: {"Age": 30} becomes an estimated date that makes the person
+// exactly that old today, flagged with DateOfBirthEstimated.
+func (p *Person) UnmarshalJSON(b []byte) error {
+	type plain Person // Same fields, no methods, so no recursion
+	var in struct {
+		plain
+		Age *int
+	}
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+	*p = Person(in.plain)
+
+	if p.DateOfBirth.IsZero() && in.Age != nil {
+		if *in.Age < 0 || *in.Age > 150 {
+			return fmt.Errorf("invalid legacy Age %d", *in.Age)
+		}
+		p.DateOfBirth = DateOf(time.Now().AddDate(-*in.Age, 0, 0))
+		p.DateOfBirthEstimated = true
+	}
+	return nil
+}
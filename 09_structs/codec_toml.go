@@ -0,0 +1,436 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TOMLCodec handles a TOML subset: key = value pairs with bare, quoted
+// and dotted keys, [tables], [[arrays of tables]], basic and literal
+// strings, numbers, booleans, datetimes, arrays (which may span lines)
+// and inline tables. Multi-line strings are not supported. TOML has no
+// null, so nil pointers and maps are left out, and the top level must
+// be a struct or map.
+type TOMLCodec struct{}
+
+func (TOMLCodec) ContentType() string { return "application/toml" }
+
+func (TOMLCodec) Marshal(v any) ([]byte, error) {
+	node, err := toTree(reflect.ValueOf(v), "toml", "json")
+	if err != nil {
+		return nil, fmt.Errorf("toml: %w", err)
+	}
+	m, ok := node.(*codecMap)
+	if !ok {
+		return nil, fmt.Errorf("toml: top level must be a table, not %s", nodeKind(node))
+	}
+	var b strings.Builder
+	if err := writeTOMLTable(&b, nil, m); err != nil {
+		return nil, fmt.Errorf("toml: %w", err)
+	}
+	return []byte(strings.TrimPrefix(b.String(), "\n")), nil
+}
+
+func (TOMLCodec) Unmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("toml: Unmarshal needs a non-nil pointer")
+	}
+	node, err := parseTOML(string(data))
+	if err != nil {
+		return err
+	}
+	if err := fromTree(node, rv.Elem(), "toml", "json"); err != nil {
+		return fmt.Errorf("toml: %w", err)
+	}
+	return nil
+}
+
+// isTOMLTableArray reports whether v is written as [[key]] sections
+func isTOMLTableArray(v any) bool {
+	list, ok := v.([]any)
+	if !ok || len(list) == 0 {
+		return false
+	}
+	for _, item := range list {
+		if _, ok := item.(*codecMap); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// writeTOMLTable writes the plain keys of m first, since every key after
+// a [header] belongs to that table, then its sub-tables
+func writeTOMLTable(b *strings.Builder, path []string, m *codecMap) error {
+	for _, k := range m.keys {
+		v := m.values[k]
+		if _, table := v.(*codecMap); table || v == nil || isTOMLTableArray(v) {
+			continue
+		}
+		s, err := tomlInline(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		b.WriteString(tomlKey(k) + " = " + s + "\n")
+	}
+	for _, k := range m.keys {
+		sub := append(append([]string(nil), path...), tomlKey(k))
+		switch v := m.values[k].(type) {
+		case *codecMap:
+			b.WriteString("\n[" + strings.Join(sub, ".") + "]\n")
+			if err := writeTOMLTable(b, sub, v); err != nil {
+				return err
+			}
+		case []any:
+			if !isTOMLTableArray(v) {
+				continue
+			}
+			for _, item := range v {
+				b.WriteString("\n[[" + strings.Join(sub, ".") + "]]\n")
+				if err := writeTOMLTable(b, sub, item.(*codecMap)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func tomlKey(k string) string {
+	if tomlBareKey.MatchString(k) {
+		return k
+	}
+	return quoteString(k)
+}
+
+func tomlInline(v any) (string, error) {
+	switch n := v.(type) {
+	case nil:
+		return "", errors.New("null has no TOML form")
+	case bool:
+		return strconv.FormatBool(n), nil
+	case int64:
+		return strconv.FormatInt(n, 10), nil
+	case uint64:
+		return strconv.FormatUint(n, 10), nil
+	case float64:
+		s := strconv.FormatFloat(n, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEnN") {
+			s += ".0" // Keep it a float when read back by other tools
+		}
+		return strings.NewReplacer("+Inf", "inf", "-Inf", "-inf", "NaN", "nan").Replace(s), nil
+	case string:
+		return quoteString(n), nil
+	case []any:
+		parts := make([]string, len(n))
+		for i, item := range n {
+			s, err := tomlInline(item)
+			if err != nil {
+				return "", fmt.Errorf("[%d]: %w", i, err)
+			}
+			parts[i] = s
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	case *codecMap:
+		parts := make([]string, 0, len(n.keys))
+		for _, k := range n.keys {
+			if n.values[k] == nil {
+				continue
+			}
+			s, err := tomlInline(n.values[k])
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", k, err)
+			}
+			parts = append(parts, tomlKey(k)+" = "+s)
+		}
+		if len(parts) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(parts, ", ") + " }", nil
+	}
+	return "", fmt.Errorf("unsupported value %v", v)
+}
+
+func parseTOML(src string) (*codecMap, error) {
+	root := newCodecMap()
+	current := root
+	defined := make(map[*codecMap]bool) // Tables that had a [header]
+
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		num := i + 1
+		line := strings.TrimSpace(stripComment(lines[i], false))
+		if line == "" {
+			continue
+		}
+		fail := func(err error) error {
+			return fmt.Errorf("toml: line %d: %w", num, err)
+		}
+
+		if strings.HasPrefix(line, "[[") {
+			name, ok := strings.CutSuffix(line[2:], "]]")
+			if !ok {
+				return nil, fail(errors.New("unterminated array of tables header"))
+			}
+			path, err := parseTOMLKey(name)
+			if err != nil {
+				return nil, fail(err)
+			}
+			parent, err := tomlDescend(root, path[:len(path)-1])
+			if err != nil {
+				return nil, fail(err)
+			}
+			last := path[len(path)-1]
+			existing, _ := parent.get(last)
+			list, ok := existing.([]any)
+			if existing != nil && !ok {
+				return nil, fail(fmt.Errorf("%s is already defined", name))
+			}
+			current = newCodecMap()
+			parent.set(last, append(list, current))
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			name, ok := strings.CutSuffix(line[1:], "]")
+			if !ok {
+				return nil, fail(errors.New("unterminated table header"))
+			}
+			path, err := parseTOMLKey(name)
+			if err != nil {
+				return nil, fail(err)
+			}
+			if current, err = tomlDescend(root, path); err != nil {
+				return nil, fail(err)
+			}
+			if defined[current] {
+				return nil, fail(fmt.Errorf("table [%s] is defined twice", strings.TrimSpace(name)))
+			}
+			defined[current] = true
+			continue
+		}
+
+		keyText, valueText, ok := cutTOMLKey(line)
+		if !ok {
+			return nil, fail(fmt.Errorf("expected key = value, found %q", line))
+		}
+		// An array may continue over the following lines
+		for tomlOpenBrackets(valueText) > 0 && i+1 < len(lines) {
+			i++
+			valueText += " " + strings.TrimSpace(stripComment(lines[i], false))
+		}
+		path, err := parseTOMLKey(keyText)
+		if err != nil {
+			return nil, fail(err)
+		}
+		table, err := tomlDescend(current, path[:len(path)-1])
+		if err != nil {
+			return nil, fail(err)
+		}
+		value, rest, err := parseTOMLValue(valueText)
+		if err != nil {
+			return nil, fail(err)
+		}
+		if rest = strings.TrimSpace(rest); rest != "" {
+			return nil, fail(fmt.Errorf("unexpected %q after value", rest))
+		}
+		last := path[len(path)-1]
+		if _, dup := table.get(last); dup {
+			return nil, fail(fmt.Errorf("key %q is defined twice", last))
+		}
+		table.set(last, value)
+	}
+	return root, nil
+}
+
+// tomlDescend walks path from t, creating tables; a segment naming an
+// array of tables continues in its last element
+func tomlDescend(t *codecMap, path []string) (*codecMap, error) {
+	for _, key := range path {
+		v, ok := t.get(key)
+		if !ok {
+			sub := newCodecMap()
+			t.set(key, sub)
+			t = sub
+			continue
+		}
+		switch n := v.(type) {
+		case *codecMap:
+			t = n
+		case []any:
+			if len(n) == 0 {
+				return nil, fmt.Errorf("%s is not a table", key)
+			}
+			last, ok := n[len(n)-1].(*codecMap)
+			if !ok {
+				return nil, fmt.Errorf("%s is not a table", key)
+			}
+			t = last
+		default:
+			return nil, fmt.Errorf("%s is not a table", key)
+		}
+	}
+	return t, nil
+}
+
+// cutTOMLKey splits a line at the = that follows the key, skipping any
+// = inside a quoted key
+func cutTOMLKey(line string) (key, value string, ok bool) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '=':
+			return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// parseTOMLKey splits a dotted key such as a."b.c".d into its parts
+func parseTOMLKey(s string) ([]string, error) {
+	var path []string
+	s = strings.TrimSpace(s)
+	for {
+		var part string
+		var err error
+		switch {
+		case strings.HasPrefix(s, `"`):
+			part, s, err = unquoteString(s)
+		case strings.HasPrefix(s, "'"):
+			part, s, err = unquoteLiteral(s, false)
+		default:
+			end := strings.IndexAny(s, ". \t")
+			if end < 0 {
+				end = len(s)
+			}
+			part, s = s[:end], s[end:]
+			if !tomlBareKey.MatchString(part) {
+				return nil, fmt.Errorf("invalid key %q", part)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, part)
+		if s = strings.TrimSpace(s); s == "" {
+			return path, nil
+		}
+		if s[0] != '.' {
+			return nil, fmt.Errorf("unexpected %q in key", s)
+		}
+		s = strings.TrimSpace(s[1:])
+	}
+}
+
+// tomlOpenBrackets counts the [ not yet closed outside strings
+func tomlOpenBrackets(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return depth
+}
+
+var tomlBareValue = regexp.MustCompile(`^[0-9A-Za-z_+\-.:]+( [0-9][0-9:.+\-Zz]*)?`)
+
+// parseTOMLValue parses one value from the start of s and returns what
+// is left
+func parseTOMLValue(s string) (any, string, error) {
+	s = strings.TrimLeft(s, " \t")
+	if s == "" {
+		return nil, "", errors.New("missing value")
+	}
+	switch {
+	case strings.HasPrefix(s, `"""`) || strings.HasPrefix(s, "'''"):
+		return nil, "", errors.New("multi-line strings are not supported")
+	case s[0] == '"':
+		return unquoteString(s)
+	case s[0] == '\'':
+		return unquoteLiteral(s, false)
+	case s[0] == '[':
+		list := []any{}
+		s = strings.TrimLeft(s[1:], " \t")
+		for !strings.HasPrefix(s, "]") {
+			item, rest, err := parseTOMLValue(s)
+			if err != nil {
+				return nil, "", err
+			}
+			list = append(list, item)
+			if s = strings.TrimLeft(rest, " \t"); strings.HasPrefix(s, ",") {
+				s = strings.TrimLeft(s[1:], " \t") // A trailing comma is allowed
+			} else if !strings.HasPrefix(s, "]") {
+				return nil, "", errors.New("unterminated array")
+			}
+		}
+		return list, s[1:], nil
+	case s[0] == '{':
+		m := newCodecMap()
+		s = strings.TrimLeft(s[1:], " \t")
+		for !strings.HasPrefix(s, "}") {
+			keyText, rest, ok := cutTOMLKey(s)
+			if !ok {
+				return nil, "", errors.New("expected key = value in inline table")
+			}
+			path, err := parseTOMLKey(keyText)
+			if err != nil {
+				return nil, "", err
+			}
+			table, err := tomlDescend(m, path[:len(path)-1])
+			if err != nil {
+				return nil, "", err
+			}
+			value, rest, err := parseTOMLValue(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			table.set(path[len(path)-1], value)
+			if s = strings.TrimLeft(rest, " \t"); strings.HasPrefix(s, ",") {
+				s = strings.TrimLeft(s[1:], " \t")
+			} else if !strings.HasPrefix(s, "}") {
+				return nil, "", errors.New("unterminated inline table")
+			}
+		}
+		return m, s[1:], nil
+	}
+
+	// Numbers, booleans and datetimes; "1979-05-27 07:32:00" has a space
+	text := tomlBareValue.FindString(s)
+	if text == "" {
+		return nil, "", fmt.Errorf("invalid value %q", s)
+	}
+	rest := s[len(text):]
+	if text != "true" && text != "false" && !strings.ContainsAny(text, ":T") {
+		text = strings.ReplaceAll(text, "_", "") // 1_000 reads as 1000
+	}
+	return plainScalar(text), rest, nil
+}
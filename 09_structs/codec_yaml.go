@@ -0,0 +1,416 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// YAMLCodec handles the block-style subset of YAML that configuration
+// files use: mappings, sequences, plain, single- and double-quoted
+// scalars, flow [] and {} on one line, and comments. Anchors, tags,
+// multi-document streams and | or > block scalars are not supported.
+type YAMLCodec struct{}
+
+func (YAMLCodec) ContentType() string { return "application/yaml" }
+
+func (YAMLCodec) Marshal(v any) ([]byte, error) {
+	node, err := toTree(reflect.ValueOf(v), "yaml", "json")
+	if err != nil {
+		return nil, fmt.Errorf("yaml: %w", err)
+	}
+	var b strings.Builder
+	switch n := node.(type) {
+	case *codecMap:
+		if len(n.keys) == 0 {
+			b.WriteString("{}\n")
+		}
+		writeYAMLMap(&b, n, 0)
+	case []any:
+		if len(n) == 0 {
+			b.WriteString("[]\n")
+		}
+		writeYAMLList(&b, n, 0)
+	default:
+		b.WriteString(yamlScalar(node) + "\n")
+	}
+	return []byte(b.String()), nil
+}
+
+func (YAMLCodec) Unmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("yaml: Unmarshal needs a non-nil pointer")
+	}
+	node, err := parseYAML(string(data))
+	if err != nil {
+		return err
+	}
+	if err := fromTree(node, rv.Elem(), "yaml", "json"); err != nil {
+		return fmt.Errorf("yaml: %w", err)
+	}
+	return nil
+}
+
+func writeYAMLMap(b *strings.Builder, m *codecMap, indent int) {
+	pad := strings.Repeat("  ", indent)
+	for _, k := range m.keys {
+		b.WriteString(pad + yamlKey(k) + ":")
+		writeYAMLValue(b, m.values[k], indent+1)
+	}
+}
+
+func writeYAMLList(b *strings.Builder, list []any, indent int) {
+	pad := strings.Repeat("  ", indent)
+	for _, item := range list {
+		if m, ok := item.(*codecMap); ok && len(m.keys) > 0 {
+			// The first key shares the line with the dash
+			var inner strings.Builder
+			writeYAMLMap(&inner, m, indent+1)
+			b.WriteString(pad + "- " + strings.TrimPrefix(inner.String(), pad+"  "))
+			continue
+		}
+		b.WriteString(pad + "-")
+		writeYAMLValue(b, item, indent+1)
+	}
+}
+
+// writeYAMLValue finishes a line that ends in "key:" or "-"
+func writeYAMLValue(b *strings.Builder, v any, indent int) {
+	switch n := v.(type) {
+	case *codecMap:
+		if len(n.keys) == 0 {
+			b.WriteString(" {}\n")
+			return
+		}
+		b.WriteString("\n")
+		writeYAMLMap(b, n, indent)
+	case []any:
+		if len(n) == 0 {
+			b.WriteString(" []\n")
+			return
+		}
+		b.WriteString("\n")
+		writeYAMLList(b, n, indent)
+	default:
+		b.WriteString(" " + yamlScalar(v) + "\n")
+	}
+}
+
+func yamlKey(k string) string {
+	if k == "" || yamlNeedsQuotes(k) {
+		return quoteString(k)
+	}
+	return k
+}
+
+func yamlScalar(v any) string {
+	switch n := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(n)
+	case int64:
+		return strconv.FormatInt(n, 10)
+	case uint64:
+		return strconv.FormatUint(n, 10)
+	case float64:
+		return strconv.FormatFloat(n, 'g', -1, 64)
+	case string:
+		if yamlNeedsQuotes(n) {
+			return quoteString(n)
+		}
+		return n
+	}
+	return quoteString(fmt.Sprint(v))
+}
+
+// yamlNeedsQuotes reports whether s would read back as something other
+// than the same string if written plain
+func yamlNeedsQuotes(s string) bool {
+	if s == "" || s != strings.TrimSpace(s) {
+		return true
+	}
+	switch strings.ToLower(s) {
+	case "null", "~", "true", "false", "yes", "no", "on", "off", "y", "n":
+		return true
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return true
+	}
+	if _, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return true
+	}
+	if strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") {
+		return true
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") {
+		return true
+	}
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+func parseYAML(src string) (any, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		text := stripComment(raw, true)
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("yaml: line %d: tabs are not allowed for indentation", i+1)
+		}
+		if trimmed == "" || trimmed == "---" || trimmed == "..." {
+			continue
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	p := &yamlParser{lines: lines}
+	node, err := p.block(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return node, nil
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	line := p.lines[min(p.pos, len(p.lines)-1)].num
+	return fmt.Errorf("yaml: line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// block parses the sequence, mapping or scalar that starts at the
+// current line, which is indented by indent
+func (p *yamlParser) block(indent int) (any, error) {
+	l := p.lines[p.pos]
+	switch {
+	case l.text == "-" || strings.HasPrefix(l.text, "- "):
+		return p.sequence(indent)
+	case isYAMLMapEntry(l.text):
+		return p.mapping(indent)
+	}
+	p.pos++
+	return p.inline(l.text)
+}
+
+func (p *yamlParser) sequence(indent int) (any, error) {
+	list := []any{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent != indent || !(l.text == "-" || strings.HasPrefix(l.text, "- ")) {
+			break
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		if rest == "" {
+			p.pos++
+			item, err := p.nested(indent)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+			continue
+		}
+		// Parse what follows the dash as if it started its own line
+		p.lines[p.pos] = yamlLine{num: l.num, indent: l.indent + len(l.text) - len(rest), text: rest}
+		item, err := p.block(p.lines[p.pos].indent)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+func (p *yamlParser) mapping(indent int) (any, error) {
+	m := newCodecMap()
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		if !isYAMLMapEntry(l.text) {
+			return nil, p.errorf("expected key: value, found %q", l.text)
+		}
+		key, rest, err := splitYAMLKey(l.text)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		if _, dup := m.get(key); dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		p.pos++
+
+		var value any
+		if rest != "" {
+			if value, err = p.inline(rest); err != nil {
+				p.pos--
+				return nil, p.errorf("%v", err)
+			}
+		} else if p.pos < len(p.lines) && p.lines[p.pos].indent == indent && strings.HasPrefix(p.lines[p.pos].text, "-") {
+			// A sequence may sit at the same indentation as its key
+			if value, err = p.sequence(indent); err != nil {
+				return nil, err
+			}
+		} else if value, err = p.nested(indent); err != nil {
+			return nil, err
+		}
+		m.set(key, value)
+	}
+	return m, nil
+}
+
+// nested parses the block under a "key:" or "-" line, or null when the
+// next line is not indented further than parent
+func (p *yamlParser) nested(parent int) (any, error) {
+	if p.pos >= len(p.lines) || p.lines[p.pos].indent <= parent {
+		return nil, nil
+	}
+	return p.block(p.lines[p.pos].indent)
+}
+
+func (p *yamlParser) inline(text string) (any, error) {
+	node, rest, err := parseYAMLFlow(text)
+	if err != nil {
+		return nil, err
+	}
+	if rest = strings.TrimSpace(rest); rest != "" {
+		return nil, fmt.Errorf("unexpected %q after value", rest)
+	}
+	return node, nil
+}
+
+func isYAMLMapEntry(text string) bool {
+	_, _, err := splitYAMLKey(text)
+	return err == nil
+}
+
+// splitYAMLKey splits "key: value" into the key and the value text
+func splitYAMLKey(text string) (key, rest string, err error) {
+	switch text[0] {
+	case '"':
+		key, rest, err = unquoteString(text)
+	case '\'':
+		key, rest, err = unquoteLiteral(text, true)
+	case '[', '{':
+		return "", "", errors.New("flow values cannot be keys")
+	default:
+		i := strings.Index(text, ": ")
+		if i < 0 {
+			if !strings.HasSuffix(text, ":") {
+				return "", "", errors.New("missing colon")
+			}
+			i = len(text) - 1
+		}
+		key, rest = strings.TrimRight(text[:i], " "), text[i:]
+	}
+	if err != nil {
+		return "", "", err
+	}
+	rest = strings.TrimLeft(rest, " ")
+	if rest != ":" && !strings.HasPrefix(rest, ": ") {
+		return "", "", errors.New("missing colon")
+	}
+	return key, strings.TrimSpace(rest[1:]), nil
+}
+
+// parseYAMLFlow parses one scalar, [sequence] or {mapping} from the
+// start of s and returns what is left
+func parseYAMLFlow(s string) (any, string, error) {
+	s = strings.TrimLeft(s, " ")
+	if s == "" {
+		return nil, "", nil
+	}
+	switch s[0] {
+	case '"':
+		return unquoteString(s)
+	case '\'':
+		return unquoteLiteral(s, true)
+	case '|', '>':
+		return nil, "", errors.New("block scalars are not supported")
+	case '&', '*', '!':
+		return nil, "", errors.New("anchors, aliases and tags are not supported")
+	case '[':
+		list := []any{}
+		s = strings.TrimLeft(s[1:], " ")
+		for !strings.HasPrefix(s, "]") {
+			item, rest, err := parseYAMLFlow(s)
+			if err != nil {
+				return nil, "", err
+			}
+			list = append(list, item)
+			if s = strings.TrimLeft(rest, " "); strings.HasPrefix(s, ",") {
+				s = strings.TrimLeft(s[1:], " ")
+			} else if !strings.HasPrefix(s, "]") {
+				return nil, "", errors.New("unterminated flow sequence")
+			}
+		}
+		return list, s[1:], nil
+	case '{':
+		m := newCodecMap()
+		s = strings.TrimLeft(s[1:], " ")
+		for !strings.HasPrefix(s, "}") {
+			keyNode, rest, err := parseYAMLFlow(s)
+			if err != nil {
+				return nil, "", err
+			}
+			key, ok := scalarText(keyNode)
+			rest = strings.TrimLeft(rest, " ")
+			if !ok || !strings.HasPrefix(rest, ":") {
+				return nil, "", errors.New("expected key: value in flow mapping")
+			}
+			value, rest, err := parseYAMLFlow(rest[1:])
+			if err != nil {
+				return nil, "", err
+			}
+			m.set(key, value)
+			if s = strings.TrimLeft(rest, " "); strings.HasPrefix(s, ",") {
+				s = strings.TrimLeft(s[1:], " ")
+			} else if !strings.HasPrefix(s, "}") {
+				return nil, "", errors.New("unterminated flow mapping")
+			}
+		}
+		return m, s[1:], nil
+	}
+
+	// A plain scalar runs to the end, or to a flow indicator when nested
+	end := len(s)
+	if i := strings.IndexAny(s, ",]}"); i >= 0 {
+		end = i
+	}
+	if i := strings.Index(s, ": "); i >= 0 && i < end {
+		end = i
+	} else if strings.HasSuffix(s[:end], ":") {
+		end--
+	}
+	text := strings.TrimRight(s[:end], " ")
+	switch text {
+	case "null", "Null", "NULL", "~":
+		return nil, s[end:], nil
+	}
+	return plainScalar(text), s[end:], nil
+}
@@ -0,0 +1,635 @@
+package main
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	ErrNotAcceptable        = errors.New("no acceptable media type")
+)
+
+// Codec encodes and decodes values in one format. The YAML and TOML
+// codecs read the same tags as encoding/json unless a field also has a
+// yaml or toml tag.
+type Codec interface {
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// CodecRegistry picks a codec by media type. The first codec registered
+// is the default for requests without a Content-Type or Accept header.
+type CodecRegistry struct {
+	codecs []Codec
+	byType map[string]Codec
+}
+
+func NewCodecRegistry() *CodecRegistry {
+	return &CodecRegistry{byType: make(map[string]Codec)}
+}
+
+// DefaultCodecs knows JSON, XML, YAML and TOML, in that order of preference
+func DefaultCodecs() *CodecRegistry {
+	r := NewCodecRegistry()
+	r.Register(JSONCodec{})
+	r.Register(XMLCodec{}, "text/xml")
+	r.Register(YAMLCodec{}, "application/x-yaml", "text/yaml")
+	r.Register(TOMLCodec{})
+	return r
+}
+
+// Register adds c under its content type and any aliases
+func (r *CodecRegistry) Register(c Codec, aliases ...string) {
+	r.codecs = append(r.codecs, c)
+	for _, t := range append([]string{c.ContentType()}, aliases...) {
+		r.byType[strings.ToLower(t)] = c
+	}
+}
+
+// ForContentType returns the codec for a Content-Type header value;
+// parameters such as charset are ignored
+func (r *CodecRegistry) ForContentType(header string) (Codec, error) {
+	if len(r.codecs) == 0 {
+		return nil, fmt.Errorf("%w: no codecs registered", ErrUnsupportedMediaType)
+	}
+	if strings.TrimSpace(header) == "" {
+		return r.codecs[0], nil
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %v", ErrUnsupportedMediaType, header, err)
+	}
+	if c, ok := r.byType[mediaType]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, mediaType)
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// Negotiate picks the codec for an Accept header. Ranges are tried by
+// descending q-value, more specific ranges first on ties; "type/*" and
+// "*/*" match the first registered codec that fits and q=0 excludes.
+func (r *CodecRegistry) Negotiate(accept string) (Codec, error) {
+	if strings.TrimSpace(accept) == "" {
+		return r.ForContentType("")
+	}
+
+	var ranges []acceptRange
+	excluded := make(map[string]bool)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue // Browsers send odd entries; skip rather than refuse
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		if q == 0 {
+			excluded[mediaType] = true
+			continue
+		}
+		ranges = append(ranges, acceptRange{mediaType, q})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return strings.Count(ranges[i].mediaType, "*") < strings.Count(ranges[j].mediaType, "*")
+	})
+
+	for _, ar := range ranges {
+		for _, c := range r.codecs {
+			ct := c.ContentType()
+			if !excluded[ct] && mediaTypeMatches(ar.mediaType, ct) {
+				return c, nil
+			}
+		}
+		if c, ok := r.byType[ar.mediaType]; ok && !excluded[ar.mediaType] {
+			return c, nil // An alias such as text/yaml
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrNotAcceptable, accept)
+}
+
+func mediaTypeMatches(pattern, mediaType string) bool {
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(pattern, "/*")
+	return ok && strings.HasPrefix(mediaType, prefix+"/")
+}
+
+// Respond encodes v with the codec the request accepts, answering 406
+// when there is none
+func (r *CodecRegistry) Respond(w http.ResponseWriter, req *http.Request, status int, v any) {
+	c, err := r.Negotiate(req.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+	body, err := c.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", c.ContentType())
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// DecodeRequest decodes the request body with the codec for its
+// Content-Type; the error wraps ErrUnsupportedMediaType for a 415
+func (r *CodecRegistry) DecodeRequest(req *http.Request, v any) error {
+	c, err := r.ForContentType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxBodyBytes))
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(body, v)
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string { return "application/json" }
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.MarshalIndent(v, "", "  ")
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// XMLCodec uses encoding/xml, so structs need xml tags to get the same
+// element names as their JSON members
+type XMLCodec struct{}
+
+func (XMLCodec) ContentType() string { return "application/xml" }
+
+func (XMLCodec) Marshal(v any) ([]byte, error) {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+func (XMLCodec) Unmarshal(data []byte, v any) error {
+	return xml.Unmarshal(data, v)
+}
+
+// The YAML and TOML codecs go through a small document tree. Encoding
+// produces nil, bool, int64, uint64, float64, string, []any and
+// *codecMap; parsing produces nil, string, plainScalar, []any and
+// *codecMap, and the target field decides what a plainScalar means.
+
+// codecMap is a mapping that keeps its keys in insertion order
+type codecMap struct {
+	keys   []string
+	values map[string]any
+}
+
+func newCodecMap() *codecMap {
+	return &codecMap{values: make(map[string]any)}
+}
+
+func (m *codecMap) set(key string, v any) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = v
+}
+
+func (m *codecMap) get(key string) (any, bool) {
+	v, ok := m.values[key]
+	return v, ok
+}
+
+// plainScalar is unquoted text such as 42, true or 2024-06-01, which
+// can be a number, a bool or a string depending on where it goes
+type plainScalar string
+
+var (
+	codecTextMarshaler   = reflect.TypeFor[encoding.TextMarshaler]()
+	codecTextUnmarshaler = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// toTree converts v for an encoder; fields are named by the first of
+// tagKeys they carry and TextMarshalers such as time.Time and Duration
+// become strings
+func toTree(v reflect.Value, tagKeys ...string) (any, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Kind() == reflect.Interface {
+			return toTree(v.Elem(), tagKeys...)
+		}
+	}
+	if v.Type().Implements(codecTextMarshaler) {
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	if v.Kind() == reflect.Pointer {
+		return toTree(v.Elem(), tagKeys...)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+
+	case reflect.Struct:
+		m := newCodecMap()
+		for _, f := range taggedFields(v.Type(), tagKeys...) {
+			fv := patchFieldValue(v, f, false)
+			if !f.present(fv) {
+				continue
+			}
+			node, err := toTree(fv, tagKeys...)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.name, err)
+			}
+			m.set(f.name, node)
+		}
+		return m, nil
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", v.Type().Key())
+		}
+		if v.IsNil() {
+			return nil, nil
+		}
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		m := newCodecMap()
+		for _, k := range keys {
+			node, err := toTree(v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key())), tagKeys...)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			m.set(k, node)
+		}
+		return m, nil
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.IsNil() {
+				return nil, nil
+			}
+			return base64.StdEncoding.EncodeToString(v.Bytes()), nil // As encoding/json does
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		list := make([]any, v.Len())
+		for i := range list {
+			node, err := toTree(v.Index(i), tagKeys...)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			list[i] = node
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// fromTree stores a parsed node in v. Unknown keys are ignored and keys
+// that match no tag exactly fall back to a case-insensitive match, as in
+// encoding/json.
+func fromTree(node any, v reflect.Value, tagKeys ...string) error {
+	if node == nil {
+		v.SetZero()
+		return nil
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return fromTree(node, v.Elem(), tagKeys...)
+	}
+	if v.CanAddr() && reflect.PointerTo(v.Type()).Implements(codecTextUnmarshaler) {
+		text, ok := scalarText(node)
+		if !ok {
+			return fmt.Errorf("cannot decode %s into %s", nodeKind(node), v.Type())
+		}
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		m, ok := node.(*codecMap)
+		if !ok {
+			return fmt.Errorf("cannot decode %s into %s", nodeKind(node), v.Type())
+		}
+		fields := taggedFields(v.Type(), tagKeys...)
+		for _, key := range m.keys {
+			i := slices.IndexFunc(fields, func(f patchField) bool { return f.name == key })
+			if i < 0 {
+				i = slices.IndexFunc(fields, func(f patchField) bool { return strings.EqualFold(f.name, key) })
+			}
+			if i < 0 {
+				continue
+			}
+			if err := fromTree(m.values[key], patchFieldValue(v, fields[i], true), tagKeys...); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		m, ok := node.(*codecMap)
+		if !ok || v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("cannot decode %s into %s", nodeKind(node), v.Type())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(v.Type(), len(m.keys)))
+		}
+		for _, key := range m.keys {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := fromTree(m.values[key], elem, tagKeys...); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+		}
+		return nil
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			text, ok := scalarText(node)
+			if !ok {
+				return fmt.Errorf("cannot decode %s into %s", nodeKind(node), v.Type())
+			}
+			b, err := base64.StdEncoding.DecodeString(text)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(b)
+			return nil
+		}
+		list, ok := node.([]any)
+		if !ok {
+			return fmt.Errorf("cannot decode %s into %s", nodeKind(node), v.Type())
+		}
+		s := reflect.MakeSlice(v.Type(), len(list), len(list))
+		for i, item := range list {
+			if err := fromTree(item, s.Index(i), tagKeys...); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+		v.Set(s)
+		return nil
+
+	case reflect.Array:
+		list, ok := node.([]any)
+		if !ok || len(list) != v.Len() {
+			return fmt.Errorf("cannot decode %s into %s", nodeKind(node), v.Type())
+		}
+		for i, item := range list {
+			if err := fromTree(item, v.Index(i), tagKeys...); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+		return nil
+
+	case reflect.Interface:
+		if v.NumMethod() > 0 {
+			return fmt.Errorf("cannot decode into %s", v.Type())
+		}
+		v.Set(reflect.ValueOf(plainValue(node)))
+		return nil
+	}
+
+	text, ok := scalarText(node)
+	if !ok {
+		return fmt.Errorf("cannot decode %s into %s", nodeKind(node), v.Type())
+	}
+	_, quoted := node.(string)
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+		return nil
+	case reflect.Bool:
+		b, ok := parsePlainBool(text)
+		if !ok || quoted {
+			return fmt.Errorf("cannot decode %q into bool", text)
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(text, 0, v.Type().Bits())
+		if err != nil || quoted {
+			return fmt.Errorf("cannot decode %q into %s", text, v.Type())
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(text, 0, v.Type().Bits())
+		if err != nil || quoted {
+			return fmt.Errorf("cannot decode %q into %s", text, v.Type())
+		}
+		v.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, v.Type().Bits())
+		if err != nil || quoted {
+			return fmt.Errorf("cannot decode %q into %s", text, v.Type())
+		}
+		v.SetFloat(f)
+		return nil
+	}
+	return fmt.Errorf("unsupported type %s", v.Type())
+}
+
+func scalarText(node any) (string, bool) {
+	switch n := node.(type) {
+	case string:
+		return n, true
+	case plainScalar:
+		return string(n), true
+	}
+	return "", false
+}
+
+// parsePlainBool accepts only the spellings YAML 1.2 and TOML share,
+// unlike strconv.ParseBool which also takes 1 and t
+func parsePlainBool(s string) (bool, bool) {
+	switch s {
+	case "true", "True", "TRUE":
+		return true, true
+	case "false", "False", "FALSE":
+		return false, true
+	}
+	return false, false
+}
+
+func nodeKind(node any) string {
+	switch node.(type) {
+	case *codecMap:
+		return "mapping"
+	case []any:
+		return "sequence"
+	}
+	return "scalar"
+}
+
+// plainValue resolves a node for an any target the way encoding/json
+// would: numbers become float64 and mappings map[string]any
+func plainValue(node any) any {
+	switch n := node.(type) {
+	case plainScalar:
+		if b, ok := parsePlainBool(string(n)); ok {
+			return b
+		}
+		if f, err := strconv.ParseFloat(string(n), 64); err == nil {
+			return f
+		}
+		return string(n)
+	case []any:
+		list := make([]any, len(n))
+		for i, item := range n {
+			list[i] = plainValue(item)
+		}
+		return list
+	case *codecMap:
+		m := make(map[string]any, len(n.keys))
+		for _, k := range n.keys {
+			m[k] = plainValue(n.values[k])
+		}
+		return m
+	}
+	return node
+}
+
+// quoteString writes s as a double-quoted string with the escapes YAML
+// and TOML basic strings have in common
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// unquoteString reads a double-quoted string written by quoteString or
+// by hand; s must start with the opening quote. It returns the rest of s
+// after the closing quote.
+func unquoteString(s string) (string, string, error) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			text, err := strconv.Unquote(strings.ReplaceAll(s[:i+1], `\/`, "/"))
+			if err != nil {
+				return "", "", fmt.Errorf("invalid string %s", s[:i+1])
+			}
+			return text, s[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string %s", s)
+}
+
+// unquoteLiteral reads a single-quoted string; doubled quotes stand for
+// one when yaml is set, as in YAML, and TOML has no escapes at all
+func unquoteLiteral(s string, yaml bool) (string, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] != '\'' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if yaml && i+1 < len(s) && s[i+1] == '\'' {
+			b.WriteByte('\'')
+			i++
+			continue
+		}
+		return b.String(), s[i+1:], nil
+	}
+	return "", "", fmt.Errorf("unterminated string %s", s)
+}
+
+// stripComment drops a # comment that is outside quotes; in YAML the #
+// must start the line or follow a space
+func stripComment(line string, yaml bool) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (!yaml || i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return strings.TrimRight(line, " \t")
+}
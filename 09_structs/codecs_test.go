@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// codecTimeouts carries Duration through every codec; TOML and XML
+// cannot encode a bare value at the top level
+type codecTimeouts struct {
+	Timeout Duration            `json:"timeout" xml:"timeout"`
+	Retries []Duration          `json:"retries" xml:"retry"`
+	PerHost map[string]Duration `json:"per_host,omitempty" xml:"-"`
+}
+
+// TestCodecRoundTrips encodes and decodes User, Duration and Computer
+// values with every default codec and expects them back unchanged
+func TestCodecRoundTrips(t *testing.T) {
+	created := time.Date(2024, time.June, 1, 9, 30, 0, 0, time.UTC)
+	users := []User{
+		{ID: 1, Name: "Ann", Email: "ann@example.com", CreatedAt: created, UpdatedAt: created.Add(time.Hour), Version: 2},
+		{ID: 2, Name: `O'Brien: "Jr" # 2`, CreatedAt: created},
+		{ID: 3, Name: "true", Email: "-1", CreatedAt: created, Version: 1},
+		{ID: 4, Name: "Zoë\tand\nnewline", CreatedAt: created},
+	}
+	computers := []Computer{
+		{CPU: "Intel i9", RAM: 32, Storage: 1000, GPU: "RTX 4080", Monitor: true, Keyboard: true, Mouse: true},
+		{CPU: "AMD Ryzen 5", RAM: 16, Storage: 512},
+	}
+	timeouts := []codecTimeouts{
+		{Timeout: Duration{90 * time.Minute}, Retries: []Duration{{time.Second}, {2 * 24 * time.Hour}}, PerHost: map[string]Duration{"api.example.com": {5 * time.Second}}},
+		{Timeout: Duration{0}},
+	}
+
+	for _, c := range DefaultCodecs().codecs {
+		t.Run(c.ContentType(), func(t *testing.T) {
+			for _, u := range users {
+				checkRoundTrip(t, c, u)
+			}
+			for _, comp := range computers {
+				checkRoundTrip(t, c, comp)
+			}
+			for _, tt := range timeouts {
+				if _, ok := c.(XMLCodec); ok {
+					tt.PerHost = nil // encoding/xml has no map support
+				}
+				checkRoundTrip(t, c, tt)
+			}
+		})
+	}
+}
+
+func checkRoundTrip[T any](t *testing.T, c Codec, v T) {
+	t.Helper()
+	if err := roundTrip(c, v); err != nil {
+		t.Errorf("%T: %v", v, err)
+	}
+}
+
+// roundTrip compares through Diff, so the comparison sees what the
+// JSON encoding sees: json:"-" fields are skipped and times compare by
+// their text
+func roundTrip[T any](c Codec, v T) error {
+	data, err := c.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	var got T
+	if err := c.Unmarshal(data, &got); err != nil {
+		return fmt.Errorf("unmarshal: %w\n%s", err, data)
+	}
+	patch, err := Diff(v, got)
+	if err != nil {
+		return err
+	}
+	if len(patch) > 0 {
+		return errors.New("changed by round trip: " + patch.String() + "\n" + string(data))
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+var ErrUnknownPreset = errors.New("unknown preset")
+
+//go:embed computer_catalog.json
+var defaultCatalogJSON []byte
+
+// Part is a CPU or GPU from the catalog. Prices are in cents.
+type Part struct {
+	Name  string `json:"name"`
+	Price int64  `json:"price"`
+
+	MaxRAM      int      `json:"max_ram,omitempty"`      // CPUs: largest supported RAM in GB
+	MinRAM      int      `json:"min_ram,omitempty"`      // GPUs: RAM the card needs
+	MinStorage  int      `json:"min_storage,omitempty"`  // GPUs: storage the card needs
+	RequiresCPU []string `json:"requires_cpu,omitempty"` // GPUs: empty means any CPU
+}
+
+// ComputerCatalog lists the parts that can be ordered, their prices and
+// the named presets
+type ComputerCatalog struct {
+	RAMSizes          []int               `json:"ram_sizes"`
+	RAMPricePerGB     int64               `json:"ram_price_per_gb"`
+	StorageSizes      []int               `json:"storage_sizes"`
+	StoragePricePerGB int64               `json:"storage_price_per_gb"`
+	PeripheralPrices  map[string]int64    `json:"peripheral_prices"`
+	CPUs              []Part              `json:"cpus"`
+	GPUs              []Part              `json:"gpus"`
+	Presets           map[string]Computer `json:"presets"`
+}
+
+// DefaultComputerCatalog is the catalog compiled into the program
+var DefaultComputerCatalog = mustLoadCatalog(defaultCatalogJSON)
+
+func mustLoadCatalog(data []byte) *ComputerCatalog {
+	c, err := LoadComputerCatalog(bytes.NewReader(data))
+	if err != nil {
+		panic("computer_catalog.json: " + err.Error())
+	}
+	return c
+}
+
+// LoadComputerCatalog reads a catalog and checks that every preset is
+// buildable with it
+func LoadComputerCatalog(r io.Reader) (*ComputerCatalog, error) {
+	var c ComputerCatalog
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+	for _, name := range c.PresetNames() {
+		if _, err := c.Builder(name).Build(); err != nil {
+			return nil, fmt.Errorf("preset %q: %w", name, err)
+		}
+	}
+	return &c, nil
+}
+
+func LoadComputerCatalogFile(path string) (*ComputerCatalog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c, err := LoadComputerCatalog(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *ComputerCatalog) PresetNames() []string {
+	names := make([]string, 0, len(c.Presets))
+	for name := range c.Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Builder starts a builder from a preset; an unknown name fails at Build
+func (c *ComputerCatalog) Builder(preset string) *ComputerBuilder {
+	b := &ComputerBuilder{catalog: c}
+	spec, ok := c.Presets[preset]
+	if !ok {
+		b.err = fmt.Errorf("%w %q", ErrUnknownPreset, preset)
+		return b
+	}
+	b.spec = spec
+	return b
+}
+
+func findPart(parts []Part, name string) (Part, bool) {
+	for _, p := range parts {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+	return Part{}, false
+}
+
+// check adds a ValidationError for every rule comp breaks
+func (c *ComputerCatalog) check(comp *Computer, errs *ValidationErrors) {
+	cpu, ok := findPart(c.CPUs, comp.CPU)
+	if !ok && comp.CPU != "" {
+		errs.Add("cpu", fmt.Sprintf("%q is not in the catalog", comp.CPU))
+	}
+	if comp.RAM > 0 && !slices.Contains(c.RAMSizes, comp.RAM) {
+		errs.Add("ram", fmt.Sprintf("%d GB is not offered, choose one of %v", comp.RAM, c.RAMSizes))
+	}
+	if ok && cpu.MaxRAM > 0 && comp.RAM > cpu.MaxRAM {
+		errs.Add("ram", fmt.Sprintf("%s supports at most %d GB", cpu.Name, cpu.MaxRAM))
+	}
+	if comp.Storage > 0 && !slices.Contains(c.StorageSizes, comp.Storage) {
+		errs.Add("storage", fmt.Sprintf("%d GB is not offered, choose one of %v", comp.Storage, c.StorageSizes))
+	}
+
+	if comp.GPU == "" {
+		return
+	}
+	gpu, ok := findPart(c.GPUs, comp.GPU)
+	if !ok {
+		errs.Add("gpu", fmt.Sprintf("%q is not in the catalog", comp.GPU))
+		return
+	}
+	if comp.RAM < gpu.MinRAM {
+		errs.Add("ram", fmt.Sprintf("%s needs at least %d GB", gpu.Name, gpu.MinRAM))
+	}
+	if comp.Storage < gpu.MinStorage {
+		errs.Add("storage", fmt.Sprintf("%s needs at least %d GB", gpu.Name, gpu.MinStorage))
+	}
+	if len(gpu.RequiresCPU) > 0 && !slices.ContainsFunc(gpu.RequiresCPU, func(n string) bool {
+		return strings.EqualFold(n, comp.CPU)
+	}) {
+		errs.Add("gpu", fmt.Sprintf("%s needs one of %s", gpu.Name, strings.Join(gpu.RequiresCPU, ", ")))
+	}
+}
+
+// Price totals the parts of comp in cents; parts missing from the
+// catalog cost nothing, so check comp with Build first
+func (c *ComputerCatalog) Price(comp *Computer) int64 {
+	var total int64
+	if cpu, ok := findPart(c.CPUs, comp.CPU); ok {
+		total += cpu.Price
+	}
+	if gpu, ok := findPart(c.GPUs, comp.GPU); ok {
+		total += gpu.Price
+	}
+	total += int64(comp.RAM)*c.RAMPricePerGB + int64(comp.Storage)*c.StoragePricePerGB
+	for name, has := range map[string]bool{"monitor": comp.Monitor, "keyboard": comp.Keyboard, "mouse": comp.Mouse} {
+		if has {
+			total += c.PeripheralPrices[name]
+		}
+	}
+	return total
+}
+
+// FormatCents renders a price in cents as dollars
+func FormatCents(cents int64) string {
+	return fmt.Sprintf("$%d.%02d", cents/100, cents%100)
+}
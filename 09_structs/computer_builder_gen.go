@@ -0,0 +1,56 @@
+// Code generated by genbuilder -type Computer -mode builder; DO NOT EDIT.
+
+package main
+
+// defaultComputer returns a Computer with the defaults from its struct tags
+func defaultComputer() Computer {
+	return Computer{}
+}
+
+func (b *ComputerBuilder) WithCPU(cpu string) *ComputerBuilder {
+	b.spec.CPU = cpu
+	return b
+}
+
+func (b *ComputerBuilder) WithRAM(ram int) *ComputerBuilder {
+	b.spec.RAM = ram
+	return b
+}
+
+func (b *ComputerBuilder) WithStorage(storage int) *ComputerBuilder {
+	b.spec.Storage = storage
+	return b
+}
+
+func (b *ComputerBuilder) WithGPU(gpu string) *ComputerBuilder {
+	b.spec.GPU = gpu
+	return b
+}
+
+func (b *ComputerBuilder) WithMonitor(monitor bool) *ComputerBuilder {
+	b.spec.Monitor = monitor
+	return b
+}
+
+func (b *ComputerBuilder) WithKeyboard(keyboard bool) *ComputerBuilder {
+	b.spec.Keyboard = keyboard
+	return b
+}
+
+func (b *ComputerBuilder) WithMouse(mouse bool) *ComputerBuilder {
+	b.spec.Mouse = mouse
+	return b
+}
+
+// validateComputer reports every field that breaks its validate tag
+func validateComputer(v *Computer, report func(field, message string)) {
+	if v.CPU == "" {
+		report("cpu", "is required")
+	}
+	if v.RAM < 1 {
+		report("ram", "must be at least 1")
+	}
+	if v.Storage < 1 {
+		report("storage", "must be at least 1")
+	}
+}
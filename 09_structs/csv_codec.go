@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RowError is a problem with one CSV row or JSON Lines record
+type RowError struct {
+	Line   int
+	Column string // Empty when the whole row is at fault
+	Err    error
+}
+
+func (e *RowError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d, column %s: %v", e.Line, e.Column, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// RowErrors collects the rows that failed while the rest were imported
+type RowErrors []*RowError
+
+func (r RowErrors) Error() string {
+	msgs := make([]string, len(r))
+	for i, e := range r {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (r RowErrors) Unwrap() []error {
+	errs := make([]error, len(r))
+	for i, e := range r {
+		errs[i] = e
+	}
+	return errs
+}
+
+// csvField is one column: the path of field indexes from the root struct
+type csvField struct {
+	name  string
+	index []int
+}
+
+var (
+	textMarshalerType   = reflect.TypeFor[encoding.TextMarshaler]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+	timeType            = reflect.TypeFor[time.Time]()
+)
+
+// csvFields lists the columns of struct type t. Fields use their csv tag
+// or their Go name; `csv:"-"` skips a field; untagged embedded structs
+// are flattened into the parent's columns.
+func csvFields(t reflect.Type) ([]csvField, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("csv: %s is not a struct", t)
+	}
+	var fields []csvField
+	seen := make(map[string]bool)
+
+	var walk func(t reflect.Type, index []int) error
+	walk = func(t reflect.Type, index []int) error {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag, hasTag := f.Tag.Lookup("csv")
+			if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+				continue
+			}
+			path := append(append([]int(nil), index...), i)
+
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if f.Anonymous && !hasTag && ft.Kind() == reflect.Struct && !isCSVScalar(ft) {
+				if err := walk(ft, path); err != nil {
+					return err
+				}
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+
+			name := tag
+			if name == "" {
+				name = f.Name
+			}
+			if seen[name] {
+				return fmt.Errorf("csv: duplicate column %q in %s", name, t)
+			}
+			if !isCSVScalar(ft) {
+				return fmt.Errorf("csv: column %q has unsupported type %s", name, f.Type)
+			}
+			seen[name] = true
+			fields = append(fields, csvField{name: name, index: path})
+		}
+		return nil
+	}
+	return fields, walk(t, nil)
+}
+
+func isCSVScalar(t reflect.Type) bool {
+	if t == timeType || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// fieldByIndex walks path, allocating nil embedded pointers when alloc is set.
+// It returns an invalid Value when a nil pointer is met and alloc is false.
+func fieldByIndex(v reflect.Value, path []int, alloc bool) reflect.Value {
+	for i, idx := range path {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(idx)
+	}
+	return v
+}
+
+func formatCSVValue(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return "", nil
+		}
+		return t.Format(time.RFC3339), nil
+	}
+	if v.Type().Implements(textMarshalerType) {
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	}
+	return "", fmt.Errorf("unsupported type %s", v.Type())
+}
+
+func parseCSVValue(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Pointer {
+		if s == "" {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		if s == "" {
+			v.Set(reflect.Zero(timeType))
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return fmt.Errorf("want an RFC 3339 time, got %q", s)
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	s = strings.TrimSpace(s)
+	if s == "" && v.Kind() != reflect.String {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("want true or false, got %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("want an integer, got %q", s)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("want a non-negative integer, got %q", s)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("want a number, got %q", s)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// CSVWriter writes T values as CSV rows after a header row
+type CSVWriter[T any] struct {
+	w           *csv.Writer
+	fields      []csvField
+	wroteHeader bool
+}
+
+func NewCSVWriter[T any](w io.Writer) (*CSVWriter[T], error) {
+	fields, err := csvFields(reflect.TypeFor[T]())
+	if err != nil {
+		return nil, err
+	}
+	return &CSVWriter[T]{w: csv.NewWriter(w), fields: fields}, nil
+}
+
+func (w *CSVWriter[T]) Write(item T) error {
+	if !w.wroteHeader {
+		header := make([]string, len(w.fields))
+		for i, f := range w.fields {
+			header[i] = f.name
+		}
+		if err := w.w.Write(header); err != nil {
+			return err
+		}
+		w.wroteHeader = true
+	}
+
+	v := reflect.ValueOf(&item).Elem()
+	row := make([]string, len(w.fields))
+	for i, f := range w.fields {
+		fv := fieldByIndex(v, f.index, false)
+		if !fv.IsValid() {
+			continue // Inside a nil embedded pointer
+		}
+		s, err := formatCSVValue(fv)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", f.name, err)
+		}
+		row[i] = s
+	}
+	return w.w.Write(row)
+}
+
+// Flush writes buffered rows and reports any write error
+func (w *CSVWriter[T]) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// CSVReader decodes rows into T by matching header names to columns.
+// Columns without a matching field are ignored.
+type CSVReader[T any] struct {
+	r       *csv.Reader
+	columns []*csvField // Per CSV column; nil when ignored
+}
+
+func NewCSVReader[T any](r io.Reader) (*CSVReader[T], error) {
+	fields, err := csvFields(reflect.TypeFor[T]())
+	if err != nil {
+		return nil, err
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1 // Ragged rows are reported per row below
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, &RowError{Line: 1, Err: errors.New("missing header row")}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*csvField, len(fields))
+	for i := range fields {
+		byName[strings.ToLower(fields[i].name)] = &fields[i]
+	}
+	columns := make([]*csvField, len(header))
+	for i, name := range header {
+		columns[i] = byName[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\uFEFF")))]
+	}
+	return &CSVReader[T]{r: cr, columns: columns}, nil
+}
+
+// Read returns the next row, or io.EOF. A bad row yields a *RowError
+// (or RowErrors for several bad cells) and reading can continue.
+func (r *CSVReader[T]) Read() (T, error) {
+	var item T
+	record, err := r.r.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return item, &RowError{Line: parseErr.Line, Err: parseErr.Err}
+		}
+		return item, err
+	}
+	line, _ := r.r.FieldPos(0)
+	if len(record) != len(r.columns) {
+		return item, &RowError{Line: line, Err: fmt.Errorf("has %d fields, header has %d", len(record), len(r.columns))}
+	}
+
+	v := reflect.ValueOf(&item).Elem()
+	var errs RowErrors
+	for i, cell := range record {
+		f := r.columns[i]
+		if f == nil {
+			continue
+		}
+		if err := parseCSVValue(fieldByIndex(v, f.index, true), cell); err != nil {
+			errs = append(errs, &RowError{Line: line, Column: f.name, Err: err})
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return item, nil
+	case 1:
+		return item, errs[0]
+	}
+	return item, errs
+}
+
+// ReadAllCSV imports every valid row and returns the bad ones as RowErrors
+func ReadAllCSV[T any](r io.Reader) ([]T, error) {
+	cr, err := NewCSVReader[T](r)
+	if err != nil {
+		return nil, err
+	}
+	var items []T
+	var errs RowErrors
+	for {
+		item, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *RowError
+		var rowErrs RowErrors
+		switch {
+		case errors.As(err, &rowErrs):
+			errs = append(errs, rowErrs...)
+		case errors.As(err, &rowErr):
+			errs = append(errs, rowErr)
+		case err != nil:
+			return items, err
+		default:
+			items = append(items, item)
+		}
+	}
+	if len(errs) > 0 {
+		return items, errs
+	}
+	return items, nil
+}
+
+// JSONLWriter streams one JSON value per line
+type JSONLWriter[T any] struct {
+	bw  *bufio.Writer
+	enc *json.Encoder
+}
+
+func NewJSONLWriter[T any](w io.Writer) *JSONLWriter[T] {
+	bw := bufio.NewWriter(w)
+	return &JSONLWriter[T]{bw: bw, enc: json.NewEncoder(bw)}
+}
+
+func (w *JSONLWriter[T]) Write(item T) error {
+	return w.enc.Encode(item) // Encode adds the newline
+}
+
+func (w *JSONLWriter[T]) Flush() error {
+	return w.bw.Flush()
+}
+
+// JSONLReader streams values from a JSON Lines file without loading it
+// all into memory. Blank lines are skipped.
+type JSONLReader[T any] struct {
+	br   *bufio.Reader
+	line int
+}
+
+func NewJSONLReader[T any](r io.Reader) *JSONLReader[T] {
+	return &JSONLReader[T]{br: bufio.NewReader(r)}
+}
+
+// Read returns the next value, io.EOF at the end, or a *RowError for a
+// bad line after which reading can continue
+func (r *JSONLReader[T]) Read() (T, error) {
+	var item T
+	for {
+		data, err := r.br.ReadBytes('\n')
+		if len(data) == 0 && err != nil {
+			return item, err
+		}
+		r.line++
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+		if jerr := json.Unmarshal(data, &item); jerr != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(jerr, &typeErr) {
+				return item, &RowError{Line: r.line, Column: typeErr.Field, Err: jerr}
+			}
+			return item, &RowError{Line: r.line, Err: jerr}
+		}
+		return item, nil
+	}
+}
+
+// All yields every record with its error, stopping at the end of input
+func (r *JSONLReader[T]) All() iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for {
+			item, err := r.Read()
+			if err == io.EOF {
+				return
+			}
+			if !yield(item, err) {
+				return
+			}
+			var rowErr *RowError
+			if err != nil && !errors.As(err, &rowErr) {
+				return // I/O errors end the stream
+			}
+		}
+	}
+}
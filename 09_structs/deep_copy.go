@@ -0,0 +1,397 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// The deep tag opts a field out of DeepCopy and DeepEqual:
+//
+//	deep:"-"        left zero by DeepCopy and ignored by DeepEqual
+//	deep:"shallow"  shared by DeepCopy and compared by identity
+//
+// A sync.Mutex or sync.RWMutex is never copied; the copy gets a fresh,
+// unlocked one and DeepEqual ignores it, while the rest of the struct
+// holding it is copied and compared as usual. Tag other lock types
+// deep:"-". Channels and funcs are shared, and so are time.Time's
+// locations.
+
+var (
+	deepMutexType    = reflect.TypeFor[sync.Mutex]()
+	deepRWMutexType  = reflect.TypeFor[sync.RWMutex]()
+	deepLocationType = reflect.TypeFor[*time.Location]()
+)
+
+// deepKey identifies a pointer, map or slice already visited; len keeps
+// two slices of one backing array apart
+type deepKey struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// DeepCopy returns a copy of v that shares no memory with it: pointers,
+// maps and slices are copied all the way down, including through
+// unexported fields. Shared and cyclic references stay shared and
+// cyclic in the copy.
+func DeepCopy[T any](v T) T {
+	src := reflect.ValueOf(&v).Elem()
+	dst := reflect.New(src.Type()).Elem()
+	(&deepCopier{seen: make(map[deepKey]reflect.Value)}).copy(dst, src)
+	return dst.Interface().(T)
+}
+
+type deepCopier struct {
+	seen map[deepKey]reflect.Value
+}
+
+// exposed lets unexported fields be read and set, which reflect
+// otherwise refuses; v must be addressable
+func exposed(v reflect.Value) reflect.Value {
+	if v.CanSet() || !v.CanAddr() {
+		return v
+	}
+	return reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
+}
+
+func isMutex(t reflect.Type) bool {
+	return t == deepMutexType || t == deepRWMutexType
+}
+
+func (c *deepCopier) copy(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Pointer:
+		if src.IsNil() || src.Type() == deepLocationType {
+			dst.Set(src)
+			return
+		}
+		key := deepKey{src.Pointer(), src.Type(), 0}
+		if p, ok := c.seen[key]; ok {
+			dst.Set(p)
+			return
+		}
+		p := reflect.New(src.Type().Elem())
+		c.seen[key] = p
+		c.copy(p.Elem(), src.Elem())
+		dst.Set(p)
+
+	case reflect.Interface:
+		if src.IsNil() {
+			return
+		}
+		elem := src.Elem()
+		// Copy through an addressable temporary so unexported fields
+		// inside the dynamic value can be reached
+		tmp := reflect.New(elem.Type()).Elem()
+		tmp.Set(elem)
+		out := reflect.New(elem.Type()).Elem()
+		c.copy(out, tmp)
+		dst.Set(out)
+
+	case reflect.Struct:
+		if isMutex(src.Type()) {
+			return
+		}
+		t := src.Type()
+		for i := 0; i < t.NumField(); i++ {
+			df, sf := exposed(dst.Field(i)), exposed(src.Field(i))
+			switch t.Field(i).Tag.Get("deep") {
+			case "-":
+			case "shallow":
+				df.Set(sf)
+			default:
+				c.copy(df, sf)
+			}
+		}
+
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		key := deepKey{src.Pointer(), src.Type(), src.Len()}
+		if s, ok := c.seen[key]; ok {
+			dst.Set(s)
+			return
+		}
+		s := reflect.MakeSlice(src.Type(), src.Len(), src.Cap())
+		c.seen[key] = s
+		for i := 0; i < src.Len(); i++ {
+			c.copy(s.Index(i), src.Index(i))
+		}
+		dst.Set(s)
+
+	case reflect.Array:
+		for i := 0; i < src.Len(); i++ {
+			c.copy(dst.Index(i), src.Index(i))
+		}
+
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		key := deepKey{src.Pointer(), src.Type(), 0}
+		if m, ok := c.seen[key]; ok {
+			dst.Set(m)
+			return
+		}
+		m := reflect.MakeMapWithSize(src.Type(), src.Len())
+		c.seen[key] = m
+		iter := src.MapRange()
+		for iter.Next() {
+			k := reflect.New(src.Type().Key()).Elem()
+			c.copy(k, deepTemp(iter.Key()))
+			v := reflect.New(src.Type().Elem()).Elem()
+			c.copy(v, deepTemp(iter.Value()))
+			m.SetMapIndex(k, v)
+		}
+		dst.Set(m)
+
+	default:
+		// Scalars, strings, channels, funcs and unsafe pointers
+		dst.Set(src)
+	}
+}
+
+// deepTemp copies a map key or value into an addressable temporary
+func deepTemp(v reflect.Value) reflect.Value {
+	tmp := reflect.New(v.Type()).Elem()
+	tmp.Set(v)
+	return tmp
+}
+
+// Difference is where DeepEqual found two values to differ. Path is Go
+// syntax from the root type, such as Pet.Animal.Vaccinations[0].Vaccine.
+type Difference struct {
+	Path   string
+	A, B   any
+	Reason string
+}
+
+func (d *Difference) String() string {
+	if d.Reason != "" {
+		return fmt.Sprintf("%s: %s", d.Path, d.Reason)
+	}
+	return fmt.Sprintf("%s: %#v != %#v", d.Path, d.A, d.B)
+}
+
+// DeepEqual is reflect.DeepEqual that also says where a and b differ.
+// Types with an Equal method, such as time.Time, are compared with it,
+// and fields tagged deep:"-" are skipped. The Difference is nil when a
+// and b are equal.
+func DeepEqual[T any](a, b T) (bool, *Difference) {
+	va, vb := reflect.ValueOf(&a).Elem(), reflect.ValueOf(&b).Elem()
+	rt := va.Type()
+	for rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	root := rt.Name()
+	if root == "" {
+		root = "value"
+	}
+	d := (&deepComparer{visited: make(map[[2]deepKey]bool)}).compare(va, vb, root)
+	return d == nil, d
+}
+
+type deepComparer struct {
+	visited map[[2]deepKey]bool
+}
+
+func deepValue(v reflect.Value) any {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+	return v.Interface()
+}
+
+func (c *deepComparer) differ(path string, a, b reflect.Value, reason string) *Difference {
+	return &Difference{Path: path, A: deepValue(a), B: deepValue(b), Reason: reason}
+}
+
+// seen records a pair of references, reporting true when it was already
+// being compared further up, which is how cycles end
+func (c *deepComparer) seen(a, b reflect.Value, n int) bool {
+	key := [2]deepKey{{a.Pointer(), a.Type(), n}, {b.Pointer(), a.Type(), n}}
+	if c.visited[key] {
+		return true
+	}
+	c.visited[key] = true
+	return false
+}
+
+func (c *deepComparer) compare(a, b reflect.Value, path string) *Difference {
+	t := a.Type()
+	if m, ok := t.MethodByName("Equal"); ok && m.Type.NumIn() == 2 && m.Type.In(1) == t &&
+		m.Type.NumOut() == 1 && m.Type.Out(0).Kind() == reflect.Bool && a.CanInterface() {
+		if !a.Method(m.Index).Call([]reflect.Value{b})[0].Bool() {
+			return c.differ(path, a, b, "")
+		}
+		return nil
+	}
+
+	switch a.Kind() {
+	case reflect.Pointer:
+		switch {
+		case a.IsNil() && b.IsNil(), a.Pointer() == b.Pointer():
+			return nil
+		case a.IsNil() || b.IsNil():
+			return c.differ(path, a, b, nilness(a)+" vs "+nilness(b))
+		case c.seen(a, b, 0):
+			return nil
+		}
+		return c.compare(a.Elem(), b.Elem(), path)
+
+	case reflect.Interface:
+		switch {
+		case a.IsNil() && b.IsNil():
+			return nil
+		case a.IsNil() || b.IsNil():
+			return c.differ(path, a, b, nilness(a)+" vs "+nilness(b))
+		case a.Elem().Type() != b.Elem().Type():
+			return c.differ(path, a, b, fmt.Sprintf("%s vs %s", a.Elem().Type(), b.Elem().Type()))
+		}
+		return c.compare(deepTemp(a.Elem()), deepTemp(b.Elem()), path)
+
+	case reflect.Struct:
+		if isMutex(t) {
+			return nil
+		}
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			fa, fb := exposed(a.Field(i)), exposed(b.Field(i))
+			p := path + "." + sf.Name
+			switch sf.Tag.Get("deep") {
+			case "-":
+				continue
+			case "shallow":
+				if !shallowEqual(fa, fb) {
+					return c.differ(p, fa, fb, "different references")
+				}
+				continue
+			}
+			if d := c.compare(fa, fb, p); d != nil {
+				return d
+			}
+		}
+		return nil
+
+	case reflect.Slice:
+		switch {
+		case a.IsNil() != b.IsNil():
+			return c.differ(path, a, b, nilness(a)+" vs "+nilness(b))
+		case a.Len() == b.Len() && a.Pointer() == b.Pointer():
+			return nil
+		case a.Len() == b.Len() && c.seen(a, b, a.Len()):
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		for i := 0; i < min(a.Len(), b.Len()); i++ {
+			if d := c.compare(a.Index(i), b.Index(i), fmt.Sprintf("%s[%d]", path, i)); d != nil {
+				return d
+			}
+		}
+		if a.Len() != b.Len() {
+			return c.differ(path, a, b, fmt.Sprintf("length %d vs %d", a.Len(), b.Len()))
+		}
+		return nil
+
+	case reflect.Map:
+		switch {
+		case a.IsNil() != b.IsNil():
+			return c.differ(path, a, b, nilness(a)+" vs "+nilness(b))
+		case a.Pointer() == b.Pointer(), c.seen(a, b, 0):
+			return nil
+		}
+		// Walk a's keys in a stable order so the first difference is
+		// the same on every run
+		keys := a.MapKeys()
+		sortMapKeys(keys)
+		for _, k := range keys {
+			p := fmt.Sprintf("%s[%#v]", path, deepValue(k))
+			vb := b.MapIndex(k)
+			if !vb.IsValid() {
+				return c.differ(p, a.MapIndex(k), vb, "missing from the second value")
+			}
+			if d := c.compare(deepTemp(a.MapIndex(k)), deepTemp(vb), p); d != nil {
+				return d
+			}
+		}
+		if a.Len() != b.Len() {
+			extra := b.MapKeys()
+			sortMapKeys(extra)
+			for _, k := range extra {
+				if !a.MapIndex(k).IsValid() {
+					return c.differ(fmt.Sprintf("%s[%#v]", path, deepValue(k)), a.MapIndex(k), b.MapIndex(k), "missing from the first value")
+				}
+			}
+		}
+		return nil
+
+	case reflect.Func:
+		if a.IsNil() && b.IsNil() {
+			return nil
+		}
+		return c.differ(path, a, b, "funcs are only equal when both are nil")
+
+	case reflect.Chan, reflect.UnsafePointer:
+		if a.Pointer() != b.Pointer() {
+			return c.differ(path, a, b, "different references")
+		}
+		return nil
+	}
+
+	if !scalarEqual(a, b) {
+		return c.differ(path, a, b, "")
+	}
+	return nil
+}
+
+func nilness(v reflect.Value) string {
+	if v.IsNil() {
+		return "nil"
+	}
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Map {
+		return fmt.Sprintf("len %d", v.Len())
+	}
+	return "non-nil"
+}
+
+func shallowEqual(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return a.Pointer() == b.Pointer()
+	case reflect.Slice:
+		return a.Pointer() == b.Pointer() && a.Len() == b.Len()
+	}
+	return a.Equal(b)
+}
+
+func scalarEqual(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() == b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() == b.Float()
+	case reflect.Complex64, reflect.Complex128:
+		return a.Complex() == b.Complex()
+	case reflect.String:
+		return a.String() == b.String()
+	}
+	return false
+}
+
+// sortMapKeys orders keys by their Go syntax so walks are repeatable
+func sortMapKeys(keys []reflect.Value) {
+	slices.SortFunc(keys, func(x, y reflect.Value) int {
+		return strings.Compare(fmt.Sprintf("%#v", deepValue(x)), fmt.Sprintf("%#v", deepValue(y)))
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+// guarded embeds a mutex, which gives it Lock and Unlock methods
+type guarded struct {
+	sync.Mutex
+	N    int
+	Tags map[string]int
+	rw   sync.RWMutex
+}
+
+func TestDeepCopySkipsOnlyTheMutex(t *testing.T) {
+	g := &guarded{N: 1, Tags: map[string]int{"a": 1}}
+	g.Lock()
+	g.rw.RLock()
+	c := DeepCopy(g)
+
+	if c.N != 1 || c.Tags["a"] != 1 {
+		t.Fatalf("copy lost its fields: N=%d Tags=%v", c.N, c.Tags)
+	}
+	c.Tags["a"] = 2
+	if g.Tags["a"] != 1 {
+		t.Error("copy shares its map with the original")
+	}
+	if !c.TryLock() || !c.rw.TryLock() {
+		t.Error("copy's mutexes are still locked")
+	}
+}
+
+func TestDeepEqualComparesStructsHoldingMutexes(t *testing.T) {
+	a := &guarded{N: 1}
+	b := &guarded{N: 2}
+	a.Lock()
+	equal, diff := DeepEqual(a, b)
+	if equal || diff == nil || diff.Path != "guarded.N" {
+		t.Errorf("DeepEqual = %v, %v; want a difference at guarded.N", equal, diff)
+	}
+	b.N = 1
+	if equal, diff := DeepEqual(a, b); !equal {
+		t.Errorf("only the lock state differs, got %v", diff)
+	}
+}
+
+func TestDeepCopyPet(t *testing.T) {
+	buddy := Pet{
+		Animal: &Animal{Name: "Buddy", Species: "Dog", Vaccinations: []Vaccination{{Vaccine: "Rabies"}}},
+		Owner:  "Alice",
+	}
+	c := DeepCopy(buddy)
+	if c.Animal == buddy.Animal || &c.Vaccinations[0] == &buddy.Vaccinations[0] {
+		t.Fatal("copy shares the embedded Animal or its vaccinations")
+	}
+	if equal, diff := DeepEqual(buddy, c); !equal {
+		t.Errorf("fresh copy differs: %v", diff)
+	}
+	buddy.Name = "Bud"
+	buddy.Vaccinations[0].Vaccine = "Distemper"
+	if c.Name != "Buddy" || c.Vaccinations[0].Vaccine != "Rabies" {
+		t.Errorf("changing the original changed the copy: %+v", *c.Animal)
+	}
+}
+
+type deepNode struct {
+	Value int
+	next  *deepNode
+}
+
+func TestDeepCopyKeepsCycles(t *testing.T) {
+	ring := &deepNode{Value: 1}
+	ring.next = &deepNode{Value: 2, next: ring}
+	c := DeepCopy(ring)
+	if c == ring || c.next == ring.next {
+		t.Fatal("copy shares nodes with the original")
+	}
+	if c.next.next != c || c.next.Value != 2 {
+		t.Errorf("copy is not the same two-node ring")
+	}
+	if equal, diff := DeepEqual(ring, c); !equal {
+		t.Errorf("ring and its copy differ: %v", diff)
+	}
+	c.next.Value = 3
+	if _, diff := DeepEqual(ring, c); diff == nil || diff.Path != "deepNode.next.Value" {
+		t.Errorf("difference = %v, want one at deepNode.next.Value", diff)
+	}
+}
+
+type deepShared struct {
+	A, B   *int
+	M1, M2 map[string]int
+	S1, S2 []int
+	secret *string
+	items  []int
+}
+
+func TestDeepCopySharedAndUnexported(t *testing.T) {
+	n, secret := 1, "hunter2"
+	m, s := map[string]int{"a": 1}, []int{1, 2, 3}
+	orig := deepShared{A: &n, B: &n, M1: m, M2: m, S1: s, S2: s, secret: &secret, items: []int{4, 5}}
+	c := DeepCopy(orig)
+
+	if c.A != c.B || c.A == orig.A {
+		t.Error("pointers shared in the original should be shared in the copy only")
+	}
+	c.M1["b"] = 2
+	if c.M2["b"] != 2 || m["b"] != 0 {
+		t.Error("maps shared in the original should be shared in the copy only")
+	}
+	c.S1[0] = 9
+	if c.S2[0] != 9 || s[0] != 1 {
+		t.Error("slices shared in the original should be shared in the copy only")
+	}
+
+	if c.secret == orig.secret || *c.secret != "hunter2" {
+		t.Errorf("unexported pointer not copied: %p %v", c.secret, c.secret)
+	}
+	c.items[0] = 0
+	if orig.items[0] != 4 || len(c.items) != 2 {
+		t.Errorf("unexported slice not copied: %v", orig.items)
+	}
+}
+
+type deepTagged struct {
+	Name   string
+	Cache  map[string]int `deep:"-"`
+	Parent *Animal        `deep:"shallow"`
+}
+
+func TestDeepTags(t *testing.T) {
+	parent := &Animal{Name: "Rex"}
+	orig := deepTagged{Name: "Pup", Cache: map[string]int{"hits": 3}, Parent: parent}
+	c := DeepCopy(orig)
+	if c.Cache != nil {
+		t.Errorf(`deep:"-" field copied: %v`, c.Cache)
+	}
+	if c.Parent != parent {
+		t.Error(`deep:"shallow" field was copied instead of shared`)
+	}
+	if equal, diff := DeepEqual(orig, c); !equal {
+		t.Errorf(`deep:"-" field compared: %v`, diff)
+	}
+
+	c.Parent = &Animal{Name: "Rex"}
+	_, diff := DeepEqual(orig, c)
+	if diff == nil || diff.Path != "deepTagged.Parent" || diff.Reason != "different references" {
+		t.Errorf(`deep:"shallow" difference = %v, want different references at deepTagged.Parent`, diff)
+	}
+}
+
+type deepScores struct {
+	Scores map[string][]int
+}
+
+func TestDeepEqualPaths(t *testing.T) {
+	pet := func(vaccines ...string) Pet {
+		a := &Animal{Name: "Buddy"}
+		for _, v := range vaccines {
+			a.Vaccinations = append(a.Vaccinations, Vaccination{Vaccine: v})
+		}
+		return Pet{Animal: a, Owner: "Alice"}
+	}
+	tests := []struct {
+		name       string
+		diff       func() *Difference
+		path, want string
+	}{
+		{"nested slice", func() *Difference {
+			_, d := DeepEqual(pet("Rabies"), pet("Distemper"))
+			return d
+		}, "Pet.Animal.Vaccinations[0].Vaccine", `Pet.Animal.Vaccinations[0].Vaccine: "Rabies" != "Distemper"`},
+		{"slice length", func() *Difference {
+			_, d := DeepEqual(pet("Rabies"), pet("Rabies", "Distemper"))
+			return d
+		}, "Pet.Animal.Vaccinations", "Pet.Animal.Vaccinations: length 1 vs 2"},
+		{"map value", func() *Difference {
+			_, d := DeepEqual(deepScores{map[string][]int{"a": {1}, "b": {1, 2}}}, deepScores{map[string][]int{"a": {1}, "b": {1, 3}}})
+			return d
+		}, `deepScores.Scores["b"][1]`, `deepScores.Scores["b"][1]: 2 != 3`},
+		{"missing key", func() *Difference {
+			_, d := DeepEqual(deepScores{map[string][]int{"a": nil}}, deepScores{map[string][]int{"a": nil, "c": nil}})
+			return d
+		}, `deepScores.Scores["c"]`, `deepScores.Scores["c"]: missing from the first value`},
+		{"nil pointer", func() *Difference {
+			_, d := DeepEqual(Pet{Owner: "Alice"}, pet())
+			return d
+		}, "Pet.Animal", "Pet.Animal: nil vs non-nil"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := tt.diff()
+			if d == nil {
+				t.Fatal("DeepEqual found no difference")
+			}
+			if d.Path != tt.path || d.String() != tt.want {
+				t.Errorf("difference = %q at %s, want %q", d, d.Path, tt.want)
+			}
+		})
+	}
+}
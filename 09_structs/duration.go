@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidDuration = errors.New("invalid duration")
+	ErrDurationRange   = errors.New("duration out of range")
+)
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+)
+
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"µs": time.Microsecond,
+	"μs": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  day,
+	"w":  week,
+}
+
+// ParseExtendedDuration accepts everything time.ParseDuration does plus
+// "d" and "w" units ("7d", "2w3d12h") and ISO 8601 durations ("P1DT2H").
+// ISO years and months are rejected because their length varies.
+func ParseExtendedDuration(s string) (time.Duration, error) {
+	orig := s
+	s = strings.TrimSpace(s)
+
+	neg := false
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+	if s == "" {
+		return 0, fmt.Errorf("%w: %q is empty", ErrInvalidDuration, orig)
+	}
+
+	var total uint64
+	var err error
+	switch {
+	case s[0] == 'P' || s[0] == 'p':
+		total, err = parseISODuration(s[1:])
+	case s == "0":
+		total = 0
+	default:
+		total, err = parseUnitDuration(s)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("duration %q: %w", orig, err)
+	}
+
+	if neg {
+		return -time.Duration(total), nil
+	}
+	return time.Duration(total), nil
+}
+
+// parseUnitDuration parses a sequence like "1w2d3.5h"
+func parseUnitDuration(s string) (uint64, error) {
+	var total uint64
+	for s != "" {
+		i := 0
+		for i < len(s) && (s[i] == '.' || ('0' <= s[i] && s[i] <= '9')) {
+			i++
+		}
+		number := s[:i]
+		s = s[i:]
+
+		j := 0
+		for j < len(s) && s[j] != '.' && (s[j] < '0' || s[j] > '9') {
+			j++
+		}
+		unitName := s[:j]
+		s = s[j:]
+
+		if number == "" {
+			return 0, fmt.Errorf("%w: expected a number before %q", ErrInvalidDuration, unitName)
+		}
+		unit, ok := durationUnits[unitName]
+		if !ok {
+			if unitName == "" {
+				return 0, fmt.Errorf("%w: missing unit after %s", ErrInvalidDuration, number)
+			}
+			return 0, fmt.Errorf("%w: unknown unit %q", ErrInvalidDuration, unitName)
+		}
+
+		var err error
+		if total, err = addDurationComponent(total, number, unit); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// parseISODuration parses what follows the "P" of an ISO 8601 duration
+func parseISODuration(s string) (uint64, error) {
+	if s == "" || s == "T" || strings.HasSuffix(s, "T") {
+		return 0, fmt.Errorf("%w: ISO 8601 duration has no components", ErrInvalidDuration)
+	}
+
+	datePart, timePart, hasTime := strings.Cut(strings.ToUpper(s), "T")
+	var total uint64
+	var err error
+
+	parts := []struct {
+		text   string
+		order  string
+		units  map[byte]time.Duration
+		months bool
+	}{
+		{datePart, "YMWD", map[byte]time.Duration{'W': week, 'D': day}, true},
+		{timePart, "HMS", map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}, false},
+	}
+	for _, part := range parts {
+		if part.text == "" {
+			continue
+		}
+		rest := part.text
+		pos := 0 // Components must appear in order, each at most once
+		for rest != "" {
+			i := 0
+			for i < len(rest) && (rest[i] == '.' || rest[i] == ',' || ('0' <= rest[i] && rest[i] <= '9')) {
+				i++
+			}
+			if i == 0 || i == len(rest) {
+				return 0, fmt.Errorf("%w: malformed ISO 8601 component %q", ErrInvalidDuration, rest)
+			}
+			number := strings.ReplaceAll(rest[:i], ",", ".")
+			designator := rest[i]
+			rest = rest[i+1:]
+
+			idx := strings.IndexByte(part.order[pos:], designator)
+			if idx < 0 {
+				return 0, fmt.Errorf("%w: unexpected ISO 8601 designator %q", ErrInvalidDuration, designator)
+			}
+			pos += idx + 1
+
+			unit, ok := part.units[designator]
+			if !ok && part.months {
+				return 0, fmt.Errorf("%w: ISO 8601 years and months have no fixed length", ErrInvalidDuration)
+			}
+			if total, err = addDurationComponent(total, number, unit); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if hasTime && timePart == "" {
+		return 0, fmt.Errorf("%w: empty ISO 8601 time part", ErrInvalidDuration)
+	}
+	return total, nil
+}
+
+// addDurationComponent adds number*unit to total, where number may have
+// a fraction, and rejects results that do not fit in a time.Duration
+func addDurationComponent(total uint64, number string, unit time.Duration) (uint64, error) {
+	whole, frac, _ := strings.Cut(number, ".")
+	if whole == "" && frac == "" || strings.Contains(frac, ".") {
+		return 0, fmt.Errorf("%w: bad number %q", ErrInvalidDuration, number)
+	}
+
+	const max = uint64(math.MaxInt64)
+	var w uint64
+	if whole != "" {
+		var err error
+		w, err = strconv.ParseUint(whole, 10, 64)
+		if err != nil || w > max/uint64(unit) {
+			return 0, fmt.Errorf("%w: %s exceeds %s", ErrDurationRange, number, FormatExtendedDuration(math.MaxInt64))
+		}
+	}
+	v := w * uint64(unit)
+
+	if frac != "" {
+		if len(frac) > 18 {
+			frac = frac[:18] // Beyond nanosecond precision for every unit
+		}
+		f, err := strconv.ParseUint(frac, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: bad number %q", ErrInvalidDuration, number)
+		}
+		v += uint64(float64(f) * float64(unit) / math.Pow10(len(frac)))
+	}
+
+	if v > max-total {
+		return 0, fmt.Errorf("%w: total exceeds %s", ErrDurationRange, FormatExtendedDuration(math.MaxInt64))
+	}
+	return total + v, nil
+}
+
+// FormatExtendedDuration is the inverse of ParseExtendedDuration, using
+// weeks and days where possible: 26h is "1d2h", 336h is "2w"
+func FormatExtendedDuration(d time.Duration) string {
+	if d == 0 {
+		return "0s"
+	}
+	var sb strings.Builder
+	u := uint64(d)
+	if d < 0 {
+		sb.WriteByte('-')
+		u = -u
+	}
+
+	for _, unit := range []struct {
+		size time.Duration
+		name string
+	}{{week, "w"}, {day, "d"}, {time.Hour, "h"}, {time.Minute, "m"}} {
+		if n := u / uint64(unit.size); n > 0 {
+			fmt.Fprintf(&sb, "%d%s", n, unit.name)
+			u %= uint64(unit.size)
+		}
+	}
+
+	rest := time.Duration(u)
+	switch {
+	case rest == 0:
+	case rest < time.Second && sb.Len() <= 1:
+		sb.WriteString(rest.String()) // "1.5ms" reads better than "0.0015s"
+	default:
+		sb.WriteString(strconv.FormatFloat(rest.Seconds(), 'f', -1, 64) + "s")
+	}
+	return sb.String()
+}
+
+// FormatISODuration renders d as an ISO 8601 duration such as "P1DT2H"
+func FormatISODuration(d time.Duration) string {
+	if d == 0 {
+		return "PT0S"
+	}
+	var sb strings.Builder
+	u := uint64(d)
+	if d < 0 {
+		sb.WriteByte('-')
+		u = -u
+	}
+	sb.WriteByte('P')
+	if days := u / uint64(day); days > 0 {
+		fmt.Fprintf(&sb, "%dD", days)
+		u %= uint64(day)
+	}
+	if u == 0 {
+		return sb.String()
+	}
+	sb.WriteByte('T')
+	if h := u / uint64(time.Hour); h > 0 {
+		fmt.Fprintf(&sb, "%dH", h)
+		u %= uint64(time.Hour)
+	}
+	if m := u / uint64(time.Minute); m > 0 {
+		fmt.Fprintf(&sb, "%dM", m)
+		u %= uint64(time.Minute)
+	}
+	if u > 0 {
+		sb.WriteString(strconv.FormatFloat(time.Duration(u).Seconds(), 'f', -1, 64) + "S")
+	}
+	return sb.String()
+}
+
+// DurationRange bounds a configured duration. With Clamp set, values
+// outside the range are moved to the nearest bound instead of rejected.
+type DurationRange struct {
+	Min, Max time.Duration
+	Clamp    bool
+}
+
+func (r DurationRange) Apply(d time.Duration) (time.Duration, error) {
+	switch {
+	case d < r.Min && r.Clamp:
+		return r.Min, nil
+	case d > r.Max && r.Clamp:
+		return r.Max, nil
+	case d < r.Min || d > r.Max:
+		return d, fmt.Errorf("%w: %s is not between %s and %s", ErrDurationRange,
+			FormatExtendedDuration(d), FormatExtendedDuration(r.Min), FormatExtendedDuration(r.Max))
+	}
+	return d, nil
+}
+
+// DurationFromEnv reads key from the environment, falling back to def when unset
+func DurationFromEnv(key string, def Duration) (Duration, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return def, nil
+	}
+	var d Duration
+	if err := d.UnmarshalText([]byte(value)); err != nil {
+		return def, fmt.Errorf("%s: %w", key, err)
+	}
+	return d, nil
+}
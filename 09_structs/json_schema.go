@@ -0,0 +1,702 @@
+package main
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema is the subset of JSON Schema 2020-12 that the generator
+// emits and the validator checks. A boolean schema (true or false) is
+// stored in Always.
+type JSONSchema struct {
+	Schema      string                 `json:"$schema,omitempty"`
+	Ref         string                 `json:"$ref,omitempty"`
+	Defs        map[string]*JSONSchema `json:"$defs,omitempty"`
+	Title       string                 `json:"title,omitempty"`
+	Description string                 `json:"description,omitempty"`
+
+	Type   schemaTypes `json:"type,omitempty"`
+	Enum   []any       `json:"enum,omitempty"`
+	Const  any         `json:"const,omitempty"`
+	Format string      `json:"format,omitempty"`
+
+	Minimum          *float64 `json:"minimum,omitempty"`
+	Maximum          *float64 `json:"maximum,omitempty"`
+	ExclusiveMinimum *float64 `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum *float64 `json:"exclusiveMaximum,omitempty"`
+
+	MinLength       *int   `json:"minLength,omitempty"`
+	MaxLength       *int   `json:"maxLength,omitempty"`
+	Pattern         string `json:"pattern,omitempty"`
+	ContentEncoding string `json:"contentEncoding,omitempty"`
+
+	Items    *JSONSchema `json:"items,omitempty"`
+	MinItems *int        `json:"minItems,omitempty"`
+	MaxItems *int        `json:"maxItems,omitempty"`
+
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+	MinProperties        *int                   `json:"minProperties,omitempty"`
+	MaxProperties        *int                   `json:"maxProperties,omitempty"`
+
+	AnyOf []*JSONSchema `json:"anyOf,omitempty"`
+	Not   *JSONSchema   `json:"not,omitempty"`
+
+	Always *bool `json:"-"`
+}
+
+// schemaTypes is "type", written as a string when there is only one
+type schemaTypes []string
+
+func (t schemaTypes) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (t *schemaTypes) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*t = schemaTypes{one}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(t))
+}
+
+type jsonSchemaFields JSONSchema // Without the methods, to avoid recursion
+
+func (s *JSONSchema) MarshalJSON() ([]byte, error) {
+	if s.Always != nil {
+		return json.Marshal(*s.Always)
+	}
+	return json.Marshal((*jsonSchemaFields)(s))
+}
+
+func (s *JSONSchema) UnmarshalJSON(b []byte) error {
+	var always bool
+	if err := json.Unmarshal(b, &always); err == nil {
+		*s = JSONSchema{Always: &always}
+		return nil
+	}
+	return json.Unmarshal(b, (*jsonSchemaFields)(s))
+}
+
+func (s *JSONSchema) String() string {
+	b, _ := json.MarshalIndent(s, "", "  ")
+	return string(b)
+}
+
+// jsonSchemaProvider lets a type describe its own JSON form, for types
+// whose MarshalJSON the generator cannot see through
+type jsonSchemaProvider interface {
+	JSONSchema() *JSONSchema
+}
+
+// JSONSchema describes what Duration.UnmarshalJSON accepts: a duration
+// string or a number of nanoseconds
+func (Duration) JSONSchema() *JSONSchema {
+	return &JSONSchema{
+		Type:        schemaTypes{"string", "integer"},
+		Description: `duration such as "1h30m", "7d" or "P1DT2H", or nanoseconds`,
+	}
+}
+
+// GenerateJSONSchema describes how encoding/json writes a T. Members use
+// json names, members without omitempty or omitzero are required, and
+// validate tags (required, min, max, oneof) become constraints. Other
+// named structs go in $defs, so recursive types work.
+func GenerateJSONSchema[T any]() (*JSONSchema, error) {
+	return JSONSchemaFor(reflect.TypeFor[T]())
+}
+
+func JSONSchemaFor(t reflect.Type) (*JSONSchema, error) {
+	g := &schemaGenerator{defs: make(map[string]*JSONSchema), names: make(map[reflect.Type]string)}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var root *JSONSchema
+	var err error
+	if t.Kind() == reflect.Struct && !isSchemaLeaf(t) {
+		g.names[t] = "#" // References to the root type point at the document itself
+		root, err = g.object(t)
+	} else {
+		root, err = g.schema(t)
+	}
+	if err != nil {
+		return nil, err
+	}
+	root.Schema = jsonSchemaDialect
+	root.Title = t.Name()
+	if len(g.defs) > 0 {
+		root.Defs = g.defs
+	}
+	return root, nil
+}
+
+type schemaGenerator struct {
+	defs  map[string]*JSONSchema
+	names map[reflect.Type]string // $ref of each struct type seen so far
+}
+
+var (
+	schemaTimeType  = reflect.TypeFor[time.Time]()
+	schemaJSONType  = reflect.TypeFor[json.Marshaler]()
+	schemaTextType  = reflect.TypeFor[encoding.TextMarshaler]()
+	schemaProviders = reflect.TypeFor[jsonSchemaProvider]()
+)
+
+// isSchemaLeaf reports whether t encodes through a marshaler rather than
+// its fields
+func isSchemaLeaf(t reflect.Type) bool {
+	for _, i := range []reflect.Type{schemaProviders, schemaJSONType, schemaTextType} {
+		if t.Implements(i) || reflect.PointerTo(t).Implements(i) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) (*JSONSchema, error) {
+	if t.Implements(schemaProviders) {
+		return reflect.Zero(t).Interface().(jsonSchemaProvider).JSONSchema(), nil
+	}
+	switch {
+	case t == schemaTimeType:
+		return &JSONSchema{Type: schemaTypes{"string"}, Format: "date-time"}, nil
+	case t.Implements(schemaJSONType) || reflect.PointerTo(t).Implements(schemaJSONType):
+		return &JSONSchema{}, nil // Anything: the generator cannot know
+	case t.Implements(schemaTextType) || reflect.PointerTo(t).Implements(schemaTextType):
+		return &JSONSchema{Type: schemaTypes{"string"}}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &JSONSchema{Type: schemaTypes{"boolean"}}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		lo, hi := float64(int64(-1)<<(t.Bits()-1)), float64(uint64(1)<<(t.Bits()-1)-1)
+		if t.Bits() == 64 {
+			return &JSONSchema{Type: schemaTypes{"integer"}}, nil // Beyond float64 precision anyway
+		}
+		return &JSONSchema{Type: schemaTypes{"integer"}, Minimum: &lo, Maximum: &hi}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		lo := 0.0
+		s := &JSONSchema{Type: schemaTypes{"integer"}, Minimum: &lo}
+		if t.Bits() < 64 {
+			hi := float64(uint64(1)<<t.Bits() - 1)
+			s.Maximum = &hi
+		}
+		return s, nil
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: schemaTypes{"number"}}, nil
+	case reflect.String:
+		return &JSONSchema{Type: schemaTypes{"string"}}, nil
+	case reflect.Interface:
+		return &JSONSchema{}, nil
+
+	case reflect.Pointer:
+		elem, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return nullable(elem), nil
+
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return nullable(&JSONSchema{Type: schemaTypes{"string"}, ContentEncoding: "base64"}), nil
+		}
+		items, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		s := &JSONSchema{Type: schemaTypes{"array"}, Items: items}
+		if t.Kind() == reflect.Array {
+			n := t.Len()
+			s.MinItems, s.MaxItems = &n, &n
+			return s, nil
+		}
+		return nullable(s), nil // A nil slice encodes as null
+
+	case reflect.Map:
+		switch t.Key().Kind() {
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			if !t.Key().Implements(schemaTextType) {
+				return nil, fmt.Errorf("json schema: unsupported map key type %s", t.Key())
+			}
+		}
+		values, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return nullable(&JSONSchema{Type: schemaTypes{"object"}, AdditionalProperties: values}), nil
+
+	case reflect.Struct:
+		if ref, ok := g.names[t]; ok {
+			return &JSONSchema{Ref: ref}, nil
+		}
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := t.Name()
+		for i := 2; g.defs[name] != nil; i++ {
+			name = t.Name() + strconv.Itoa(i) // Same name from another package
+		}
+		g.names[t] = "#/$defs/" + name
+		g.defs[name] = &JSONSchema{} // Reserved while the fields are generated
+		obj, err := g.object(t)
+		if err != nil {
+			return nil, err
+		}
+		g.defs[name] = obj
+		return &JSONSchema{Ref: g.names[t]}, nil
+	}
+	return nil, fmt.Errorf("json schema: unsupported type %s", t)
+}
+
+// nullable lets s also match null
+func nullable(s *JSONSchema) *JSONSchema {
+	if len(s.Type) == 0 {
+		if s.Ref == "" {
+			return s // Already matches anything
+		}
+		return &JSONSchema{AnyOf: []*JSONSchema{s, {Type: schemaTypes{"null"}}}}
+	}
+	if !slices.Contains(s.Type, "null") {
+		s.Type = append(s.Type, "null")
+	}
+	return s
+}
+
+func notNull(s *JSONSchema) {
+	s.Type = slices.DeleteFunc(s.Type, func(t string) bool { return t == "null" })
+	if len(s.AnyOf) == 2 && slices.Equal(s.AnyOf[1].Type, schemaTypes{"null"}) {
+		*s = *s.AnyOf[0]
+	}
+}
+
+func (g *schemaGenerator) object(t reflect.Type) (*JSONSchema, error) {
+	obj := &JSONSchema{
+		Type:                 schemaTypes{"object"},
+		Properties:           make(map[string]*JSONSchema),
+		AdditionalProperties: &JSONSchema{Always: new(bool)},
+	}
+	for _, f := range patchFields(t) {
+		sf := t.FieldByIndex(f.index)
+		prop, err := g.schema(sf.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", t, sf.Name, err)
+		}
+		if prop.Ref != "" {
+			prop = &JSONSchema{AnyOf: []*JSONSchema{prop}} // Leave the shared definition alone
+		}
+		required := !f.omitEmpty && !f.omitZero
+		rules, err := applyValidateTag(prop, sf)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", t, sf.Name, err)
+		}
+		if len(prop.AnyOf) == 1 && !rules {
+			prop = prop.AnyOf[0]
+		}
+		if required || slices.Contains(strings.Split(sf.Tag.Get("validate"), ","), "required") {
+			obj.Required = append(obj.Required, f.name)
+		}
+		obj.Properties[f.name] = prop
+	}
+	return obj, nil
+}
+
+// applyValidateTag adds the constraints of the field's validate tag to s
+// and reports whether there were any
+func applyValidateTag(s *JSONSchema, sf reflect.StructField) (bool, error) {
+	tag := sf.Tag.Get("validate")
+	if tag == "" {
+		return false, nil
+	}
+	t := sf.Type
+	for _, part := range strings.Split(tag, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(part, "=")
+		switch name {
+		case "required":
+			// The zero value counts as missing, as in validateComputer
+			notNull(s)
+			switch {
+			case t == schemaTimeType:
+				s.Not = &JSONSchema{Const: time.Time{}.Format(time.RFC3339)}
+			case t.Kind() == reflect.String:
+				if s.MinLength == nil {
+					one := 1
+					s.MinLength = &one
+				}
+			case t.Kind() == reflect.Slice || t.Kind() == reflect.Map:
+				one := 1
+				if t.Kind() == reflect.Map {
+					s.MinProperties = &one
+				} else {
+					s.MinItems = &one
+				}
+			case slices.Contains(s.Type, "integer") || slices.Contains(s.Type, "number"):
+				s.Not = &JSONSchema{Const: 0}
+			case t.Kind() == reflect.Bool:
+				return false, fmt.Errorf("required is not supported for %s", t)
+			}
+
+		case "min", "max":
+			if err := applyBound(s, t, name == "min", arg); err != nil {
+				return false, fmt.Errorf("%s=%s: %w", name, arg, err)
+			}
+
+		case "oneof":
+			if t.Kind() != reflect.String {
+				return false, fmt.Errorf("oneof is only supported for strings")
+			}
+			for _, o := range strings.Fields(arg) {
+				s.Enum = append(s.Enum, o)
+			}
+
+		default:
+			return false, fmt.Errorf("unknown rule %q", name)
+		}
+	}
+	return true, nil
+}
+
+// applyBound turns min or max into a length, item count or value bound
+// depending on the kind of t
+func applyBound(s *JSONSchema, t reflect.Type, isMin bool, arg string) error {
+	switch t.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			return errors.New("want a length")
+		}
+		target := map[reflect.Kind][2]**int{
+			reflect.String: {&s.MinLength, &s.MaxLength},
+			reflect.Slice:  {&s.MinItems, &s.MaxItems},
+			reflect.Array:  {&s.MinItems, &s.MaxItems},
+			reflect.Map:    {&s.MinProperties, &s.MaxProperties},
+		}[t.Kind()]
+		if isMin {
+			*target[0] = &n
+		} else {
+			*target[1] = &n
+		}
+		return nil
+	}
+	if !slices.Contains(s.Type, "integer") && !slices.Contains(s.Type, "number") {
+		return fmt.Errorf("not supported for %s", t)
+	}
+
+	var f float64
+	if t == reflect.TypeFor[time.Duration]() {
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return err
+		}
+		f = float64(d)
+	} else {
+		var err error
+		if f, err = strconv.ParseFloat(arg, 64); err != nil {
+			return errors.New("want a number")
+		}
+	}
+	if isMin {
+		s.Minimum = &f
+	} else {
+		s.Maximum = &f
+	}
+	return nil
+}
+
+// Validate checks a JSON document against s. Every violation is
+// reported as a *ValidationError whose Field is a JSON Pointer, such as
+// /items/0/ram, and an empty pointer means the whole document.
+func (s *JSONSchema) Validate(doc []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("json schema: %w", err)
+	}
+	if dec.More() {
+		return errors.New("json schema: trailing data after document")
+	}
+	var errs ValidationErrors
+	(&schemaValidator{root: s, patterns: make(map[string]*regexp.Regexp)}).check(s, v, "", &errs)
+	return errs.Err()
+}
+
+type schemaValidator struct {
+	root     *JSONSchema
+	patterns map[string]*regexp.Regexp
+}
+
+func (sv *schemaValidator) check(s *JSONSchema, v any, path string, errs *ValidationErrors) {
+	if s.Always != nil {
+		if !*s.Always {
+			errs.Add(path, "is not allowed")
+		}
+		return
+	}
+	if s.Ref != "" {
+		target, err := sv.resolve(s.Ref)
+		if err != nil {
+			errs.Add(path, err.Error())
+			return
+		}
+		sv.check(target, v, path, errs)
+	}
+
+	if len(s.Type) > 0 && !slices.ContainsFunc(s.Type, func(t string) bool { return schemaTypeMatches(t, v) }) {
+		errs.Add(path, fmt.Sprintf("must be %s, not %s", strings.Join(s.Type, " or "), schemaTypeOf(v)))
+		return // The remaining keywords would only repeat the mismatch
+	}
+	if s.Enum != nil && !slices.ContainsFunc(s.Enum, func(e any) bool { return jsonValuesEqual(e, v) }) {
+		errs.Add(path, fmt.Sprintf("must be one of %s", compactJSON(s.Enum)))
+	}
+	if s.Const != nil && !jsonValuesEqual(s.Const, v) {
+		errs.Add(path, fmt.Sprintf("must be %s", compactJSON(s.Const)))
+	}
+	if s.Not != nil {
+		var inner ValidationErrors
+		sv.check(s.Not, v, path, &inner)
+		if len(inner) == 0 {
+			errs.Add(path, fmt.Sprintf("must not match %s", compactJSON(s.Not)))
+		}
+	}
+	if len(s.AnyOf) > 0 {
+		var firstErrs ValidationErrors
+		matched := false
+		for i, alt := range s.AnyOf {
+			var inner ValidationErrors
+			if sv.check(alt, v, path, &inner); len(inner) == 0 {
+				matched = true
+				break
+			} else if i == 0 {
+				firstErrs = inner
+			}
+		}
+		if !matched {
+			*errs = append(*errs, firstErrs...) // The first alternative is the intended one
+		}
+	}
+
+	switch x := v.(type) {
+	case json.Number:
+		sv.checkNumber(s, x, path, errs)
+	case string:
+		sv.checkString(s, x, path, errs)
+	case []any:
+		if s.MinItems != nil && len(x) < *s.MinItems {
+			errs.Add(path, fmt.Sprintf("must have at least %d items", *s.MinItems))
+		}
+		if s.MaxItems != nil && len(x) > *s.MaxItems {
+			errs.Add(path, fmt.Sprintf("must have at most %d items", *s.MaxItems))
+		}
+		if s.Items != nil {
+			for i, item := range x {
+				sv.check(s.Items, item, path+"/"+strconv.Itoa(i), errs)
+			}
+		}
+	case map[string]any:
+		sv.checkObject(s, x, path, errs)
+	}
+}
+
+func (sv *schemaValidator) checkNumber(s *JSONSchema, n json.Number, path string, errs *ValidationErrors) {
+	f, err := n.Float64()
+	if err != nil {
+		errs.Add(path, fmt.Sprintf("number %s is out of range", n))
+		return
+	}
+	if s.Minimum != nil && f < *s.Minimum {
+		errs.Add(path, "must be at least "+formatSchemaNumber(*s.Minimum))
+	}
+	if s.Maximum != nil && f > *s.Maximum {
+		errs.Add(path, "must be at most "+formatSchemaNumber(*s.Maximum))
+	}
+	if s.ExclusiveMinimum != nil && f <= *s.ExclusiveMinimum {
+		errs.Add(path, "must be greater than "+formatSchemaNumber(*s.ExclusiveMinimum))
+	}
+	if s.ExclusiveMaximum != nil && f >= *s.ExclusiveMaximum {
+		errs.Add(path, "must be less than "+formatSchemaNumber(*s.ExclusiveMaximum))
+	}
+}
+
+func (sv *schemaValidator) checkString(s *JSONSchema, str, path string, errs *ValidationErrors) {
+	n := utf8.RuneCountInString(str)
+	if s.MinLength != nil && n < *s.MinLength {
+		if *s.MinLength == 1 {
+			errs.Add(path, "must not be empty")
+		} else {
+			errs.Add(path, fmt.Sprintf("must be at least %d characters", *s.MinLength))
+		}
+	}
+	if s.MaxLength != nil && n > *s.MaxLength {
+		errs.Add(path, fmt.Sprintf("must be at most %d characters", *s.MaxLength))
+	}
+	if s.Pattern != "" {
+		re, ok := sv.patterns[s.Pattern]
+		if !ok {
+			var err error
+			if re, err = regexp.Compile(s.Pattern); err != nil {
+				errs.Add(path, fmt.Sprintf("schema pattern %q: %v", s.Pattern, err))
+				return
+			}
+			sv.patterns[s.Pattern] = re
+		}
+		if !re.MatchString(str) {
+			errs.Add(path, fmt.Sprintf("must match %s", s.Pattern))
+		}
+	}
+	switch s.Format {
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, str); err != nil {
+			errs.Add(path, "must be an RFC 3339 date-time")
+		}
+	case "date":
+		if _, err := time.Parse(time.DateOnly, str); err != nil {
+			errs.Add(path, "must be a date like 2006-01-02")
+		}
+	case "email":
+		if a, err := mail.ParseAddress(str); err != nil || a.Address != str {
+			errs.Add(path, "must be an email address")
+		}
+	}
+}
+
+func (sv *schemaValidator) checkObject(s *JSONSchema, obj map[string]any, path string, errs *ValidationErrors) {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			errs.Add(path+"/"+escapePointer(name), "is required")
+		}
+	}
+	if s.MinProperties != nil && len(obj) < *s.MinProperties {
+		errs.Add(path, fmt.Sprintf("must have at least %d members", *s.MinProperties))
+	}
+	if s.MaxProperties != nil && len(obj) > *s.MaxProperties {
+		errs.Add(path, fmt.Sprintf("must have at most %d members", *s.MaxProperties))
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys) // Report in a stable order
+	for _, k := range keys {
+		p := path + "/" + escapePointer(k)
+		if prop, ok := s.Properties[k]; ok {
+			sv.check(prop, obj[k], p, errs)
+		} else if s.AdditionalProperties != nil {
+			if s.AdditionalProperties.Always != nil && !*s.AdditionalProperties.Always {
+				errs.Add(p, "is not a known member")
+				continue
+			}
+			sv.check(s.AdditionalProperties, obj[k], p, errs)
+		}
+	}
+}
+
+// resolve follows a $ref within the root document; only "#" and
+// "#/$defs/Name" style pointers are supported
+func (sv *schemaValidator) resolve(ref string) (*JSONSchema, error) {
+	if ref == "#" {
+		return sv.root, nil
+	}
+	name, ok := strings.CutPrefix(ref, "#/$defs/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	if def, ok := sv.root.Defs[unescapePointer(name)]; ok {
+		return def, nil
+	}
+	return nil, fmt.Errorf("unresolved $ref %q", ref)
+}
+
+func schemaTypeMatches(t string, v any) bool {
+	switch x := v.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case []any:
+		return t == "array"
+	case map[string]any:
+		return t == "object"
+	case json.Number:
+		if t == "number" {
+			return true
+		}
+		if t != "integer" {
+			return false
+		}
+		if _, err := x.Int64(); err == nil {
+			return true
+		}
+		f, err := x.Float64() // 1.0 and 1e3 are integers too
+		return err == nil && f == math.Trunc(f)
+	}
+	return false
+}
+
+func schemaTypeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "number"
+}
+
+// jsonValuesEqual compares two values as JSON, so 1, 1.0 and
+// json.Number("1") are equal
+func jsonValuesEqual(a, b any) bool {
+	return reflect.DeepEqual(normalizeJSON(a), normalizeJSON(b))
+}
+
+func normalizeJSON(v any) any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	json.Unmarshal(b, &out)
+	return out
+}
+
+func compactJSON(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func formatSchemaNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// schemaCase is one document and the JSON Pointers it should be
+// rejected at; no pointers means the document is valid
+type schemaCase struct {
+	name    string
+	schema  func() (*JSONSchema, error)
+	doc     string
+	invalid []string
+}
+
+var jsonSchemaCases = []schemaCase{
+	{"user from the API", GenerateJSONSchema[User],
+		`{"id": 1, "name": "Ann", "email": "ann@example.com", "created_at": "2024-06-01T09:30:00Z", "version": 1}`, nil},
+	{"user without email or updated_at", GenerateJSONSchema[User],
+		`{"id": 2, "name": "Bob", "created_at": "2024-06-01T09:30:00Z", "version": 1}`, nil},
+	{"user missing required members", GenerateJSONSchema[User],
+		`{"name": "Ann"}`, []string{"/created_at", "/id", "/version"}},
+	{"user with zero created_at", GenerateJSONSchema[User],
+		`{"id": 1, "name": "Ann", "created_at": "0001-01-01T00:00:00Z", "version": 1}`, []string{"/created_at"}},
+	{"user with wrong types", GenerateJSONSchema[User],
+		`{"id": 1.5, "name": 7, "created_at": "yesterday", "version": "1"}`, []string{"/created_at", "/id", "/name", "/version"}},
+	{"password is not a member", GenerateJSONSchema[User],
+		`{"id": 1, "name": "Ann", "created_at": "2024-06-01T09:30:00Z", "version": 1, "password": "x"}`, []string{"/password"}},
+	{"computer", GenerateJSONSchema[Computer],
+		`{"cpu": "Intel i9", "ram": 32, "storage": 1000, "gpu": "RTX 4080", "monitor": true}`, nil},
+	{"computer breaking validate tags", GenerateJSONSchema[Computer],
+		`{"cpu": "", "ram": 0, "storage": -1}`, []string{"/cpu", "/ram", "/storage"}},
+	{"computer as an array", GenerateJSONSchema[Computer],
+		`[{"cpu": "Intel i9", "ram": 32, "storage": 1000}]`, []string{""}},
+	{"duration as text or nanoseconds", GenerateJSONSchema[codecTimeouts],
+		`{"timeout": "1h30m", "retries": ["1s", 2000000000], "per_host": {"api": "P1D"}}`, nil},
+	{"duration of the wrong type", GenerateJSONSchema[codecTimeouts],
+		`{"timeout": true, "retries": null, "per_host": {"api": []}}`, []string{"/per_host/api", "/timeout"}},
+}
+
+// TestJSONSchemas validates sample documents against schemas generated
+// from the lesson's structs
+func TestJSONSchemas(t *testing.T) {
+	for _, c := range jsonSchemaCases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.run(); err != nil {
+				t.Errorf("%v", err)
+			}
+		})
+	}
+}
+
+func (c schemaCase) run() error {
+	schema, err := c.schema()
+	if err != nil {
+		return err
+	}
+	// The schema must survive its own JSON form, as a file would
+	b, err := json.Marshal(schema)
+	if err != nil {
+		return err
+	}
+	var loaded JSONSchema
+	if err := json.Unmarshal(b, &loaded); err != nil {
+		return fmt.Errorf("reload schema: %w", err)
+	}
+
+	var got []string
+	var verrs ValidationErrors
+	if err := loaded.Validate([]byte(c.doc)); errors.As(err, &verrs) {
+		for _, e := range verrs {
+			if !slices.Contains(got, e.Field) {
+				got = append(got, e.Field)
+			}
+		}
+	} else if err != nil {
+		return err
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, c.invalid) {
+		return fmt.Errorf("rejected at %q, want %q (%v)", got, c.invalid, loaded.Validate([]byte(c.doc)))
+	}
+	return nil
+}
@@ -2,28 +2,43 @@ package main
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 )
 
 // Basic struct definition
 type Person struct {
-	FirstName string
-	LastName  string
-	Age       int
+	FirstName   string `csv:"first_name"`
+	LastName    string `csv:"last_name"`
+	DateOfBirth Date   `csv:"date_of_birth"` // Age is computed from this, see birthday.go
+
+	// Set when DateOfBirth was derived from a legacy "Age" field
+	DateOfBirthEstimated bool `json:",omitempty" csv:"-"`
 }
 
 // Struct with embedded struct
 type Address struct {
-	Street  string
-	City    string
-	Country string
+	Street     string `csv:"street"`
+	City       string `csv:"city"`
+	Region     string `csv:"region"` // State, province or prefecture
+	PostalCode string `csv:"postal_code"`
+	Country    string `csv:"country"` // ISO 3166 code once normalized, see address.go
 }
 
+// csv tags are read by csv_codec.go; embedded fields become flat columns
 type Employee struct {
-	Person    // Embedded struct
-	Address   // Embedded struct
-	Company   string
-	Salary    float64
+	Person     // Embedded struct
+	Address    // Embedded struct
+	ID         string  `csv:"id"`
+	ManagerID  string  `csv:"manager_id"` // Empty for the top of the hierarchy, see org_chart.go
+	Company    string  `csv:"company"`
+	Department string  `csv:"department"`
+	Salary     float64 `csv:"monthly_salary"`
 }
 
 // Method for Person struct
@@ -32,8 +47,9 @@ func (p Person) FullName() string {
 }
 
 // Pointer receiver method - can modify the struct
-func (p *Person) Birthday() {
-	p.Age++
+func (p *Person) SetDateOfBirth(year int, month time.Month, day int) {
+	p.DateOfBirth = NewDate(year, month, day)
+	p.DateOfBirthEstimated = false
 }
 
 // Method for Employee
@@ -41,41 +57,89 @@ func (e Employee) AnnualSalary() float64 {
 	return e.Salary * 12
 }
 
+// Without this, Employee would inherit Person.UnmarshalJSON and
+// decode only the Person fields
+func (e *Employee) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &e.Person); err != nil {
+		return err
+	}
+	type plain Employee
+	var rest struct {
+		*plain
+		UnmarshalJSON struct{} `json:"-"` // Hides the promoted Person.UnmarshalJSON
+	}
+	rest.plain = (*plain)(e)
+	return json.Unmarshal(b, &rest)
+}
+
 func main() {
 	// Creating a struct
+	now := time.Now()
 	person1 := Person{
-		FirstName: "John",
-		LastName:  "Doe",
-		Age:       30,
+		FirstName:   "John",
+		LastName:    "Doe",
+		DateOfBirth: NewDate(1995, time.June, 15),
 	}
 	fmt.Printf("Person: %+v\n", person1)
 	fmt.Printf("Full name: %s\n", person1.FullName())
+	age, _ := person1.Age(now)
+	fmt.Printf("Age today: %d\n", age)
+	if _, ok := (Person{FirstName: "Anon"}).Age(now); !ok {
+		fmt.Println("No date of birth, so no age")
+	}
 
 	// Using pointer receiver method
-	person1.Birthday()
-	fmt.Printf("After birthday: %+v\n", person1)
+	person1.SetDateOfBirth(1994, time.June, 15)
+	age, _ = person1.Age(now)
+	fmt.Printf("After correcting date of birth: %+v, age %d\n", person1, age)
 
 	// Creating struct with new
 	person2 := new(Person)
 	person2.FirstName = "Jane"
 	person2.LastName = "Smith"
-	person2.Age = 25
+	person2.SetDateOfBirth(2000, time.February, 29)
 	fmt.Printf("Person 2: %+v\n", person2)
 
+	// Ages depend on the calendar day where the person is
+	newYearsEve := time.Date(2024, time.December, 31, 23, 30, 0, 0, time.UTC)
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	baby := Person{FirstName: "Nova", DateOfBirth: NewDate(2023, time.January, 1)}
+	utcAge, _ := baby.Age(newYearsEve)
+	tokyoAge, _ := baby.Age(newYearsEve.In(tokyo))
+	fmt.Printf("Age at %s in UTC: %d, in Tokyo: %d\n", newYearsEve.Format(time.DateTime), utcAge, tokyoAge)
+
+	// Leap-day birthdays fall on 1 March (or 28 February) in common years
+	fmt.Printf("Jane turns 25 on %s\n", person2.NextBirthday(time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)))
+	DefaultLeapDayRule = LeapDayFebruary28
+	fmt.Printf("...or on %s where the law says so\n", person2.NextBirthday(time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)))
+	DefaultLeapDayRule = LeapDayMarch1
+
+	// Old records stored an age instead of a date of birth
+	var legacy Person
+	json.Unmarshal([]byte(`{"FirstName":"Old","LastName":"Record","Age":42}`), &legacy)
+	age, _ = legacy.Age(now)
+	fmt.Printf("Migrated legacy record: born %s (estimated: %v), age %d\n",
+		legacy.DateOfBirth, legacy.DateOfBirthEstimated, age)
+
 	// Creating an employee with embedded structs
 	employee := Employee{
 		Person: Person{
-			FirstName: "Alice",
-			LastName:  "Johnson",
-			Age:       28,
+			FirstName:   "Alice",
+			LastName:    "Johnson",
+			DateOfBirth: NewDate(1997, time.March, 14),
 		},
 		Address: Address{
-			Street:  "123 Main St",
-			City:    "New York",
-			Country: "USA",
+			Street:     "123 Main St",
+			City:       "New York",
+			Region:     "NY",
+			PostalCode: "10001",
+			Country:    "USA",
 		},
-		Company: "Tech Corp",
-		Salary:  5000,
+		ID:         "E100",
+		ManagerID:  "E2",
+		Company:    "Tech Corp",
+		Department: "Engineering",
+		Salary:     5000,
 	}
 
 	// Accessing fields from embedded structs
@@ -84,6 +148,127 @@ func main() {
 	fmt.Printf("Employee city: %s\n", employee.City)
 	fmt.Printf("Annual salary: $%.2f\n", employee.AnnualSalary())
 
+	// Offline address normalization (see address.go)
+	messy := []Address{
+		{Street: "  742   EVERGREEN terrace apartment 3 ", City: "springfield", Region: "or", PostalCode: "97403", Country: "u.s.a."},
+		{Street: "10 downing street", City: "london", PostalCode: "sw1a2aa", Country: "Great Britain"},
+		{Street: "Unter den Linden 77", City: "Berlin", PostalCode: "10117", Country: "Deutschland"},
+		{Street: "1-1 Chiyoda", City: "Chiyoda-ku", Region: "Tokyo", PostalCode: "1000001", Country: "Japan"},
+		{Street: "Main Street", City: "Toronto", PostalCode: "12345", Country: "Canada"},
+		{Street: "1 Rue de Rivoli", City: "Paris", Country: "Atlantis"},
+	}
+	for _, a := range messy {
+		label, err := a.Format("US")
+		if err != nil {
+			fmt.Printf("\nInvalid address %q: %v\n", a.Street, strings.ReplaceAll(err.Error(), "\n", "; "))
+			continue
+		}
+		fmt.Printf("\n%s\n", label)
+	}
+	normalized, _ := NormalizeAddress(employee.Address)
+	fmt.Printf("Normalized employee address: %+v\n", normalized)
+
+	// Payroll with exact money (see payroll.go); run from this directory.
+	// The golden files in testdata/payroll are checked by go test.
+	if cfg, err := LoadPayrollConfig("testdata/payroll/us.json"); err != nil {
+		fmt.Printf("Payroll config: %v\n", err)
+	} else if slips, err := RunPayroll(cfg, employee, Monthly, NewDate(2024, time.September, 16), 2024); err != nil {
+		fmt.Printf("Payroll: %v\n", err)
+	} else {
+		fmt.Println("\nFirst payslip:")
+		slips[0].Render(os.Stdout)
+	}
+
+	// Org chart built from manager links (see org_chart.go)
+	staff := []Employee{
+		{Person: Person{FirstName: "Grace", LastName: "Hopper"}, Address: Address{City: "New York"}, ID: "E1", Department: "Executive", Salary: 20000},
+		{Person: Person{FirstName: "Linus", LastName: "Lee"}, Address: Address{City: "San Francisco"}, ID: "E2", ManagerID: "E1", Department: "Engineering", Salary: 12000},
+		{Person: Person{FirstName: "Mia", LastName: "Chen"}, Address: Address{City: "Chicago"}, ID: "E3", ManagerID: "E1", Department: "Sales", Salary: 9000},
+		employee,
+		{Person: Person{FirstName: "Raj", LastName: "Patel"}, Address: Address{City: "San Francisco"}, ID: "E101", ManagerID: "E2", Department: "Engineering", Salary: 5500},
+		{Person: Person{FirstName: "Sam", LastName: "Ortiz"}, Address: Address{City: "Austin"}, ID: "E300", ManagerID: "E3", Department: "Sales", Salary: 4000},
+	}
+	org, err := NewOrgChart(staff)
+	if err != nil {
+		fmt.Printf("Org chart: %v\n", err)
+	} else {
+		fmt.Println("\nOrg chart:")
+		org.WriteTree(os.Stdout)
+
+		chain, _ := org.ReportingChain("E100")
+		for _, m := range chain {
+			fmt.Printf("%s reports up to %s\n", employee.FullName(), m.FullName())
+		}
+		direct, total := org.SpanOfControl("E1")
+		fmt.Printf("Span of control for E1: %d direct, %d total\n", direct, total)
+		for _, r := range org.DepartmentRollups() {
+			fmt.Printf("  %-12s %d people, $%.2f/year\n", r.Department, r.Headcount, r.AnnualSalary)
+		}
+		fmt.Printf("Engineering under Linus: $%.2f/year\n", org.TeamSalary("E2"))
+		fmt.Printf("Making Linus report to Raj: %v\n", org.SetManager("E2", "E101"))
+		org.WriteDOT(os.Stdout)
+	}
+
+	// What changed between two versions of an employee (see struct_diff.go)
+	promoted := employee
+	promoted.Department = "Platform"
+	promoted.Salary = 6500
+	promoted.City = "Boston"
+	promoted.ManagerID = ""
+	if patch, err := Diff(employee, promoted); err == nil {
+		fmt.Printf("\nEmployee patch: %s\n", patch)
+		restored := promoted
+		reverse, _ := Diff(promoted, employee)
+		ApplyPatch(&restored, reverse)
+		fmt.Printf("Reverse patch restores the original: %v\n", restored == employee)
+	}
+
+	// CSV and JSON Lines import/export (see csv_codec.go)
+	var csvOut strings.Builder
+	if cw, err := NewCSVWriter[Employee](&csvOut); err == nil {
+		for _, e := range staff[:3] {
+			cw.Write(e)
+		}
+		cw.Flush()
+	}
+	fmt.Printf("\nStaff as CSV:\n%s", csvOut.String())
+
+	csvIn := `id,first_name,last_name,date_of_birth,department,monthly_salary,nickname
+E7,Ada,Byron,1815-12-10,Research,8000,Countess
+E8,Alan,Turing,1912-06-31,Research,lots,
+E9,Kurt,Gödel,1906-04-28,Research,7500
+`
+	imported, err := ReadAllCSV[Employee](strings.NewReader(csvIn))
+	fmt.Printf("Imported %d rows from CSV\n", len(imported))
+	var rowErrs RowErrors
+	if errors.As(err, &rowErrs) {
+		for _, e := range rowErrs {
+			fmt.Printf("  skipped: %v\n", e)
+		}
+	}
+
+	var jsonl bytes.Buffer
+	jw := NewJSONLWriter[Employee](&jsonl)
+	for _, e := range imported {
+		jw.Write(e)
+	}
+	jw.Flush()
+	jsonl.WriteString("{\"ID\": 42}\n")
+	for e, err := range NewJSONLReader[Employee](&jsonl).All() {
+		if err != nil {
+			fmt.Printf("  JSONL error: %v\n", err)
+			continue
+		}
+		fmt.Printf("  JSONL: %s %s, born %s\n", e.ID, e.FullName(), e.DateOfBirth)
+	}
+
+	// Upcoming birthdays in the next 180 days
+	people := []Person{person1, *person2, employee.Person, baby}
+	fmt.Println("\nBirthdays in the next 180 days:")
+	for _, b := range UpcomingBirthdays(people, now, 180) {
+		fmt.Printf("  %s turns %d on %s (in %d days)\n", b.Person.FullName(), b.TurnsAge, b.Date, b.DaysUntil)
+	}
+
 	// Anonymous struct
 	point := struct {
 		X, Y int
@@ -92,4 +277,55 @@ func main() {
 		Y: 20,
 	}
 	fmt.Printf("\nPoint: %+v\n", point)
+
+	// Querying slices of structs into anonymous structs and records (see query.go)
+	wellPaid, err := SelectInto[struct {
+		Name   string `query:"FullName"`
+		City   string
+		Salary float64
+	}](From(staff).Where(func(e Employee) bool { return e.Salary >= 5000 }).OrderBy("City", "-Salary"))
+	if err != nil {
+		fmt.Printf("\nWell paid staff: %v\n", err)
+	} else {
+		fmt.Println("\nEarning at least $5000/month, by city:")
+		for _, e := range wellPaid {
+			fmt.Printf("  %+v\n", e)
+		}
+	}
+
+	departments, err := From(staff).
+		GroupBy("Department").
+		Aggregate(Count(), Sum("AnnualSalary").As("Payroll"), Max("Salary")).
+		OrderBy("-Payroll").
+		Select("Department", "Count", "Payroll", "MaxSalary")
+	if err != nil {
+		fmt.Printf("Departments: %v\n", err)
+	} else {
+		fmt.Println("By department:")
+		for _, row := range departments {
+			fmt.Printf("  %-12s %d people, $%.2f/year, top monthly $%.2f\n", row["Department"], row["Count"], row["Payroll"], row["MaxSalary"])
+		}
+	}
+
+	offices := []Address{
+		{Street: "350 5th Ave", City: "New York", Region: "NY", Country: "US"},
+		{Street: "1 Market St", City: "San Francisco", Region: "CA", Country: "US"},
+		{Street: "233 S Wacker Dr", City: "Chicago", Region: "IL", Country: "US"},
+	}
+	desks, err := LeftJoin(From(staff), offices, "City", "City").
+		OrderBy("Left.ID").
+		Select("Left.ID as ID", "Left.FullName as Name", "Right.Street as Office", "Matched")
+	if err != nil {
+		fmt.Printf("Offices: %v\n", err)
+	} else {
+		fmt.Println("Office by city:")
+		for _, d := range desks {
+			if d["Matched"] == false {
+				d["Office"] = "remote"
+			}
+			fmt.Printf("  %-5s %-14s %s\n", d["ID"], d["Name"], d["Office"])
+		}
+	}
+	_, err = From(staff).OrderBy("Nickname").All()
+	fmt.Printf("Ordering by an unknown field: %v\n", err)
 }
\ No newline at end of file
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// currencyExponents is the number of minor-unit digits per ISO 4217 code
+var currencyExponents = map[string]int{
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"INR": 2,
+	"JPY": 0,
+	"KWD": 3,
+}
+
+// Money is an exact amount in a currency's minor units (cents for USD)
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func currencyExponent(currency string) (int, error) {
+	exp, ok := currencyExponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("unknown currency %q", currency)
+	}
+	return exp, nil
+}
+
+// ParseMoney parses a decimal string such as "1234.5" or "-0.25".
+// More decimal places than the currency allows is an error, not rounding.
+func ParseMoney(s, currency string) (Money, error) {
+	exp, err := currencyExponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || strings.ContainsAny(s, "eE/") {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	minor := new(big.Rat).Mul(r, new(big.Rat).SetInt(pow10(exp)))
+	if !minor.IsInt() {
+		return Money{}, fmt.Errorf("amount %q has more than %d decimal places for %s", s, exp, currency)
+	}
+	if !minor.Num().IsInt64() {
+		return Money{}, fmt.Errorf("amount %q is too large", s)
+	}
+	return Money{Amount: minor.Num().Int64(), Currency: currency}, nil
+}
+
+// MoneyFromFloat rounds f to the currency's minor unit. Use it only at
+// the boundary with float-based code such as Employee.Salary.
+func MoneyFromFloat(f float64, currency string) (Money, error) {
+	exp, err := currencyExponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	return ParseMoney(strconv.FormatFloat(f, 'f', exp, 64), currency)
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func (m Money) mustMatch(o Money) {
+	if m.Currency != o.Currency {
+		panic(fmt.Sprintf("money: currency mismatch %s vs %s", m.Currency, o.Currency))
+	}
+}
+
+func (m Money) Add(o Money) Money {
+	m.mustMatch(o)
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}
+}
+
+func (m Money) Sub(o Money) Money {
+	m.mustMatch(o)
+	return Money{Amount: m.Amount - o.Amount, Currency: m.Currency}
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) Cmp(o Money) int {
+	m.mustMatch(o)
+	switch {
+	case m.Amount < o.Amount:
+		return -1
+	case m.Amount > o.Amount:
+		return 1
+	}
+	return 0
+}
+
+// Mul multiplies by an exact rate, rounding half away from zero
+func (m Money) Mul(r *big.Rat) Money {
+	x := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), r)
+	return Money{Amount: roundRat(x), Currency: m.Currency}
+}
+
+// Allocate splits m into n parts that differ by at most one minor unit
+// and add up to exactly m; earlier parts get the extra units
+func (m Money) Allocate(n int) []Money {
+	parts := make([]Money, n)
+	base, rem := m.Amount/int64(n), m.Amount%int64(n)
+	for i := range parts {
+		parts[i] = Money{Amount: base, Currency: m.Currency}
+		if int64(i) < rem {
+			parts[i].Amount++
+		} else if int64(i) < -rem {
+			parts[i].Amount--
+		}
+	}
+	return parts
+}
+
+// roundRat rounds x to the nearest integer, halves away from zero
+func roundRat(x *big.Rat) int64 {
+	q, r := new(big.Int).QuoRem(x.Num(), x.Denom(), new(big.Int))
+	twice := new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2))
+	if twice.Cmp(x.Denom()) >= 0 {
+		if x.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q.Int64()
+}
+
+// Decimal formats the amount without the currency, e.g. "-1234.50"
+func (m Money) Decimal() string {
+	exp := currencyExponents[m.Currency]
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	digits := strconv.FormatInt(amount, 10)
+	if exp == 0 {
+		return sign + digits
+	}
+	for len(digits) <= exp {
+		digits = "0" + digits
+	}
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrUnknownEmployee = errors.New("unknown employee")
+	ErrDuplicateID     = errors.New("duplicate employee id")
+	ErrOrgCycle        = errors.New("management cycle")
+)
+
+// OrgChart links employees to their managers through Employee.ManagerID
+type OrgChart struct {
+	employees map[string]Employee
+	reports   map[string][]string // manager ID -> direct report IDs
+}
+
+// NewOrgChart checks that IDs are unique, managers exist and nobody
+// ends up managing themselves
+func NewOrgChart(employees []Employee) (*OrgChart, error) {
+	c := &OrgChart{
+		employees: make(map[string]Employee, len(employees)),
+		reports:   make(map[string][]string),
+	}
+	for _, e := range employees {
+		if e.ID == "" {
+			return nil, fmt.Errorf("%s: %w: empty id", e.FullName(), ErrUnknownEmployee)
+		}
+		if _, ok := c.employees[e.ID]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateID, e.ID)
+		}
+		c.employees[e.ID] = e
+	}
+	for _, e := range employees {
+		if e.ManagerID == "" {
+			continue
+		}
+		if _, ok := c.employees[e.ManagerID]; !ok {
+			return nil, fmt.Errorf("%s reports to %s: %w", e.ID, e.ManagerID, ErrUnknownEmployee)
+		}
+		if err := c.checkCycle(e.ID, e.ManagerID); err != nil {
+			return nil, err
+		}
+		c.reports[e.ManagerID] = append(c.reports[e.ManagerID], e.ID)
+	}
+	for id := range c.reports {
+		c.sortReports(id)
+	}
+	return c, nil
+}
+
+// SetManager moves id under managerID; an empty managerID makes id a root
+func (c *OrgChart) SetManager(id, managerID string) error {
+	e, ok := c.employees[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownEmployee, id)
+	}
+	if managerID != "" {
+		if _, ok := c.employees[managerID]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownEmployee, managerID)
+		}
+		if err := c.checkCycle(id, managerID); err != nil {
+			return err
+		}
+	}
+
+	if old := e.ManagerID; old != "" {
+		c.reports[old] = removeString(c.reports[old], id)
+	}
+	e.ManagerID = managerID
+	c.employees[id] = e
+	if managerID != "" {
+		c.reports[managerID] = append(c.reports[managerID], id)
+		c.sortReports(managerID)
+	}
+	return nil
+}
+
+// checkCycle fails if making managerID the manager of id would loop
+func (c *OrgChart) checkCycle(id, managerID string) error {
+	path := []string{id}
+	seen := map[string]bool{id: true}
+	for cur := managerID; cur != ""; cur = c.employees[cur].ManagerID {
+		path = append(path, cur)
+		if cur == id || seen[cur] {
+			return fmt.Errorf("%w: %s", ErrOrgCycle, strings.Join(path, " -> "))
+		}
+		seen[cur] = true
+	}
+	return nil
+}
+
+func (c *OrgChart) sortReports(managerID string) {
+	ids := c.reports[managerID]
+	sort.Slice(ids, func(i, j int) bool {
+		return c.employees[ids[i]].FullName() < c.employees[ids[j]].FullName()
+	})
+}
+
+func removeString(list []string, s string) []string {
+	for i, v := range list {
+		if v == s {
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+func (c *OrgChart) Get(id string) (Employee, bool) {
+	e, ok := c.employees[id]
+	return e, ok
+}
+
+// Roots returns the employees without a manager
+func (c *OrgChart) Roots() []Employee {
+	var roots []Employee
+	for _, e := range c.employees {
+		if e.ManagerID == "" {
+			roots = append(roots, e)
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool { return roots[i].FullName() < roots[j].FullName() })
+	return roots
+}
+
+// ReportingChain lists id's manager, their manager, and so on to the top
+func (c *OrgChart) ReportingChain(id string) ([]Employee, error) {
+	e, ok := c.employees[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEmployee, id)
+	}
+	var chain []Employee
+	for e.ManagerID != "" {
+		e = c.employees[e.ManagerID]
+		chain = append(chain, e)
+	}
+	return chain, nil
+}
+
+func (c *OrgChart) DirectReports(id string) []Employee {
+	var result []Employee
+	for _, rid := range c.reports[id] {
+		result = append(result, c.employees[rid])
+	}
+	return result
+}
+
+// SpanOfControl counts id's direct reports and everyone below them
+func (c *OrgChart) SpanOfControl(id string) (direct, total int) {
+	direct = len(c.reports[id])
+	for _, rid := range c.reports[id] {
+		_, below := c.SpanOfControl(rid)
+		total += 1 + below
+	}
+	return direct, total
+}
+
+// DepartmentRollup totals AnnualSalary for one department
+type DepartmentRollup struct {
+	Department   string
+	Headcount    int
+	AnnualSalary float64
+}
+
+func (c *OrgChart) DepartmentRollups() []DepartmentRollup {
+	byDept := make(map[string]*DepartmentRollup)
+	for _, e := range c.employees {
+		r, ok := byDept[e.Department]
+		if !ok {
+			r = &DepartmentRollup{Department: e.Department}
+			byDept[e.Department] = r
+		}
+		r.Headcount++
+		r.AnnualSalary += e.AnnualSalary()
+	}
+
+	result := make([]DepartmentRollup, 0, len(byDept))
+	for _, r := range byDept {
+		result = append(result, *r)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Department < result[j].Department })
+	return result
+}
+
+// TeamSalary totals AnnualSalary for id and everyone below them
+func (c *OrgChart) TeamSalary(id string) float64 {
+	total := c.employees[id].AnnualSalary()
+	for _, rid := range c.reports[id] {
+		total += c.TeamSalary(rid)
+	}
+	return total
+}
+
+// WriteTree draws the hierarchy with box-drawing characters
+func (c *OrgChart) WriteTree(w io.Writer) error {
+	var sb strings.Builder
+	for _, root := range c.Roots() {
+		c.writeTreeNode(&sb, root.ID, "", "")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func (c *OrgChart) writeTreeNode(sb *strings.Builder, id, prefix, childPrefix string) {
+	e := c.employees[id]
+	fmt.Fprintf(sb, "%s%s [%s]\n", prefix, e.FullName(), e.Department)
+	reports := c.reports[id]
+	for i, rid := range reports {
+		if i == len(reports)-1 {
+			c.writeTreeNode(sb, rid, childPrefix+"└── ", childPrefix+"    ")
+		} else {
+			c.writeTreeNode(sb, rid, childPrefix+"├── ", childPrefix+"│   ")
+		}
+	}
+}
+
+// WriteDOT exports the hierarchy as a Graphviz digraph, one cluster per department
+func (c *OrgChart) WriteDOT(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("digraph org {\n\trankdir=TB;\n\tnode [shape=box];\n")
+
+	for i, dept := range c.DepartmentRollups() {
+		fmt.Fprintf(&sb, "\tsubgraph cluster_%d {\n\t\tlabel=%s;\n", i, dotQuote(dept.Department))
+		ids := make([]string, 0, dept.Headcount)
+		for id, e := range c.employees {
+			if e.Department == dept.Department {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			fmt.Fprintf(&sb, "\t\t%s [label=%s];\n", dotQuote(id), dotQuote(c.employees[id].FullName()))
+		}
+		sb.WriteString("\t}\n")
+	}
+
+	managers := make([]string, 0, len(c.reports))
+	for id := range c.reports {
+		managers = append(managers, id)
+	}
+	sort.Strings(managers)
+	for _, m := range managers {
+		for _, rid := range c.reports[m] {
+			fmt.Fprintf(&sb, "\t%s -> %s;\n", dotQuote(m), dotQuote(rid))
+		}
+	}
+	sb.WriteString("}\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrMalformedHash   = errors.New("malformed password hash")
+	ErrPasswordInvalid = errors.New("invalid password")
+)
+
+// maxIterations stops a tampered hash from making Verify spin forever
+const maxIterations = 10_000_000
+
+var b64 = base64.RawStdEncoding
+
+// PasswordHasher creates PBKDF2 hashes in PHC string format:
+//
+//	$pbkdf2-sha256$i=600000,l=32$<salt>$<hash>
+type PasswordHasher struct {
+	Algorithm  string // "pbkdf2-sha256" or "pbkdf2-sha512"
+	Iterations int
+	SaltLength int
+	KeyLength  int
+}
+
+// NewPasswordHasher uses the OWASP recommended settings for PBKDF2-SHA256
+func NewPasswordHasher() *PasswordHasher {
+	return &PasswordHasher{
+		Algorithm:  "pbkdf2-sha256",
+		Iterations: 600_000,
+		SaltLength: 16,
+		KeyLength:  32,
+	}
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	newHash, err := hashFunc(h.Algorithm)
+	if err != nil {
+		return "", err
+	}
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(newHash, password, salt, h.Iterations, h.KeyLength)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("$%s$i=%d,l=%d$%s$%s",
+		h.Algorithm, h.Iterations, h.KeyLength, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+// Verify checks password against encoded in constant time. needsRehash is
+// true when encoded was made with weaker settings than h uses now.
+func (h *PasswordHasher) Verify(password, encoded string) (ok, needsRehash bool, err error) {
+	p, err := parsePHC(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	newHash, err := hashFunc(p.algorithm)
+	if err != nil {
+		return false, false, fmt.Errorf("%w: %v", ErrMalformedHash, err)
+	}
+	key, err := pbkdf2.Key(newHash, password, p.salt, p.iterations, len(p.key))
+	if err != nil {
+		return false, false, err
+	}
+	if subtle.ConstantTimeCompare(key, p.key) != 1 {
+		return false, false, nil
+	}
+
+	needsRehash = p.algorithm != h.Algorithm ||
+		p.iterations < h.Iterations ||
+		len(p.salt) < h.SaltLength ||
+		len(p.key) < h.KeyLength
+	return true, needsRehash, nil
+}
+
+type phcHash struct {
+	algorithm  string
+	iterations int
+	salt       []byte
+	key        []byte
+}
+
+func parsePHC(encoded string) (*phcHash, error) {
+	// "$alg$params$salt$hash" splits into 5 parts with an empty first one
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[0] != "" {
+		return nil, ErrMalformedHash
+	}
+
+	p := &phcHash{algorithm: parts[1]}
+	for _, param := range strings.Split(parts[2], ",") {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: parameter %q", ErrMalformedHash, param)
+		}
+		if name == "i" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxIterations {
+				return nil, fmt.Errorf("%w: iterations %q", ErrMalformedHash, value)
+			}
+			p.iterations = n
+		}
+	}
+	if p.iterations == 0 {
+		return nil, fmt.Errorf("%w: missing iterations", ErrMalformedHash)
+	}
+
+	var err error
+	if p.salt, err = b64.DecodeString(parts[3]); err != nil {
+		return nil, fmt.Errorf("%w: salt: %v", ErrMalformedHash, err)
+	}
+	if p.key, err = b64.DecodeString(parts[4]); err != nil || len(p.key) == 0 {
+		return nil, fmt.Errorf("%w: hash", ErrMalformedHash)
+	}
+	return p, nil
+}
+
+func hashFunc(algorithm string) (func() hash.Hash, error) {
+	switch algorithm {
+	case "pbkdf2-sha256":
+		return sha256.New, nil
+	case "pbkdf2-sha512":
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("unsupported password algorithm %q", algorithm)
+	}
+}
+
+// LegacyPasswordPrefix marks a stored password as plaintext from before
+// hashing; only values carrying it are compared as plaintext
+const LegacyPasswordPrefix = "plain:"
+
+// SetPassword checks password against policy and stores its hash
+func (u *User) SetPassword(h *PasswordHasher, policy PasswordPolicy, password string) error {
+	if err := policy.Check(password, u); err != nil {
+		return err
+	}
+	encoded, err := h.Hash(password)
+	if err != nil {
+		return err
+	}
+	u.Password = encoded
+	return nil
+}
+
+// CheckPassword verifies password and reports whether u.Password was
+// replaced by a stronger hash, in which case the caller should save u.
+// Legacy plaintext passwords (LegacyPasswordPrefix) are compared in
+// constant time and upgraded; anything else that isn't a PHC hash,
+// including an empty value, is ErrMalformedHash.
+func (u *User) CheckPassword(h *PasswordHasher, password string) (rehashed bool, err error) {
+	var ok, needsRehash bool
+	switch plain, legacy := strings.CutPrefix(u.Password, LegacyPasswordPrefix); {
+	case legacy && plain != "":
+		// Comparing digests keeps the time independent of both lengths
+		want, got := sha256.Sum256([]byte(plain)), sha256.Sum256([]byte(password))
+		ok = subtle.ConstantTimeCompare(got[:], want[:]) == 1
+		needsRehash = true
+	case strings.HasPrefix(u.Password, "$"):
+		ok, needsRehash, err = h.Verify(password, u.Password)
+		if err != nil {
+			return false, err
+		}
+	default:
+		return false, ErrMalformedHash
+	}
+	if !ok {
+		return false, ErrPasswordInvalid
+	}
+	if !needsRehash {
+		return false, nil
+	}
+
+	encoded, err := h.Hash(password)
+	if err != nil {
+		return false, err
+	}
+	u.Password = encoded
+	return true, nil
+}
+
+// PasswordPolicy lists the rules a new password must follow
+type PasswordPolicy struct {
+	MinLength      int
+	MaxLength      int
+	RequireUpper   bool
+	RequireLower   bool
+	RequireDigit   bool
+	RequireSymbol  bool
+	Forbidden      []string // Common passwords, compared case-insensitively
+	RejectUserInfo bool     // Reject passwords containing the user's name or email
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:      12,
+		MaxLength:      128,
+		RequireUpper:   true,
+		RequireLower:   true,
+		RequireDigit:   true,
+		Forbidden:      []string{"password", "password123", "secret123", "123456789012", "qwertyuiop"},
+		RejectUserInfo: true,
+	}
+}
+
+// Check reports every broken rule as a *ValidationError on "password"
+func (p PasswordPolicy) Check(password string, u *User) error {
+	var errs ValidationErrors
+	length := len([]rune(password))
+	if length < p.MinLength {
+		errs.Add("password", fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		errs.Add("password", fmt.Sprintf("must be at most %d characters", p.MaxLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		errs.Add("password", "must contain an upper-case letter")
+	}
+	if p.RequireLower && !lower {
+		errs.Add("password", "must contain a lower-case letter")
+	}
+	if p.RequireDigit && !digit {
+		errs.Add("password", "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		errs.Add("password", "must contain a symbol")
+	}
+
+	lowered := strings.ToLower(password)
+	for _, f := range p.Forbidden {
+		if lowered == strings.ToLower(f) {
+			errs.Add("password", "is too common")
+			break
+		}
+	}
+	if p.RejectUserInfo && u != nil {
+		local, _, _ := strings.Cut(strings.ToLower(u.Email), "@")
+		for _, part := range append(strings.Fields(strings.ToLower(u.Name)), local) {
+			if len(part) >= 3 && strings.Contains(lowered, part) {
+				errs.Add("password", "must not contain your name or email")
+				break
+			}
+		}
+	}
+	return errs.Err()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCheckPasswordStoredValues(t *testing.T) {
+	hasher := &PasswordHasher{Algorithm: "pbkdf2-sha256", Iterations: 1000, SaltLength: 16, KeyLength: 32}
+	hashed, err := hasher.Hash("Correct-Horse-42")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		stored   string
+		password string
+		rehashed bool
+		err      error
+	}{
+		{"hash", hashed, "Correct-Horse-42", false, nil},
+		{"hash, wrong password", hashed, "correct-horse-42", false, ErrPasswordInvalid},
+		{"legacy plaintext", LegacyPasswordPrefix + "secret123", "secret123", true, nil},
+		{"legacy, wrong password", LegacyPasswordPrefix + "secret123", "secret1234", false, ErrPasswordInvalid},
+		{"empty", "", "", false, ErrMalformedHash},
+		{"empty legacy", LegacyPasswordPrefix, "", false, ErrMalformedHash},
+		{"unmarked plaintext", "secret123", "secret123", false, ErrMalformedHash},
+		{"unknown format", "$argon2id$v=19$m=65536,t=3,p=4$c2FsdA$aGFzaA", "$argon2id$v=19$m=65536,t=3,p=4$c2FsdA$aGFzaA", false, ErrMalformedHash},
+		{"unsupported algorithm", "$pbkdf2-md5$i=1000$c2FsdA$aGFzaA", "x", false, ErrMalformedHash},
+		{"broken hash", "$pbkdf2-sha256$i=1000", "$pbkdf2-sha256$i=1000", false, ErrMalformedHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &User{Password: tt.stored}
+			rehashed, err := u.CheckPassword(hasher, tt.password)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if rehashed != tt.rehashed {
+				t.Errorf("rehashed = %v, want %v", rehashed, tt.rehashed)
+			}
+			if err != nil && u.Password != tt.stored {
+				t.Errorf("failed check changed the stored password to %q", u.Password)
+			}
+		})
+	}
+}
+
+func TestHashPasswordPHC(t *testing.T) {
+	hasher := &PasswordHasher{Algorithm: "pbkdf2-sha512", Iterations: 1000, SaltLength: 24, KeyLength: 48}
+	encoded, err := hasher.Hash("Correct-Horse-42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$pbkdf2-sha512$i=1000,l=48$") {
+		t.Errorf("Hash = %q, want a $pbkdf2-sha512$i=1000,l=48$ PHC string", encoded)
+	}
+
+	p, err := parsePHC(encoded)
+	if err != nil {
+		t.Fatalf("parsePHC(%q): %v", encoded, err)
+	}
+	if p.algorithm != hasher.Algorithm || p.iterations != hasher.Iterations ||
+		len(p.salt) != hasher.SaltLength || len(p.key) != hasher.KeyLength {
+		t.Errorf("parsed %s, %d iterations, %d byte salt, %d byte key; want the hasher's settings",
+			p.algorithm, p.iterations, len(p.salt), len(p.key))
+	}
+
+	if ok, needsRehash, err := hasher.Verify("Correct-Horse-42", encoded); !ok || needsRehash || err != nil {
+		t.Errorf("Verify with the same settings = %v, %v, %v; want true, false, nil", ok, needsRehash, err)
+	}
+	stronger := *hasher
+	stronger.Iterations *= 2
+	if ok, needsRehash, err := stronger.Verify("Correct-Horse-42", encoded); !ok || !needsRehash || err != nil {
+		t.Errorf("Verify with more iterations = %v, %v, %v; want true, true, nil", ok, needsRehash, err)
+	}
+	if again, _ := hasher.Hash("Correct-Horse-42"); again == encoded {
+		t.Error("two hashes of one password share a salt")
+	}
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	user := &User{Name: "John Doe", Email: "jdoe@example.com"}
+	tests := []struct {
+		password string
+		want     []string
+	}{
+		{"Correct-Horse-42", nil},
+		{"Short-1", []string{"must be at least 12 characters"}},
+		{"all lower case only", []string{"must contain an upper-case letter", "must contain a digit"}},
+		{"ALL-UPPER-CASE-7", []string{"must contain a lower-case letter"}},
+		{"QwertyUIOP", []string{"must be at least 12 characters", "must contain a digit", "is too common"}},
+		{"Johnny-Boy-2024", []string{"must not contain your name or email"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			err := policy.Check(tt.password, user)
+			var got []string
+			var verrs ValidationErrors
+			if errors.As(err, &verrs) {
+				for _, v := range verrs {
+					if v.Field != "password" {
+						t.Errorf("violation on %q, want password", v.Field)
+					}
+					got = append(got, v.Message)
+				}
+			} else if err != nil {
+				t.Fatalf("Check returned %T, want ValidationErrors", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Check(%q) = %q, want %q", tt.password, got, tt.want)
+			}
+		})
+	}
+
+	var one *ValidationError
+	if err := policy.Check("short", user); !errors.As(err, &one) {
+		t.Errorf("errors.As found no *ValidationError in %v", err)
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"time"
+)
+
+// PayFrequency is how often employees are paid
+type PayFrequency string
+
+const (
+	Weekly      PayFrequency = "weekly"
+	Biweekly    PayFrequency = "biweekly"
+	Semimonthly PayFrequency = "semimonthly"
+	Monthly     PayFrequency = "monthly"
+)
+
+// PayrollConfig holds tax brackets and deductions, loaded from JSON.
+// Amounts and rates are decimal strings so they stay exact.
+type PayrollConfig struct {
+	Currency   string            `json:"currency"`
+	Brackets   []TaxBracket      `json:"tax_brackets"`
+	Deductions []DeductionConfig `json:"deductions"`
+}
+
+// TaxBracket taxes annual income up to UpTo at Rate; the last bracket
+// leaves UpTo empty
+type TaxBracket struct {
+	UpTo string `json:"up_to,omitempty"`
+	Rate string `json:"rate"`
+
+	upTo *Money
+	rate *big.Rat
+}
+
+// DeductionConfig is either a percentage of gross pay or a fixed amount
+// per pay period. Pre-tax deductions reduce taxable income.
+type DeductionConfig struct {
+	Name   string `json:"name"`
+	Rate   string `json:"rate,omitempty"`
+	Amount string `json:"amount,omitempty"`
+	PreTax bool   `json:"pre_tax"`
+
+	rate   *big.Rat
+	amount *Money
+}
+
+func LoadPayrollConfig(path string) (*PayrollConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg PayrollConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := cfg.prepare(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// prepare parses and checks the decimal strings
+func (c *PayrollConfig) prepare() error {
+	if _, err := currencyExponent(c.Currency); err != nil {
+		return err
+	}
+	if len(c.Brackets) == 0 {
+		return fmt.Errorf("no tax brackets")
+	}
+	for i := range c.Brackets {
+		b := &c.Brackets[i]
+		var err error
+		if b.rate, err = parseRate(b.Rate); err != nil {
+			return fmt.Errorf("tax bracket %d: %w", i+1, err)
+		}
+		last := i == len(c.Brackets)-1
+		if b.UpTo == "" {
+			if !last {
+				return fmt.Errorf("tax bracket %d: only the last bracket may be unbounded", i+1)
+			}
+			continue
+		}
+		if last {
+			return fmt.Errorf("tax bracket %d: the last bracket must be unbounded", i+1)
+		}
+		upTo, err := ParseMoney(b.UpTo, c.Currency)
+		if err != nil {
+			return fmt.Errorf("tax bracket %d: %w", i+1, err)
+		}
+		if i > 0 && upTo.Cmp(*c.Brackets[i-1].upTo) <= 0 {
+			return fmt.Errorf("tax bracket %d: limits must increase", i+1)
+		}
+		b.upTo = &upTo
+	}
+
+	for i := range c.Deductions {
+		d := &c.Deductions[i]
+		switch {
+		case d.Rate != "" && d.Amount == "":
+			rate, err := parseRate(d.Rate)
+			if err != nil {
+				return fmt.Errorf("deduction %q: %w", d.Name, err)
+			}
+			d.rate = rate
+		case d.Amount != "" && d.Rate == "":
+			amount, err := ParseMoney(d.Amount, c.Currency)
+			if err != nil {
+				return fmt.Errorf("deduction %q: %w", d.Name, err)
+			}
+			d.amount = &amount
+		default:
+			return fmt.Errorf("deduction %q: set exactly one of rate and amount", d.Name)
+		}
+	}
+	return nil
+}
+
+func parseRate(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || r.Sign() < 0 || r.Cmp(big.NewRat(1, 1)) > 0 {
+		return nil, fmt.Errorf("rate %q must be a decimal between 0 and 1", s)
+	}
+	return r, nil
+}
+
+// annualTax applies the progressive brackets to a yearly income
+func (c *PayrollConfig) annualTax(income Money) Money {
+	tax := Money{Currency: income.Currency}
+	lower := Money{Currency: income.Currency}
+	for _, b := range c.Brackets {
+		if income.Cmp(lower) <= 0 {
+			break
+		}
+		portion := income.Sub(lower)
+		if b.upTo != nil && income.Cmp(*b.upTo) > 0 {
+			portion = b.upTo.Sub(lower)
+		}
+		tax = tax.Add(portion.Mul(b.rate))
+		if b.upTo != nil {
+			lower = *b.upTo
+		}
+	}
+	return tax
+}
+
+// PayPeriod is an inclusive range of calendar days
+type PayPeriod struct {
+	Start, End Date
+}
+
+func (p PayPeriod) Days() int {
+	return p.Start.DaysUntil(p.End) + 1
+}
+
+// PayPeriods lists the pay periods of year. Weekly and biweekly periods
+// start on 1 January; the last one runs to 31 December.
+func PayPeriods(freq PayFrequency, year int) ([]PayPeriod, error) {
+	var periods []PayPeriod
+	switch freq {
+	case Monthly:
+		for m := time.January; m <= time.December; m++ {
+			end := DateOf(time.Date(year, m+1, 0, 0, 0, 0, 0, time.UTC))
+			periods = append(periods, PayPeriod{NewDate(year, m, 1), end})
+		}
+	case Semimonthly:
+		for m := time.January; m <= time.December; m++ {
+			end := DateOf(time.Date(year, m+1, 0, 0, 0, 0, 0, time.UTC))
+			periods = append(periods,
+				PayPeriod{NewDate(year, m, 1), NewDate(year, m, 15)},
+				PayPeriod{NewDate(year, m, 16), end})
+		}
+	case Weekly, Biweekly:
+		length, count := 7, 52
+		if freq == Biweekly {
+			length, count = 14, 26
+		}
+		start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		for i := 0; i < count; i++ {
+			from := start.AddDate(0, 0, i*length)
+			to := from.AddDate(0, 0, length-1)
+			if i == count-1 {
+				to = time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC)
+			}
+			periods = append(periods, PayPeriod{DateOf(from), DateOf(to)})
+		}
+	default:
+		return nil, fmt.Errorf("unknown pay frequency %q", freq)
+	}
+	return periods, nil
+}
+
+// PayslipLine is one named amount on a payslip
+type PayslipLine struct {
+	Name   string
+	Amount Money
+}
+
+type Payslip struct {
+	Employee   string
+	Company    string
+	Frequency  PayFrequency
+	Period     PayPeriod
+	DaysWorked int
+	Gross      Money
+	PreTax     []PayslipLine
+	Taxable    Money
+	Tax        Money
+	PostTax    []PayslipLine
+	Net        Money
+
+	YTDGross, YTDTax, YTDNet Money
+}
+
+// RunPayroll produces the payslips of emp for year. Pay before start is
+// zero and the period containing start is prorated by calendar days,
+// fixed-amount deductions included. Employee.AnnualSalary is the
+// full-year salary before proration.
+//
+// Pre-tax deductions come out of gross pay and tax is worked out on
+// what remains; post-tax deductions then come out of the pay left after
+// tax. No deduction takes more than is left, so Net is never negative.
+func RunPayroll(cfg *PayrollConfig, emp Employee, freq PayFrequency, start Date, year int) ([]Payslip, error) {
+	annual, err := MoneyFromFloat(emp.AnnualSalary(), cfg.Currency)
+	if err != nil {
+		return nil, err
+	}
+	periods, err := PayPeriods(freq, year)
+	if err != nil {
+		return nil, err
+	}
+	perPeriod := annual.Allocate(len(periods))
+	periodsPerYear := big.NewRat(int64(len(periods)), 1)
+
+	zero := Money{Currency: cfg.Currency}
+	ytdGross, ytdTax, ytdNet := zero, zero, zero
+	var slips []Payslip
+	for i, period := range periods {
+		if period.End.Before(start) {
+			continue
+		}
+		slip := Payslip{
+			Employee:   emp.FullName(),
+			Company:    emp.Company,
+			Frequency:  freq,
+			Period:     period,
+			DaysWorked: period.Days(),
+			Gross:      perPeriod[i],
+		}
+		worked := big.NewRat(1, 1)
+		if period.Start.Before(start) {
+			slip.DaysWorked = start.DaysUntil(period.End) + 1
+			worked = big.NewRat(int64(slip.DaysWorked), int64(period.Days()))
+			slip.Gross = perPeriod[i].Mul(worked)
+		}
+
+		slip.Taxable = slip.Gross
+		slip.PreTax, slip.Taxable = deduct(cfg.Deductions, true, slip.Gross, slip.Taxable, worked)
+
+		// Annualization: tax the period as if it were paid all year
+		yearly := cfg.annualTax(slip.Taxable.Mul(periodsPerYear))
+		slip.Tax = yearly.Mul(new(big.Rat).Inv(periodsPerYear))
+		slip.PostTax, slip.Net = deduct(cfg.Deductions, false, slip.Gross, slip.Taxable.Sub(slip.Tax), worked)
+
+		ytdGross, ytdTax, ytdNet = ytdGross.Add(slip.Gross), ytdTax.Add(slip.Tax), ytdNet.Add(slip.Net)
+		slip.YTDGross, slip.YTDTax, slip.YTDNet = ytdGross, ytdTax, ytdNet
+		slips = append(slips, slip)
+	}
+	return slips, nil
+}
+
+// deduct takes the pre-tax or post-tax deductions out of left and
+// returns their lines and what remains. Rates apply to gross and fixed
+// amounts are scaled by worked, the fraction of the period worked.
+func deduct(deductions []DeductionConfig, preTax bool, gross, left Money, worked *big.Rat) ([]PayslipLine, Money) {
+	var lines []PayslipLine
+	for _, d := range deductions {
+		if d.PreTax != preTax {
+			continue
+		}
+		amount := gross.Mul(ratOr(d.rate))
+		if d.amount != nil {
+			amount = d.amount.Mul(worked)
+		}
+		if amount.Cmp(left) > 0 {
+			amount = left // Never deduct more than is left
+		}
+		lines = append(lines, PayslipLine{d.Name, amount})
+		left = left.Sub(amount)
+	}
+	return lines, left
+}
+
+func ratOr(r *big.Rat) *big.Rat {
+	if r == nil {
+		return new(big.Rat)
+	}
+	return r
+}
+
+// Render writes the payslip as fixed-width text
+func (s Payslip) Render(w io.Writer) error {
+	line := func(label string, m Money) string {
+		return fmt.Sprintf("  %-28s %14s\n", label, m.Decimal())
+	}
+	out := fmt.Sprintf("PAYSLIP %s (%s), %s %s - %s, %d/%d days, %s\n",
+		s.Employee, s.Company, s.Frequency, s.Period.Start, s.Period.End, s.DaysWorked, s.Period.Days(), s.Gross.Currency)
+	out += line("Gross pay", s.Gross)
+	for _, d := range s.PreTax {
+		out += line("- "+d.Name, d.Amount.Neg())
+	}
+	out += line("Taxable pay", s.Taxable)
+	out += line("- Income tax", s.Tax.Neg())
+	for _, d := range s.PostTax {
+		out += line("- "+d.Name, d.Amount.Neg())
+	}
+	out += line("Net pay", s.Net)
+	out += fmt.Sprintf("  YTD gross %s, tax %s, net %s\n", s.YTDGross.Decimal(), s.YTDTax.Decimal(), s.YTDNet.Decimal())
+	_, err := io.WriteString(w, out)
+	return err
+}
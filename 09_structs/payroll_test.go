@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite testdata/payroll/*.golden")
+
+// payrollScenario is one golden-file case; its payslips are compared
+// with testdata/payroll/<name>.golden
+type payrollScenario struct {
+	name      string
+	config    string
+	employee  Employee
+	frequency PayFrequency
+	start     Date
+	year      int
+}
+
+func payrollEmployee(first, last string, monthly float64) Employee {
+	return Employee{
+		Person:  Person{FirstName: first, LastName: last},
+		Company: "Tech Corp",
+		Salary:  monthly,
+	}
+}
+
+var payrollScenarios = []payrollScenario{
+	{"monthly_full_year", "us.json", payrollEmployee("Alice", "Johnson", 5000), Monthly, NewDate(2021, time.May, 3), 2024},
+	{"biweekly_mid_year_join", "us.json", payrollEmployee("Bob", "Stone", 7250.5), Biweekly, NewDate(2024, time.July, 10), 2024},
+	{"semimonthly_join_mid_period", "us.json", payrollEmployee("Carol", "Diaz", 12000), Semimonthly, NewDate(2024, time.March, 20), 2024},
+	{"weekly_jpy_late_join", "jp.json", payrollEmployee("Daisuke", "Sato", 400000), Weekly, NewDate(2024, time.November, 15), 2024},
+}
+
+// TestPayrollGoldens regenerates every scenario and compares it with its
+// golden file. Run with -update to rewrite the golden files instead.
+func TestPayrollGoldens(t *testing.T) {
+	dir := filepath.Join("testdata", "payroll")
+	for _, sc := range payrollScenarios {
+		t.Run(sc.name, func(t *testing.T) {
+			got, err := renderPayrollScenario(dir, sc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join(dir, sc.name+".golden")
+			if *updateGolden {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("output differs from %s:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestRunPayrollNetNeverNegative(t *testing.T) {
+	cfg := &PayrollConfig{
+		Currency: "USD",
+		Brackets: []TaxBracket{{Rate: "0.30"}},
+		Deductions: []DeductionConfig{
+			{Name: "Pension", Rate: "0.10", PreTax: true},
+			{Name: "Loan repayment", Amount: "1000.00"},
+		},
+	}
+	if err := cfg.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	slips, err := RunPayroll(cfg, payrollEmployee("Eve", "Low", 1000), Monthly, NewDate(2024, time.January, 1), 2024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero := Money{Currency: "USD"}
+	slip := slips[0]
+	// 1000 gross, 100 pension, 270 tax leaves 630 for the loan
+	if slip.Tax.Decimal() != "270.00" {
+		t.Errorf("tax = %s, want 270.00", slip.Tax.Decimal())
+	}
+	if slip.PostTax[0].Amount.Decimal() != "630.00" || slip.Net.Cmp(zero) != 0 {
+		t.Errorf("loan %s, net %s; want 630.00 and 0.00", slip.PostTax[0].Amount.Decimal(), slip.Net.Decimal())
+	}
+}
+
+func TestRunPayrollProratesFixedDeductions(t *testing.T) {
+	cfg := &PayrollConfig{
+		Currency:   "USD",
+		Brackets:   []TaxBracket{{Rate: "0"}},
+		Deductions: []DeductionConfig{{Name: "Union dues", Amount: "30.00"}},
+	}
+	if err := cfg.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	// Joining on 21 June works 10 of June's 30 days
+	slips, err := RunPayroll(cfg, payrollEmployee("Finn", "Late", 3000), Monthly, NewDate(2024, time.June, 21), 2024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := slips[0].PostTax[0].Amount; got.Decimal() != "10.00" {
+		t.Errorf("first period dues = %s, want 10.00", got.Decimal())
+	}
+	if got := slips[1].PostTax[0].Amount; got.Decimal() != "30.00" {
+		t.Errorf("full period dues = %s, want 30.00", got.Decimal())
+	}
+}
+
+func renderPayrollScenario(dir string, sc payrollScenario) ([]byte, error) {
+	cfg, err := LoadPayrollConfig(filepath.Join(dir, sc.config))
+	if err != nil {
+		return nil, err
+	}
+	slips, err := RunPayroll(cfg, sc.employee, sc.frequency, sc.start, sc.year)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for _, slip := range slips {
+		if err := slip.Render(&buf); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
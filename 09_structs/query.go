@@ -0,0 +1,573 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+var ErrQueryField = errors.New("query: no such field")
+
+// Record is one projected or aggregated row
+type Record map[string]any
+
+// Query is a pipeline over a slice of structs. Fields are named as in Go
+// and may be promoted from embedded structs (City on an Employee),
+// dotted (Left.City on a join) or zero-argument methods (FullName).
+// The first error is kept and returned by the final call, like
+// ComputerBuilder.
+type Query[T any] struct {
+	items []T
+	err   error
+}
+
+// From starts a query; items is never modified
+func From[T any](items []T) Query[T] {
+	return Query[T]{items: items}
+}
+
+func (q Query[T]) Where(pred func(T) bool) Query[T] {
+	if q.err != nil {
+		return q
+	}
+	var kept []T
+	for _, item := range q.items {
+		if pred(item) {
+			kept = append(kept, item)
+		}
+	}
+	return Query[T]{items: kept}
+}
+
+// OrderBy sorts by each field in turn; a leading "-" sorts that field
+// descending. The sort is stable, so equal rows keep their order.
+func (q Query[T]) OrderBy(fields ...string) Query[T] {
+	if q.err != nil {
+		return q
+	}
+	type sortKey struct {
+		path string
+		desc bool
+	}
+	keys := make([]sortKey, len(fields))
+	for i, f := range fields {
+		path, desc := strings.CutPrefix(strings.TrimSpace(f), "-")
+		keys[i] = sortKey{path, desc}
+	}
+
+	// Resolve every key once rather than on each comparison
+	values := make([][]reflect.Value, len(q.items))
+	for i, item := range q.items {
+		values[i] = make([]reflect.Value, len(keys))
+		for j, k := range keys {
+			v, err := queryField(reflect.ValueOf(item), k.path)
+			if err != nil {
+				return Query[T]{err: err}
+			}
+			values[i][j] = v
+		}
+	}
+	order := make([]int, len(q.items))
+	for i := range order {
+		order[i] = i
+	}
+	var sortErr error
+	slices.SortStableFunc(order, func(a, b int) int {
+		for j, k := range keys {
+			c, err := compareQueryValues(values[a][j], values[b][j])
+			if err != nil {
+				sortErr = fmt.Errorf("query: order by %s: %w", k.path, err)
+				return 0
+			}
+			if k.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+	if sortErr != nil {
+		return Query[T]{err: sortErr}
+	}
+	sorted := make([]T, len(order))
+	for i, idx := range order {
+		sorted[i] = q.items[idx]
+	}
+	return Query[T]{items: sorted}
+}
+
+// Limit keeps the first n rows
+func (q Query[T]) Limit(n int) Query[T] {
+	if q.err != nil || n >= len(q.items) {
+		return q
+	}
+	return Query[T]{items: q.items[:max(n, 0):max(n, 0)]}
+}
+
+func (q Query[T]) All() ([]T, error) {
+	return q.items, q.err
+}
+
+func (q Query[T]) Count() (int, error) {
+	return len(q.items), q.err
+}
+
+// Select projects each row into a Record. A field may be renamed with
+// "as", as in "Right.Street as Office"; otherwise the key is the field
+// as written.
+func (q Query[T]) Select(fields ...string) ([]Record, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	rows := make([]Record, len(q.items))
+	for i, item := range q.items {
+		rows[i] = make(Record, len(fields))
+		for _, f := range fields {
+			path, name := parseProjection(f)
+			v, err := queryField(reflect.ValueOf(item), path)
+			if err != nil {
+				return nil, err
+			}
+			rows[i][name] = queryInterface(v)
+		}
+	}
+	return rows, nil
+}
+
+// SelectInto projects each row into an R, usually an anonymous struct
+// such as struct{ FirstName, City string }. Each field of R is filled
+// from the field of the same name, or from the path in its query tag.
+func SelectInto[R, T any](q Query[T]) ([]R, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	rt := reflect.TypeFor[R]()
+	if rt.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("query: SelectInto needs a struct type, not %s", rt)
+	}
+	out := make([]R, len(q.items))
+	for i, item := range q.items {
+		dst := reflect.ValueOf(&out[i]).Elem()
+		for j := 0; j < rt.NumField(); j++ {
+			sf := rt.Field(j)
+			if !sf.IsExported() {
+				continue
+			}
+			path := sf.Tag.Get("query")
+			if path == "" {
+				path = sf.Name
+			}
+			v, err := queryField(reflect.ValueOf(item), path)
+			if err != nil {
+				return nil, err
+			}
+			if err := assignQueryValue(dst.Field(j), v); err != nil {
+				return nil, fmt.Errorf("query: %s into %s: %w", path, sf.Name, err)
+			}
+		}
+	}
+	return out, nil
+}
+
+func parseProjection(f string) (path, name string) {
+	f = strings.TrimSpace(f)
+	for _, sep := range []string{" as ", " AS "} {
+		if path, name, ok := strings.Cut(f, sep); ok {
+			return strings.TrimSpace(path), strings.TrimSpace(name)
+		}
+	}
+	return f, f
+}
+
+// Grouping is a query split into groups by key fields, waiting for
+// Aggregate
+type Grouping[T any] struct {
+	q    Query[T]
+	keys []string
+}
+
+func (q Query[T]) GroupBy(fields ...string) Grouping[T] {
+	return Grouping[T]{q: q, keys: fields}
+}
+
+// Aggregate returns one Record per group, in order of each group's
+// first row, holding the key fields and the aggregates. The result is a
+// Query itself, so it can be filtered and ordered further.
+func (g Grouping[T]) Aggregate(aggs ...Aggregate) Query[Record] {
+	if g.q.err != nil {
+		return Query[Record]{err: g.q.err}
+	}
+	type group struct {
+		key  Record
+		rows []reflect.Value
+	}
+	var groups []*group
+	index := make(map[string]*group)
+	for _, item := range g.q.items {
+		key := make(Record, len(g.keys))
+		var id strings.Builder
+		for _, f := range g.keys {
+			path, name := parseProjection(f)
+			v, err := queryField(reflect.ValueOf(item), path)
+			if err != nil {
+				return Query[Record]{err: err}
+			}
+			key[name] = queryInterface(v)
+			fmt.Fprintf(&id, "%#v\x00", key[name])
+		}
+		grp, ok := index[id.String()]
+		if !ok {
+			grp = &group{key: key}
+			index[id.String()] = grp
+			groups = append(groups, grp)
+		}
+		grp.rows = append(grp.rows, reflect.ValueOf(item))
+	}
+
+	rows := make([]Record, len(groups))
+	for i, grp := range groups {
+		rows[i] = grp.key
+		for _, a := range aggs {
+			v, err := a.apply(grp.rows)
+			if err != nil {
+				return Query[Record]{err: fmt.Errorf("query: %s: %w", a.name, err)}
+			}
+			rows[i][a.name] = v
+		}
+	}
+	return From(rows)
+}
+
+// Aggregate computes one value over the rows of a group
+type Aggregate struct {
+	name  string
+	field string
+	kind  string
+}
+
+// Count counts rows; the result is an int named "Count"
+func Count() Aggregate { return Aggregate{name: "Count", kind: "count"} }
+
+// Sum adds numbers as float64, or other values with their Add method
+// (such as Money)
+func Sum(field string) Aggregate { return Aggregate{"Sum" + field, field, "sum"} }
+
+// Avg is the float64 mean of a numeric field
+func Avg(field string) Aggregate { return Aggregate{"Avg" + field, field, "avg"} }
+
+// Min and Max order values as OrderBy does
+func Min(field string) Aggregate { return Aggregate{"Min" + field, field, "min"} }
+
+func Max(field string) Aggregate { return Aggregate{"Max" + field, field, "max"} }
+
+// As renames the result column
+func (a Aggregate) As(name string) Aggregate {
+	a.name = name
+	return a
+}
+
+func (a Aggregate) apply(rows []reflect.Value) (any, error) {
+	if a.kind == "count" {
+		return len(rows), nil
+	}
+	values := make([]reflect.Value, 0, len(rows))
+	for _, row := range rows {
+		v, err := queryField(row, a.field)
+		if err != nil {
+			return nil, err
+		}
+		if v.IsValid() {
+			values = append(values, v) // nil pointers are skipped, as NULL in SQL
+		}
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	switch a.kind {
+	case "min", "max":
+		best := values[0]
+		for _, v := range values[1:] {
+			c, err := compareQueryValues(v, best)
+			if err != nil {
+				return nil, err
+			}
+			if (a.kind == "min" && c < 0) || (a.kind == "max" && c > 0) {
+				best = v
+			}
+		}
+		return best.Interface(), nil
+
+	case "sum", "avg":
+		if add := values[0].MethodByName("Add"); a.kind == "sum" && add.IsValid() && !isQueryNumber(values[0]) {
+			total := values[0]
+			for _, v := range values[1:] {
+				out, err := callQueryMethod(total.MethodByName("Add"), v)
+				if err != nil {
+					return nil, err
+				}
+				total = out
+			}
+			return total.Interface(), nil
+		}
+		total := 0.0
+		for _, v := range values {
+			f, ok := queryFloat(v)
+			if !ok {
+				return nil, fmt.Errorf("cannot add %s values", v.Type())
+			}
+			total += f
+		}
+		if a.kind == "avg" {
+			return total / float64(len(values)), nil
+		}
+		return total, nil
+	}
+	return nil, fmt.Errorf("unknown aggregate %q", a.kind)
+}
+
+// Joined is one row of a join. A LeftJoin row without a match has the
+// zero Right and Matched false.
+type Joined[L, R any] struct {
+	Left    L
+	Right   R
+	Matched bool
+}
+
+// Join pairs every left row with every right row whose rightField equals
+// its leftField, as an SQL inner join
+func Join[L, R any](left Query[L], right []R, leftField, rightField string) Query[Joined[L, R]] {
+	return join(left, right, leftField, rightField, false)
+}
+
+// LeftJoin is Join that also keeps left rows with no match
+func LeftJoin[L, R any](left Query[L], right []R, leftField, rightField string) Query[Joined[L, R]] {
+	return join(left, right, leftField, rightField, true)
+}
+
+func join[L, R any](left Query[L], right []R, leftField, rightField string, keepUnmatched bool) Query[Joined[L, R]] {
+	if left.err != nil {
+		return Query[Joined[L, R]]{err: left.err}
+	}
+	byKey := make(map[any][]int)
+	for i, r := range right {
+		k, err := joinKey(r, rightField)
+		if err != nil {
+			return Query[Joined[L, R]]{err: err}
+		}
+		if k != nil {
+			byKey[k] = append(byKey[k], i)
+		}
+	}
+	var rows []Joined[L, R]
+	for _, l := range left.items {
+		k, err := joinKey(l, leftField)
+		if err != nil {
+			return Query[Joined[L, R]]{err: err}
+		}
+		matches := byKey[k]
+		if k == nil {
+			matches = nil // nil never equals nil, as NULL in SQL
+		}
+		for _, i := range matches {
+			rows = append(rows, Joined[L, R]{Left: l, Right: right[i], Matched: true})
+		}
+		if len(matches) == 0 && keepUnmatched {
+			rows = append(rows, Joined[L, R]{Left: l})
+		}
+	}
+	return From(rows)
+}
+
+func joinKey(item any, field string) (any, error) {
+	v, err := queryField(reflect.ValueOf(item), field)
+	if err != nil {
+		return nil, err
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if !v.Type().Comparable() {
+		return nil, fmt.Errorf("query: join on %s: %s values are not comparable", field, v.Type())
+	}
+	return v.Interface(), nil
+}
+
+// queryField resolves a dotted path on v. A nil pointer along the way
+// gives an invalid Value, which callers treat as null.
+func queryField(v reflect.Value, path string) (reflect.Value, error) {
+	for _, name := range strings.Split(path, ".") {
+		for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return reflect.Value{}, nil
+			}
+			v = v.Elem()
+		}
+		if !v.IsValid() {
+			return v, nil
+		}
+		if m := v.MethodByName(name); m.IsValid() && m.Type().NumIn() == 0 && m.Type().NumOut() == 1 {
+			v = m.Call(nil)[0]
+			continue
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			sf, ok := v.Type().FieldByName(name)
+			if !ok || !sf.IsExported() {
+				return reflect.Value{}, fmt.Errorf("%w %s on %s", ErrQueryField, name, v.Type())
+			}
+			f, err := v.FieldByIndexErr(sf.Index)
+			if err != nil {
+				return reflect.Value{}, nil // Through a nil embedded pointer
+			}
+			v = f
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return reflect.Value{}, fmt.Errorf("%w %s on %s", ErrQueryField, name, v.Type())
+			}
+			e := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+			if !e.IsValid() {
+				return reflect.Value{}, fmt.Errorf("%w %s", ErrQueryField, name)
+			}
+			v = e
+		default:
+			return reflect.Value{}, fmt.Errorf("%w %s on %s", ErrQueryField, name, v.Type())
+		}
+	}
+	for v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v, nil
+}
+
+func queryInterface(v reflect.Value) any {
+	if !v.IsValid() || (v.Kind() == reflect.Interface && v.IsNil()) {
+		return nil
+	}
+	return v.Interface()
+}
+
+func isQueryNumber(v reflect.Value) bool {
+	_, ok := queryFloat(v)
+	return ok
+}
+
+func queryFloat(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// compareQueryValues orders two values: nil first, then numbers, strings
+// and bools by kind, and other types by a Compare or Cmp method
+// returning int (time.Time, Money) or a Before method (Date)
+func compareQueryValues(a, b reflect.Value) (int, error) {
+	switch {
+	case !a.IsValid() && !b.IsValid():
+		return 0, nil
+	case !a.IsValid():
+		return -1, nil
+	case !b.IsValid():
+		return 1, nil
+	}
+	if fa, ok := queryFloat(a); ok {
+		if fb, ok := queryFloat(b); ok {
+			if a.Kind() == b.Kind() && a.CanInt() {
+				return cmp.Compare(a.Int(), b.Int()), nil // Exact beyond 2^53
+			}
+			return cmp.Compare(fa, fb), nil
+		}
+	}
+	if a.Type() != b.Type() {
+		return 0, fmt.Errorf("cannot compare %s with %s", a.Type(), b.Type())
+	}
+	switch a.Kind() {
+	case reflect.String:
+		return strings.Compare(a.String(), b.String()), nil
+	case reflect.Bool:
+		return cmp.Compare(boolRank(a.Bool()), boolRank(b.Bool())), nil
+	}
+	for _, name := range []string{"Compare", "Cmp"} {
+		if m := a.MethodByName(name); m.IsValid() && takesQueryArg(m, b) {
+			out, err := callQueryMethod(m, b)
+			if err != nil {
+				return 0, err
+			}
+			if out.Kind() == reflect.Int {
+				return int(out.Int()), nil
+			}
+		}
+	}
+	if m := a.MethodByName("Before"); m.IsValid() {
+		before, err := callQueryMethod(m, b)
+		if err == nil && before.Kind() == reflect.Bool {
+			if before.Bool() {
+				return -1, nil
+			}
+			after, _ := callQueryMethod(b.MethodByName("Before"), a)
+			if after.Bool() {
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	return 0, fmt.Errorf("%s values are not ordered", a.Type())
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// callQueryMethod calls a one-argument, one-result method such as
+// Compare, Before or Add. A panic in the method, like Money's on mixed
+// currencies, is returned as an error.
+func callQueryMethod(m, arg reflect.Value) (out reflect.Value, err error) {
+	if !takesQueryArg(m, arg) {
+		return reflect.Value{}, fmt.Errorf("method %s does not take a %s", m.Type(), arg.Type())
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = reflect.Value{}, fmt.Errorf("%v", r)
+		}
+	}()
+	return m.Call([]reflect.Value{arg})[0], nil
+}
+
+func takesQueryArg(m, arg reflect.Value) bool {
+	t := m.Type()
+	return t.NumIn() == 1 && t.NumOut() == 1 && arg.Type().AssignableTo(t.In(0))
+}
+
+// assignQueryValue stores v in dst, converting between compatible kinds
+// such as float64 and int, and leaves dst zero for null
+func assignQueryValue(dst, v reflect.Value) error {
+	if !v.IsValid() {
+		dst.SetZero()
+		return nil
+	}
+	switch {
+	case v.Type().AssignableTo(dst.Type()):
+		dst.Set(v)
+	case isQueryNumber(v) && isQueryNumber(reflect.Zero(dst.Type())):
+		dst.Set(v.Convert(dst.Type()))
+	case dst.Kind() == reflect.String && v.Type().Implements(reflect.TypeFor[fmt.Stringer]()):
+		dst.SetString(v.Interface().(fmt.Stringer).String())
+	default:
+		return fmt.Errorf("cannot assign %s to %s", v.Type(), dst.Type())
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func queryStaff() []Employee {
+	employee := func(id, first, city, dept string, salary float64) Employee {
+		return Employee{
+			Person:     Person{FirstName: first, LastName: "Doe"},
+			Address:    Address{City: city},
+			ID:         id,
+			Department: dept,
+			Salary:     salary,
+		}
+	}
+	return []Employee{
+		employee("E1", "Ann", "Chicago", "Sales", 4000),
+		employee("E2", "Bob", "Austin", "Engineering", 7000),
+		employee("E3", "Cid", "Chicago", "Engineering", 9000),
+		employee("E4", "Dee", "Austin", "Sales", 7000),
+		employee("E5", "Eve", "Boston", "Engineering", 6000),
+	}
+}
+
+func queryIDs(t *testing.T, q Query[Employee]) []string {
+	t.Helper()
+	staff, err := q.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(staff))
+	for i, e := range staff {
+		ids[i] = e.ID
+	}
+	return ids
+}
+
+func TestQueryOrderBy(t *testing.T) {
+	staff := queryStaff()
+	tests := []struct {
+		fields []string
+		want   []string
+	}{
+		{[]string{"City"}, []string{"E2", "E4", "E5", "E1", "E3"}},
+		{[]string{"City", "-Salary"}, []string{"E2", "E4", "E5", "E3", "E1"}},
+		{[]string{"-Salary", "FirstName"}, []string{"E3", "E2", "E4", "E5", "E1"}},
+		{[]string{"-Salary", "-FirstName"}, []string{"E3", "E4", "E2", "E5", "E1"}},
+		{[]string{"Department", "-City", "ID"}, []string{"E3", "E5", "E2", "E1", "E4"}},
+	}
+	for _, tt := range tests {
+		if got := queryIDs(t, From(staff).OrderBy(tt.fields...)); !slices.Equal(got, tt.want) {
+			t.Errorf("OrderBy(%q) = %v, want %v", tt.fields, got, tt.want)
+		}
+	}
+	if staff[0].ID != "E1" {
+		t.Error("OrderBy sorted the caller's slice")
+	}
+
+	top := From(staff).Where(func(e Employee) bool { return e.Department == "Engineering" }).OrderBy("-Salary").Limit(2)
+	if got := queryIDs(t, top); !slices.Equal(got, []string{"E3", "E2"}) {
+		t.Errorf("top two engineers = %v, want [E3 E2]", got)
+	}
+}
+
+// payRow has the non-numeric types aggregates must handle
+type payRow struct {
+	Team   string
+	Pay    Money
+	Joined Date
+}
+
+func TestQueryAggregate(t *testing.T) {
+	usd := func(cents int64) Money { return Money{Amount: cents, Currency: "USD"} }
+	rows := []payRow{
+		{"red", usd(1000), NewDate(2021, time.March, 1)},
+		{"blue", usd(500), NewDate(2020, time.January, 5)},
+		{"red", usd(2500), NewDate(2019, time.July, 9)},
+		{"red", usd(1500), NewDate(2022, time.May, 2)},
+	}
+	got, err := From(rows).
+		GroupBy("Team").
+		Aggregate(Count(), Sum("Pay"), Min("Pay"), Max("Pay"), Min("Joined").As("First"), Max("Joined").As("Last")).
+		All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{"Team": "red", "Count": 3, "SumPay": usd(5000), "MinPay": usd(1000), "MaxPay": usd(2500),
+			"First": NewDate(2019, time.July, 9), "Last": NewDate(2022, time.May, 2)},
+		{"Team": "blue", "Count": 1, "SumPay": usd(500), "MinPay": usd(500), "MaxPay": usd(500),
+			"First": NewDate(2020, time.January, 5), "Last": NewDate(2020, time.January, 5)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Aggregate =\n  %v\nwant\n  %v", got, want)
+	}
+
+	departments, err := From(queryStaff()).
+		GroupBy("Department as Dept").
+		Aggregate(Count(), Sum("Salary"), Avg("Salary"), Min("Salary"), Max("Salary")).
+		OrderBy("-Count").
+		Select("Dept", "Count", "SumSalary", "AvgSalary", "MinSalary", "MaxSalary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDepartments := []Record{
+		{"Dept": "Engineering", "Count": 3, "SumSalary": 22000.0, "AvgSalary": 22000.0 / 3, "MinSalary": 6000.0, "MaxSalary": 9000.0},
+		{"Dept": "Sales", "Count": 2, "SumSalary": 11000.0, "AvgSalary": 5500.0, "MinSalary": 4000.0, "MaxSalary": 7000.0},
+	}
+	if !reflect.DeepEqual(departments, wantDepartments) {
+		t.Errorf("departments =\n  %v\nwant\n  %v", departments, wantDepartments)
+	}
+}
+
+func TestQueryMixedCurrencies(t *testing.T) {
+	rows := []payRow{
+		{Team: "red", Pay: Money{Amount: 1000, Currency: "USD"}},
+		{Team: "red", Pay: Money{Amount: 1000, Currency: "EUR"}},
+	}
+	if _, err := From(rows).GroupBy("Team").Aggregate(Sum("Pay")).All(); err == nil {
+		t.Error("Sum over USD and EUR succeeded")
+	}
+	if _, err := From(rows).GroupBy("Team").Aggregate(Max("Pay")).All(); err == nil {
+		t.Error("Max over USD and EUR succeeded")
+	}
+	if _, err := From(rows).OrderBy("Pay").All(); err == nil {
+		t.Error("OrderBy over USD and EUR succeeded")
+	}
+}
+
+func TestSelectInto(t *testing.T) {
+	got, err := SelectInto[struct {
+		Name   string `query:"FullName"`
+		Team   string `query:"Department"`
+		City   string
+		Salary int
+		hidden string
+	}](From(queryStaff()).Where(func(e Employee) bool { return e.City == "Chicago" }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d rows, want 2", len(got))
+	}
+	if got[0].Name != "Ann Doe" || got[0].Team != "Sales" || got[0].City != "Chicago" || got[0].Salary != 4000 {
+		t.Errorf("first row = %+v", got[0])
+	}
+	if got[1].Name != "Cid Doe" || got[1].Salary != 9000 {
+		t.Errorf("second row = %+v", got[1])
+	}
+
+	_, err = SelectInto[struct {
+		Salary bool
+	}](From(queryStaff()))
+	if err == nil {
+		t.Error("SelectInto converted a float64 into a bool")
+	}
+}
+
+func TestQueryJoin(t *testing.T) {
+	offices := []Address{
+		{Street: "1 Loop Rd", City: "Chicago"},
+		{Street: "2 River St", City: "Chicago"},
+		{Street: "3 Lake Ave", City: "Austin"},
+		{Street: "4 Harbor Way", City: "Denver"},
+	}
+	type desk struct {
+		ID, Office string
+		Matched    bool
+	}
+	deskQuery := func(q Query[Joined[Employee, Address]]) []desk {
+		t.Helper()
+		rows, err := SelectInto[struct {
+			ID      string `query:"Left.ID"`
+			Office  string `query:"Right.Street"`
+			Matched bool
+		}](q.OrderBy("Left.ID", "Right.Street"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		desks := make([]desk, len(rows))
+		for i, r := range rows {
+			desks[i] = desk(r)
+		}
+		return desks
+	}
+
+	inner := deskQuery(Join(From(queryStaff()), offices, "City", "City"))
+	wantInner := []desk{
+		{"E1", "1 Loop Rd", true},
+		{"E1", "2 River St", true},
+		{"E2", "3 Lake Ave", true},
+		{"E3", "1 Loop Rd", true},
+		{"E3", "2 River St", true},
+		{"E4", "3 Lake Ave", true},
+	}
+	if !slices.Equal(inner, wantInner) {
+		t.Errorf("Join =\n  %v\nwant\n  %v", inner, wantInner)
+	}
+
+	left := deskQuery(LeftJoin(From(queryStaff()), offices, "City", "City"))
+	wantLeft := append(slices.Clone(wantInner), desk{"E5", "", false})
+	if !slices.Equal(left, wantLeft) {
+		t.Errorf("LeftJoin =\n  %v\nwant\n  %v", left, wantLeft)
+	}
+}
+
+func TestQueryUnknownField(t *testing.T) {
+	staff := queryStaff()
+	errs := map[string]error{}
+	_, errs["OrderBy"] = From(staff).OrderBy("Salary", "Bonus").Where(func(Employee) bool { return true }).All()
+	_, errs["Select"] = From(staff).Select("ID", "Address.Zip")
+	_, errs["GroupBy"] = From(staff).GroupBy("Team").Aggregate(Count()).All()
+	_, errs["Sum"] = From(staff).GroupBy("City").Aggregate(Sum("Bonus")).All()
+	_, errs["SelectInto"] = SelectInto[struct {
+		Name string `query:"Nickname"`
+	}](From(staff))
+	_, errs["Join"] = Join(From(staff), []Address{{City: "Austin"}}, "City", "Town").All()
+	_, errs["unexported"] = From([]struct{ name string }{{"x"}}).Select("name")
+	for name, err := range errs {
+		if !errors.Is(err, ErrQueryField) {
+			t.Errorf("%s: err = %v, want ErrQueryField", name, err)
+		}
+	}
+}
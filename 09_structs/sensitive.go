@@ -0,0 +1,570 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrUnknownKey     = errors.New("unknown encryption key")
+	ErrDecrypt        = errors.New("sealed field cannot be decrypted")
+	ErrKeyFileExposed = errors.New("key file is readable by other users")
+	ErrActiveKey      = errors.New("the active key cannot be retired")
+	ErrNotSealed      = errors.New("encrypted field is stored in plaintext")
+)
+
+// The sensitive tag marks fields that must not leak:
+//
+//	sensitive:"redact"            hidden as [REDACTED] in %v and logs
+//	sensitive:"mask=email"        shown as j***@example.com
+//	sensitive:"mask=last4"        shown as ****1234
+//	sensitive:"encrypt"           also sealed with AES-GCM by KeyRing.Marshal
+//
+// Options combine, as in sensitive:"encrypt,mask=email".
+type sensitiveTag struct {
+	encrypt bool
+	mask    string // "" for redact
+}
+
+func parseSensitive(tag reflect.StructTag) (sensitiveTag, bool) {
+	v, ok := tag.Lookup("sensitive")
+	if !ok {
+		return sensitiveTag{}, false
+	}
+	var s sensitiveTag
+	for _, opt := range strings.Split(v, ",") {
+		switch name, arg, _ := strings.Cut(strings.TrimSpace(opt), "="); name {
+		case "encrypt":
+			s.encrypt = true
+		case "mask":
+			s.mask = arg
+		}
+	}
+	return s, true
+}
+
+const redacted = "[REDACTED]"
+
+// display is what logs and %v show for a sensitive string; empty values
+// stay empty so missing data is still visible
+func (s sensitiveTag) display(v reflect.Value) string {
+	str, isString := "", v.Kind() == reflect.String
+	if isString {
+		str = v.String()
+	}
+	if isString && str == "" {
+		return ""
+	}
+	switch {
+	case s.mask == "email" && isString:
+		local, domain, ok := strings.Cut(str, "@")
+		if !ok || local == "" {
+			return redacted
+		}
+		first, _ := utf8.DecodeRuneInString(local)
+		return string(first) + "***@" + domain
+	case s.mask == "last4" && isString:
+		r := []rune(str)
+		if len(r) <= 4 {
+			return strings.Repeat("*", len(r))
+		}
+		return "****" + string(r[len(r)-4:])
+	}
+	return redacted
+}
+
+// formatRedacted prints a struct the way fmt does for %v, %+v and %#v,
+// but with sensitive fields redacted or masked. Types call it from
+// their Format method.
+func formatRedacted(f fmt.State, verb rune, v any) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			fmt.Fprint(f, "<nil>")
+			return
+		}
+		rv = rv.Elem()
+	}
+	t := rv.Type()
+	goSyntax := verb == 'v' && f.Flag('#')
+	names := f.Flag('+') || goSyntax
+
+	var b strings.Builder
+	if goSyntax {
+		b.WriteString(t.String())
+	}
+	b.WriteByte('{')
+	first := true
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		if !first && goSyntax {
+			b.WriteString(", ")
+		} else if !first {
+			b.WriteString(" ")
+		}
+		first = false
+		if names {
+			b.WriteString(sf.Name + ":")
+		}
+		fv := rv.Field(i)
+		if s, ok := parseSensitive(sf.Tag); ok {
+			text := s.display(fv)
+			if goSyntax {
+				text = strconv.Quote(text)
+			}
+			b.WriteString(text)
+			continue
+		}
+		switch {
+		case goSyntax:
+			fmt.Fprintf(&b, "%#v", fv.Interface())
+		case f.Flag('+'):
+			fmt.Fprintf(&b, "%+v", fv.Interface())
+		default:
+			fmt.Fprintf(&b, "%v", fv.Interface())
+		}
+	}
+	b.WriteByte('}')
+	fmt.Fprint(f, b.String())
+}
+
+// redactedLogValue is the slog form of a struct: its json members, with
+// sensitive ones redacted or masked
+func redactedLogValue(v any) slog.Value {
+	rv := reflect.ValueOf(v)
+	var attrs []slog.Attr
+	for _, f := range patchFields(rv.Type()) {
+		fv := patchFieldValue(rv, f, false)
+		if !fv.IsValid() {
+			continue
+		}
+		if s, ok := parseSensitive(rv.Type().FieldByIndex(f.index).Tag); ok {
+			attrs = append(attrs, slog.String(f.name, s.display(fv)))
+			continue
+		}
+		attrs = append(attrs, slog.Any(f.name, fv.Interface()))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func (u User) Format(f fmt.State, verb rune) { formatRedacted(f, verb, u) }
+
+func (u User) LogValue() slog.Value { return redactedLogValue(u) }
+
+// KeyRing holds the AES-256 keys for sealed fields. New values are
+// sealed with the active key; older keys stay until Retire so values
+// sealed before a Rotate can still be opened.
+type KeyRing struct {
+	mu     sync.RWMutex
+	path   string // "" for a ring that only lives in memory
+	active string
+	keys   []ringKey
+}
+
+type ringKey struct {
+	ID      string    `json:"id"`
+	Key     []byte    `json:"key"` // base64 in the file
+	Created time.Time `json:"created"`
+}
+
+type keyFile struct {
+	Active string    `json:"active"`
+	Keys   []ringKey `json:"keys"`
+}
+
+// NewKeyRing returns an in-memory ring with one fresh key
+func NewKeyRing() (*KeyRing, error) {
+	k := &KeyRing{}
+	if _, err := k.addKey(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// OpenKeyRing loads the key file at path, creating it with one key if it
+// does not exist. The file must not be readable by group or others.
+func OpenKeyRing(path string) (*KeyRing, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		k, err := NewKeyRing()
+		if err != nil {
+			return nil, err
+		}
+		k.path = path
+		return k, k.save()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("%s: %w (mode %v)", path, ErrKeyFileExposed, info.Mode().Perm())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var kf keyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	k := &KeyRing{path: path, active: kf.Active, keys: kf.Keys}
+	for _, key := range k.keys {
+		if len(key.Key) != 32 {
+			return nil, fmt.Errorf("%s: key %s is %d bytes, want 32", path, key.ID, len(key.Key))
+		}
+	}
+	if _, ok := k.key(k.active); !ok {
+		return nil, fmt.Errorf("%s: active key %q: %w", path, k.active, ErrUnknownKey)
+	}
+	return k, nil
+}
+
+// Active returns the id of the key new values are sealed with
+func (k *KeyRing) Active() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+// KeyIDs lists every key, oldest first
+func (k *KeyRing) KeyIDs() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	ids := make([]string, len(k.keys))
+	for i, key := range k.keys {
+		ids[i] = key.ID
+	}
+	return ids
+}
+
+// Rotate adds a new key and makes it active. Values sealed with older
+// keys still open; reseal them (FileUserRepository.Reseal) before
+// retiring the old key.
+func (k *KeyRing) Rotate() (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	prev, prevKeys := k.active, k.keys
+	id, err := k.addKey()
+	if err != nil {
+		return "", err
+	}
+	if err := k.save(); err != nil {
+		k.active, k.keys = prev, prevKeys
+		return "", err
+	}
+	return id, nil
+}
+
+// Retire deletes a key that nothing is sealed with any more
+func (k *KeyRing) Retire(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if id == k.active {
+		return fmt.Errorf("%s: %w", id, ErrActiveKey)
+	}
+	i := slices.IndexFunc(k.keys, func(key ringKey) bool { return key.ID == id })
+	if i < 0 {
+		return fmt.Errorf("%s: %w", id, ErrUnknownKey)
+	}
+	prevKeys := k.keys
+	k.keys = slices.Delete(slices.Clone(k.keys), i, i+1)
+	if err := k.save(); err != nil {
+		k.keys = prevKeys
+		return err
+	}
+	return nil
+}
+
+// addKey needs k.mu held, or k not yet shared
+func (k *KeyRing) addKey() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	n := 1
+	for _, key := range k.keys {
+		if v, err := strconv.Atoi(strings.TrimPrefix(key.ID, "k")); err == nil && v >= n {
+			n = v + 1
+		}
+	}
+	id := "k" + strconv.Itoa(n)
+	k.keys = append(slices.Clip(k.keys), ringKey{ID: id, Key: secret, Created: time.Now().UTC()})
+	k.active = id
+	return id, nil
+}
+
+func (k *KeyRing) key(id string) ([]byte, bool) {
+	for _, key := range k.keys {
+		if key.ID == id {
+			return key.Key, true
+		}
+	}
+	return nil, false
+}
+
+// save writes the key file atomically with mode 0600
+func (k *KeyRing) save() error {
+	if k.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(keyFile{Active: k.active, Keys: k.keys}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(k.path), filepath.Base(k.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), k.path)
+}
+
+// sealedPrefix starts every sealed value: enc:v1:<key id>:<base64 of
+// nonce and ciphertext>
+const sealedPrefix = "enc:v1:"
+
+// seal encrypts the JSON encoding of one member. The record and member
+// path are authenticated too, so a sealed value copied into another
+// field, or into the same field of another record, does not open.
+func (k *KeyRing) seal(plain []byte, record, path string) (string, error) {
+	k.mu.RLock()
+	id := k.active
+	secret, _ := k.key(id)
+	k.mu.RUnlock()
+
+	gcm, err := newGCM(secret)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, plain, sealingAAD(id, record, path))
+	return sealedPrefix + id + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// sealingAAD joins the key id, record and path; record is quoted so
+// that no choice of record and path can collide with another
+func sealingAAD(id, record, path string) []byte {
+	return []byte(id + ":" + strconv.Quote(record) + ":" + path)
+}
+
+func (k *KeyRing) open(s, record, path string) ([]byte, error) {
+	id, data, ok := strings.Cut(strings.TrimPrefix(s, sealedPrefix), ":")
+	if !ok {
+		return nil, fmt.Errorf("%s: %w: malformed", path, ErrDecrypt)
+	}
+	k.mu.RLock()
+	secret, found := k.key(id)
+	k.mu.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("%s: key %s: %w", path, id, ErrUnknownKey)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %v", path, ErrDecrypt, err)
+	}
+	gcm, err := newGCM(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%s: %w: too short", path, ErrDecrypt)
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], sealingAAD(id, record, path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, ErrDecrypt)
+	}
+	return plain, nil
+}
+
+func newGCM(secret []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// cryptOp is one Marshal or Unmarshal call
+type cryptOp struct {
+	record     string
+	sealing    bool
+	plainAllow bool // Unmarshal accepts members stored before encryption
+}
+
+// Marshal is json.Marshal with every sensitive:"encrypt" member sealed,
+// however deeply it is nested in structs, slices and maps. record names
+// what v is, such as "user/42", and must be given again to Unmarshal.
+func (k *KeyRing) Marshal(v any, record string) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return k.transform(reflect.TypeOf(v), raw, "", cryptOp{record: record, sealing: true})
+}
+
+// Unmarshal opens sealed members of the record and then decodes as
+// json.Unmarshal does. A sensitive:"encrypt" member that is not sealed
+// is ErrNotSealed.
+func (k *KeyRing) Unmarshal(data []byte, v any, record string) error {
+	return k.unmarshal(data, v, cryptOp{record: record})
+}
+
+// UnmarshalPlaintext is Unmarshal for migrating data written before
+// encryption was enabled: unsealed members are read as they are
+func (k *KeyRing) UnmarshalPlaintext(data []byte, v any, record string) error {
+	return k.unmarshal(data, v, cryptOp{record: record, plainAllow: true})
+}
+
+func (k *KeyRing) unmarshal(data []byte, v any, op cryptOp) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("sensitive: Unmarshal needs a non-nil pointer")
+	}
+	opened, err := k.transform(rv.Type(), data, "", op)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(opened, v)
+}
+
+// encryptedMembers lists the JSON names of t's sensitive:"encrypt"
+// fields
+func encryptedMembers(t reflect.Type) []string {
+	var names []string
+	for _, f := range patchFields(t) {
+		if s, ok := parseSensitive(t.FieldByIndex(f.index).Tag); ok && s.encrypt {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// transform seals (or opens) the sensitive members of raw, the JSON
+// encoding of a t. Paths name members but not indexes, so reordering a
+// slice keeps its values openable.
+func (k *KeyRing) transform(t reflect.Type, raw json.RawMessage, path string, op cryptOp) (json.RawMessage, error) {
+	if t == nil || string(raw) == "null" {
+		return raw, nil
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if isPatchLeaf(t) {
+		return raw, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &members); err != nil {
+			return nil, err
+		}
+		changed := false
+		for _, f := range patchFields(t) {
+			member, ok := members[f.name]
+			if !ok {
+				continue
+			}
+			p := path + "/" + escapePointer(f.name)
+			var out json.RawMessage
+			var err error
+			if s, ok := parseSensitive(t.FieldByIndex(f.index).Tag); ok && s.encrypt {
+				out, err = k.crypt(member, p, op)
+			} else {
+				out, err = k.transform(t.FieldByIndex(f.index).Type, member, p, op)
+			}
+			if err != nil {
+				return nil, err
+			}
+			members[f.name], changed = out, true
+		}
+		if !changed {
+			return raw, nil
+		}
+		return json.Marshal(members)
+
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, err
+		}
+		for i, item := range items {
+			out, err := k.transform(t.Elem(), item, path, op)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = out
+		}
+		return json.Marshal(items)
+
+	case reflect.Map:
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &members); err != nil {
+			return nil, err
+		}
+		for key, member := range members {
+			out, err := k.transform(t.Elem(), member, path+"/*", op)
+			if err != nil {
+				return nil, err
+			}
+			members[key] = out
+		}
+		return json.Marshal(members)
+	}
+	return raw, nil
+}
+
+// crypt seals one member as a JSON string, or opens one
+func (k *KeyRing) crypt(member json.RawMessage, path string, op cryptOp) (json.RawMessage, error) {
+	if string(member) == "null" {
+		return member, nil
+	}
+	if op.sealing {
+		sealed, err := k.seal(member, op.record, path)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(sealed)
+	}
+	var s string
+	if json.Unmarshal(member, &s) != nil || !strings.HasPrefix(s, sealedPrefix) {
+		if op.plainAllow {
+			return member, nil // Written before the field was encrypted
+		}
+		return nil, fmt.Errorf("%s: %w", path, ErrNotSealed)
+	}
+	return k.open(s, op.record, path)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sealedUserFile creates ann and bob in an encrypted repository and
+// returns the file's lines, header first
+func sealedUserFile(t *testing.T, keys *KeyRing) (string, [][]byte) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "users.jsonl")
+	repo, err := OpenEncryptedFileUserRepository(path, keys, RequireSealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, u := range []*User{{Name: "Ann", Email: "ann@example.com"}, {Name: "Bob", Email: "bob@example.com"}} {
+		if err := repo.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+}
+
+// setMember replaces one member of a JSON object line
+func setMember(t *testing.T, line []byte, name string, value json.RawMessage) []byte {
+	t.Helper()
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(line, &members); err != nil {
+		t.Fatal(err)
+	}
+	members[name] = value
+	out, err := json.Marshal(members)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func member(t *testing.T, line []byte, name string) json.RawMessage {
+	t.Helper()
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(line, &members); err != nil {
+		t.Fatal(err)
+	}
+	return members[name]
+}
+
+func TestSealedFieldsAreBoundToTheirRecord(t *testing.T) {
+	keys, err := NewKeyRing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, lines := sealedUserFile(t, keys)
+	// Give Bob Ann's sealed email and password hash
+	for _, name := range []string{"email", "password"} {
+		lines[2] = setMember(t, lines[2], name, member(t, lines[1], name))
+	}
+	if err := os.WriteFile(path, append(bytes.Join(lines, []byte("\n")), '\n'), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenEncryptedFileUserRepository(path, keys, RequireSealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("err = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestEncryptedRepositoryRejectsPlaintext(t *testing.T) {
+	keys, err := NewKeyRing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, lines := sealedUserFile(t, keys)
+	lines[1] = setMember(t, lines[1], "password", json.RawMessage(`"x"`))
+	if err := os.WriteFile(path, append(bytes.Join(lines, []byte("\n")), '\n'), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenEncryptedFileUserRepository(path, keys, RequireSealed); !errors.Is(err, ErrNotSealed) {
+		t.Fatalf("err = %v, want ErrNotSealed", err)
+	}
+	repo, err := OpenEncryptedFileUserRepository(path, keys, MigratePlaintext)
+	if err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	if err := repo.Reseal(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenEncryptedFileUserRepository(path, keys, RequireSealed); err != nil {
+		t.Errorf("after Reseal: %v", err)
+	}
+}
+
+func TestUserFormatRedactsSensitiveFields(t *testing.T) {
+	u := User{ID: 1, Name: "Ann", Email: "ann@example.com", Password: "$pbkdf2-sha256$i=1000,l=32$c2FsdA$aGFzaA"}
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{"%v", []string{"{1 Ann a***@example.com ", " [REDACTED]}"}},
+		{"%+v", []string{"Name:Ann", "Email:a***@example.com", "Password:[REDACTED]"}},
+		{"%#v", []string{"main.User{ID:1, ", `Email:"a***@example.com"`, `Password:"[REDACTED]"`}},
+	}
+	for _, tt := range tests {
+		got := fmt.Sprintf(tt.format, u)
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("Sprintf(%q) = %s, want it to contain %s", tt.format, got, want)
+			}
+		}
+		if strings.Contains(got, "ann@") || strings.Contains(got, "pbkdf2") {
+			t.Errorf("Sprintf(%q) leaks a secret: %s", tt.format, got)
+		}
+	}
+	if got := fmt.Sprintf("%+v", User{Name: "Nobody"}); !strings.Contains(got, "Email: ") || !strings.Contains(got, "Password:}") {
+		t.Errorf("empty sensitive fields should stay empty: %s", got)
+	}
+}
+
+func TestUserLogValueRedactsSensitiveFields(t *testing.T) {
+	u := User{ID: 1, Name: "Ann", Email: "ann@example.com", Password: "$pbkdf2-sha256$i=1000,l=32$c2FsdA$aGFzaA"}
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("signed up", "user", u)
+
+	var line struct {
+		User map[string]any `json:"user"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("decode %s: %v", buf.Bytes(), err)
+	}
+	if got := line.User["email"]; got != "a***@example.com" {
+		t.Errorf("email = %v, want a***@example.com", got)
+	}
+	if got := line.User["name"]; got != "Ann" {
+		t.Errorf("name = %v, want Ann", got)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("ann@")) || bytes.Contains(buf.Bytes(), []byte("pbkdf2")) {
+		t.Errorf("log line leaks a secret: %s", buf.Bytes())
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "keys.json")
+	keys, err := OpenKeyRing(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, _ := sealedUserFile(t, keys)
+	repo, err := OpenEncryptedFileUserRepository(path, keys, RequireSealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldKey := keys.Active()
+	newKey, err := keys.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.Active() != newKey || newKey == oldKey {
+		t.Fatalf("after Rotate the active key is %s, want a new one (was %s)", keys.Active(), oldKey)
+	}
+	if err := keys.Retire(newKey); !errors.Is(err, ErrActiveKey) {
+		t.Errorf("Retire(active) = %v, want ErrActiveKey", err)
+	}
+	if err := repo.Reseal(); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.Retire(oldKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.Retire(oldKey); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("retiring %s twice = %v, want ErrUnknownKey", oldKey, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(":"+oldKey+":")) || !bytes.Contains(data, []byte(":"+newKey+":")) {
+		t.Errorf("resealed file still uses %s or not %s:\n%s", oldKey, newKey, data)
+	}
+
+	reloaded, err := OpenKeyRing(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := reloaded.KeyIDs(); len(ids) != 1 || ids[0] != newKey || reloaded.Active() != newKey {
+		t.Errorf("reloaded key file has %v, active %s; want only %s", ids, reloaded.Active(), newKey)
+	}
+	reopened, err := OpenEncryptedFileUserRepository(path, reloaded, RequireSealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := reopened.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].Email != "ann@example.com" || users[1].Email != "bob@example.com" {
+		t.Errorf("reopened users = %v", users)
+	}
+}
+
+func TestOpenKeyRingRejectsExposedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if _, err := OpenKeyRing(path); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("new key file: %v, %v; want mode 0600", info, err)
+	}
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenKeyRing(path); !errors.Is(err, ErrKeyFileExposed) {
+		t.Errorf("OpenKeyRing on a 0644 file = %v, want ErrKeyFileExposed", err)
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrAnimalNotFound    = errors.New("animal not found")
+	ErrOwnerNotFound     = errors.New("owner not found")
+	ErrInvalidTransition = errors.New("invalid adoption status change")
+	ErrVaccinationsDue   = errors.New("vaccinations overdue")
+	ErrUnknownSpecies    = errors.New("unknown species")
+)
+
+// AdoptionStatus is where an animal is in the adoption workflow
+type AdoptionStatus string
+
+const (
+	StatusIntake    AdoptionStatus = "intake"
+	StatusAvailable AdoptionStatus = "available"
+	StatusOnHold    AdoptionStatus = "on-hold"
+	StatusAdopted   AdoptionStatus = "adopted"
+	StatusReturned  AdoptionStatus = "returned"
+)
+
+// adoptionTransitions lists the statuses each status may move to
+var adoptionTransitions = map[AdoptionStatus][]AdoptionStatus{
+	StatusIntake:    {StatusAvailable},
+	StatusAvailable: {StatusOnHold, StatusAdopted},
+	StatusOnHold:    {StatusAvailable, StatusAdopted},
+	StatusAdopted:   {StatusReturned},
+	StatusReturned:  {StatusIntake, StatusAvailable},
+}
+
+// Vaccination records one dose
+type Vaccination struct {
+	Vaccine string    `json:"vaccine"`
+	Given   time.Time `json:"given"`
+}
+
+// VaccineRequirement is one entry of a species' schedule: the first dose
+// is due at FirstAt of age, then again Every after the last dose
+type VaccineRequirement struct {
+	Vaccine string
+	FirstAt time.Duration
+	Every   time.Duration
+}
+
+// ShelterAnimal is implemented by the species types through their
+// embedded Animal
+type ShelterAnimal interface {
+	animal() *Animal
+	VaccineSchedule() []VaccineRequirement
+}
+
+func (a *Animal) animal() *Animal { return a }
+
+// Age is the age in whole years at t; zero when Born is unknown
+func (a *Animal) Age(t time.Time) int {
+	if a.Born.IsZero() {
+		return 0
+	}
+	years := t.Year() - a.Born.Year()
+	if t.Month() < a.Born.Month() || (t.Month() == a.Born.Month() && t.Day() < a.Born.Day()) {
+		years--
+	}
+	return years
+}
+
+type Dog struct {
+	Animal
+	Breed string `json:"breed,omitempty"`
+	Size  string `json:"size,omitempty"` // small, medium or large
+}
+
+func NewDog(name, breed string, born time.Time) *Dog {
+	return &Dog{Animal: Animal{Name: name, Species: "dog", Born: born}, Breed: breed}
+}
+
+func (d *Dog) VaccineSchedule() []VaccineRequirement {
+	return []VaccineRequirement{
+		{"rabies", 12 * week, 52 * week},
+		{"DHPP", 8 * week, 52 * week},
+		{"bordetella", 8 * week, 26 * week},
+	}
+}
+
+type Cat struct {
+	Animal
+	Indoor bool `json:"indoor"`
+}
+
+func NewCat(name string, indoor bool, born time.Time) *Cat {
+	return &Cat{Animal: Animal{Name: name, Species: "cat", Born: born}, Indoor: indoor}
+}
+
+func (c *Cat) VaccineSchedule() []VaccineRequirement {
+	return []VaccineRequirement{
+		{"rabies", 12 * week, 52 * week},
+		{"FVRCP", 8 * week, 52 * week},
+	}
+}
+
+type Rabbit struct {
+	Animal
+	Breed string `json:"breed,omitempty"`
+}
+
+func NewRabbit(name, breed string, born time.Time) *Rabbit {
+	return &Rabbit{Animal: Animal{Name: name, Species: "rabbit", Born: born}, Breed: breed}
+}
+
+func (r *Rabbit) VaccineSchedule() []VaccineRequirement {
+	return []VaccineRequirement{{"RHDV2", 10 * week, 52 * week}}
+}
+
+// speciesTypes creates an empty value to decode each species into
+var speciesTypes = map[string]func() ShelterAnimal{
+	"dog":    func() ShelterAnimal { return &Dog{} },
+	"cat":    func() ShelterAnimal { return &Cat{} },
+	"rabbit": func() ShelterAnimal { return &Rabbit{} },
+}
+
+// VaccineDue is the next dose of one vaccine
+type VaccineDue struct {
+	Vaccine string
+	Due     time.Time
+	Overdue bool
+}
+
+// DueVaccinations lists the next dose of every vaccine on a's schedule,
+// soonest first. With no birth date, first doses are due at intake.
+func DueVaccinations(a ShelterAnimal, intake, now time.Time) []VaccineDue {
+	base := a.animal()
+	var due []VaccineDue
+	for _, req := range a.VaccineSchedule() {
+		next := intake
+		if !base.Born.IsZero() {
+			next = base.Born.Add(req.FirstAt)
+		}
+		for _, v := range base.Vaccinations {
+			if v.Vaccine == req.Vaccine && !v.Given.Add(req.Every).Before(next) {
+				next = v.Given.Add(req.Every)
+			}
+		}
+		due = append(due, VaccineDue{req.Vaccine, next, next.Before(now)})
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Due.Before(due[j].Due) })
+	return due
+}
+
+type Owner struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Address string `json:"address"`
+}
+
+// StatusChange is one step of an animal's adoption history
+type StatusChange struct {
+	From    AdoptionStatus `json:"from,omitempty"`
+	To      AdoptionStatus `json:"to"`
+	At      time.Time      `json:"at"`
+	OwnerID int            `json:"owner_id,omitempty"`
+	Note    string         `json:"note,omitempty"`
+}
+
+// ShelterEntry is an animal together with its adoption state
+type ShelterEntry struct {
+	Animal   ShelterAnimal
+	Status   AdoptionStatus
+	OwnerID  int // Adopter, or the owner holding the animal
+	IntakeAt time.Time
+	History  []StatusChange
+}
+
+// shelterEntryJSON names the species so Animal can be decoded into the
+// right type
+type shelterEntryJSON struct {
+	Species  string          `json:"species"`
+	Animal   json.RawMessage `json:"animal"`
+	Status   AdoptionStatus  `json:"status"`
+	OwnerID  int             `json:"owner_id,omitempty"`
+	IntakeAt time.Time       `json:"intake_at"`
+	History  []StatusChange  `json:"history"`
+}
+
+func (e *ShelterEntry) MarshalJSON() ([]byte, error) {
+	animal, err := json.Marshal(e.Animal)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(shelterEntryJSON{
+		Species: e.Animal.animal().Species, Animal: animal, Status: e.Status,
+		OwnerID: e.OwnerID, IntakeAt: e.IntakeAt, History: e.History,
+	})
+}
+
+func (e *ShelterEntry) UnmarshalJSON(b []byte) error {
+	var in shelterEntryJSON
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+	newAnimal, ok := speciesTypes[in.Species]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownSpecies, in.Species)
+	}
+	a := newAnimal()
+	if err := json.Unmarshal(in.Animal, a); err != nil {
+		return err
+	}
+	*e = ShelterEntry{Animal: a, Status: in.Status, OwnerID: in.OwnerID, IntakeAt: in.IntakeAt, History: in.History}
+	return nil
+}
+
+// ShelterRegistry tracks animals, owners and adoptions. It is safe for
+// concurrent use.
+type ShelterRegistry struct {
+	Now func() time.Time // Clock for status changes; time.Now by default
+
+	mu           sync.Mutex
+	animals      map[int]*ShelterEntry
+	owners       map[int]Owner
+	nextAnimalID int
+	nextOwnerID  int
+}
+
+func NewShelterRegistry() *ShelterRegistry {
+	return &ShelterRegistry{
+		Now:     time.Now,
+		animals: make(map[int]*ShelterEntry),
+		owners:  make(map[int]Owner),
+	}
+}
+
+func (r *ShelterRegistry) AddOwner(o Owner) Owner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextOwnerID++
+	o.ID = r.nextOwnerID
+	r.owners[o.ID] = o
+	return o
+}
+
+func (r *ShelterRegistry) Owner(id int) (Owner, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok := r.owners[id]
+	if !ok {
+		return Owner{}, fmt.Errorf("%w: %d", ErrOwnerNotFound, id)
+	}
+	return o, nil
+}
+
+// Intake registers a new animal and returns its ID
+func (r *ShelterRegistry) Intake(a ShelterAnimal) (int, error) {
+	base := a.animal()
+	if _, ok := speciesTypes[base.Species]; !ok {
+		return 0, fmt.Errorf("%w %q", ErrUnknownSpecies, base.Species)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextAnimalID++
+	base.ID = r.nextAnimalID
+	now := r.Now()
+	r.animals[base.ID] = &ShelterEntry{
+		Animal:   a,
+		Status:   StatusIntake,
+		IntakeAt: now,
+		History:  []StatusChange{{To: StatusIntake, At: now}},
+	}
+	return base.ID, nil
+}
+
+// Get returns a copy of the entry; its Animal is shared, so treat it as
+// read-only and change it through the registry
+func (r *ShelterRegistry) Get(id int) (ShelterEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.animals[id]
+	if !ok {
+		return ShelterEntry{}, fmt.Errorf("%w: %d", ErrAnimalNotFound, id)
+	}
+	return *e, nil
+}
+
+func (r *ShelterRegistry) Vaccinate(id int, vaccine string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.animals[id]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrAnimalNotFound, id)
+	}
+	base := e.Animal.animal()
+	base.Vaccinations = append(base.Vaccinations, Vaccination{vaccine, r.Now()})
+	return nil
+}
+
+// MakeAvailable lists an animal for adoption once its vaccinations are
+// up to date
+func (r *ShelterRegistry) MakeAvailable(id int) error {
+	return r.transition(id, StatusAvailable, 0, "", func(e *ShelterEntry) error {
+		var overdue []string
+		for _, d := range DueVaccinations(e.Animal, e.IntakeAt, r.Now()) {
+			if d.Overdue {
+				overdue = append(overdue, d.Vaccine)
+			}
+		}
+		if len(overdue) > 0 {
+			return fmt.Errorf("%w: %s", ErrVaccinationsDue, strings.Join(overdue, ", "))
+		}
+		return nil
+	})
+}
+
+// PlaceHold reserves an available animal for ownerID
+func (r *ShelterRegistry) PlaceHold(id, ownerID int) error {
+	return r.transition(id, StatusOnHold, ownerID, "", nil)
+}
+
+func (r *ShelterRegistry) ReleaseHold(id int, note string) error {
+	return r.transition(id, StatusAvailable, 0, note, nil)
+}
+
+// Adopt completes an adoption; an animal on hold can only go to the
+// owner holding it
+func (r *ShelterRegistry) Adopt(id, ownerID int) error {
+	return r.transition(id, StatusAdopted, ownerID, "", func(e *ShelterEntry) error {
+		if e.Status == StatusOnHold && e.OwnerID != ownerID {
+			return fmt.Errorf("%w: on hold for owner %d", ErrInvalidTransition, e.OwnerID)
+		}
+		return nil
+	})
+}
+
+// Return takes an adopted animal back; the reason is kept in the history
+func (r *ShelterRegistry) Return(id int, reason string) error {
+	return r.transition(id, StatusReturned, 0, reason, nil)
+}
+
+// transition moves id to status after the workflow and check allow it.
+// ownerID is required for holds and adoptions.
+func (r *ShelterRegistry) transition(id int, to AdoptionStatus, ownerID int, note string, check func(*ShelterEntry) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.animals[id]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrAnimalNotFound, id)
+	}
+	if !slices.Contains(adoptionTransitions[e.Status], to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, e.Status, to)
+	}
+	if to == StatusOnHold || to == StatusAdopted {
+		if _, ok := r.owners[ownerID]; !ok {
+			return fmt.Errorf("%w: %d", ErrOwnerNotFound, ownerID)
+		}
+	}
+	if check != nil {
+		if err := check(e); err != nil {
+			return err
+		}
+	}
+
+	e.History = append(e.History, StatusChange{From: e.Status, To: to, At: r.Now(), OwnerID: ownerID, Note: note})
+	e.Status = to
+	e.OwnerID = ownerID
+	if to == StatusIntake {
+		e.IntakeAt = r.Now()
+	}
+	return nil
+}
+
+// Pet returns an adopted animal as a Pet of its owner
+func (r *ShelterRegistry) Pet(id int) (*Pet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.animals[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrAnimalNotFound, id)
+	}
+	if e.Status != StatusAdopted {
+		return nil, fmt.Errorf("animal %d is %s, not adopted", id, e.Status)
+	}
+	owner := r.owners[e.OwnerID]
+	return &Pet{Animal: e.Animal.animal(), Owner: owner.Name, HomeAddress: owner.Address}, nil
+}
+
+// AnimalQuery filters Search results; zero fields match everything
+type AnimalQuery struct {
+	Species  string
+	MinAge   int
+	MaxAge   int // Years; zero means no limit
+	Statuses []AdoptionStatus
+}
+
+// Search returns matching entries ordered by ID
+func (r *ShelterRegistry) Search(q AnimalQuery) []ShelterEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.Now()
+	var result []ShelterEntry
+	for _, e := range r.animals {
+		a := e.Animal.animal()
+		age := a.Age(now)
+		switch {
+		case q.Species != "" && !strings.EqualFold(q.Species, a.Species):
+		case age < q.MinAge:
+		case q.MaxAge > 0 && age > q.MaxAge:
+		case len(q.Statuses) > 0 && !slices.Contains(q.Statuses, e.Status):
+		default:
+			result = append(result, *e)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Animal.animal().ID < result[j].Animal.animal().ID
+	})
+	return result
+}
+
+// shelterFile is the JSON file layout
+type shelterFile struct {
+	Owners  []Owner         `json:"owners"`
+	Animals []*ShelterEntry `json:"animals"`
+}
+
+// Save writes the registry to path, replacing it atomically
+func (r *ShelterRegistry) Save(path string) error {
+	r.mu.Lock()
+	var data shelterFile
+	for _, o := range r.owners {
+		data.Owners = append(data.Owners, o)
+	}
+	for _, e := range r.animals {
+		data.Animals = append(data.Animals, e)
+	}
+	sort.Slice(data.Owners, func(i, j int) bool { return data.Owners[i].ID < data.Owners[j].ID })
+	sort.Slice(data.Animals, func(i, j int) bool {
+		return data.Animals[i].Animal.animal().ID < data.Animals[j].Animal.animal().ID
+	})
+	b, err := json.MarshalIndent(data, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadShelterRegistry reads a registry written by Save
+func LoadShelterRegistry(path string) (*ShelterRegistry, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var data shelterFile
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	r := NewShelterRegistry()
+	for _, o := range data.Owners {
+		r.owners[o.ID] = o
+		r.nextOwnerID = max(r.nextOwnerID, o.ID)
+	}
+	for _, e := range data.Animals {
+		id := e.Animal.animal().ID
+		if _, dup := r.animals[id]; dup {
+			return nil, fmt.Errorf("%s: duplicate animal id %d", path, id)
+		}
+		r.animals[id] = e
+		r.nextAnimalID = max(r.nextAnimalID, id)
+	}
+	return r, nil
+}
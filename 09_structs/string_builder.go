@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Write makes StringBuilder an io.Writer, so fmt.Fprintf, templates and
+// encoders can write into it with indentation applied
+func (sb *StringBuilder) Write(p []byte) (int, error) {
+	sb.WriteString(string(p))
+	return len(p), nil
+}
+
+// WriteString appends s; each line that s starts gets the prefix and
+// the current indentation. Empty lines stay free of trailing spaces.
+func (sb *StringBuilder) WriteString(s string) (int, error) {
+	n := len(s)
+	for s != "" {
+		line, rest, found := strings.Cut(s, "\n")
+		if line != "" {
+			if !sb.midLine {
+				sb.startLine()
+			}
+			sb.buf = append(sb.buf, line...)
+		}
+		if found {
+			sb.newline()
+		}
+		s = rest
+	}
+	return n, nil
+}
+
+func (sb *StringBuilder) startLine() {
+	sb.buf = append(sb.buf, sb.prefix...)
+	unit := sb.indentUnit
+	if unit == "" {
+		unit = "\t"
+	}
+	for range sb.indent {
+		sb.buf = append(sb.buf, unit...)
+	}
+	sb.midLine = true
+}
+
+func (sb *StringBuilder) newline() {
+	if !sb.midLine && sb.prefix != "" {
+		sb.buf = append(sb.buf, strings.TrimRight(sb.prefix, " \t")...)
+	}
+	sb.buf = append(sb.buf, '\n')
+	sb.midLine = false
+}
+
+func (sb *StringBuilder) Appendf(format string, args ...any) *StringBuilder {
+	fmt.Fprintf(sb, format, args...)
+	return sb
+}
+
+// Join appends elems separated by sep
+func (sb *StringBuilder) Join(elems []string, sep string) *StringBuilder {
+	for i, e := range elems {
+		if i > 0 {
+			sb.WriteString(sep)
+		}
+		sb.WriteString(e)
+	}
+	return sb
+}
+
+// Indent indents the lines that follow by one more level
+func (sb *StringBuilder) Indent() *StringBuilder {
+	sb.indent++
+	return sb
+}
+
+// Dedent undoes one Indent; extra calls are ignored
+func (sb *StringBuilder) Dedent() *StringBuilder {
+	if sb.indent > 0 {
+		sb.indent--
+	}
+	return sb
+}
+
+// IndentWith sets the text for one level, such as "  "; the default is a tab
+func (sb *StringBuilder) IndentWith(unit string) *StringBuilder {
+	sb.indentUnit = unit
+	return sb
+}
+
+// Block writes header, then body one level deeper, then footer:
+// the shape of a Go function or a report section
+func (sb *StringBuilder) Block(header string, body func(*StringBuilder), footer string) *StringBuilder {
+	sb.AppendLine(header).Indent()
+	body(sb)
+	sb.Dedent()
+	if footer != "" {
+		sb.AppendLine(footer)
+	}
+	return sb
+}
+
+// WithPrefix starts every following line with prefix, such as "// "
+func (sb *StringBuilder) WithPrefix(prefix string) *StringBuilder {
+	sb.prefix = prefix
+	return sb
+}
+
+// Grow makes room for n more bytes without reallocating
+func (sb *StringBuilder) Grow(n int) *StringBuilder {
+	sb.buf = slices.Grow(sb.buf, n)
+	return sb
+}
+
+func (sb *StringBuilder) Len() int {
+	return len(sb.buf)
+}
+
+// Reset empties the builder but keeps its buffer, prefix and indent unit
+func (sb *StringBuilder) Reset() *StringBuilder {
+	sb.buf = sb.buf[:0]
+	sb.indent = 0
+	sb.midLine = false
+	return sb
+}
+
+func (sb *StringBuilder) String() string {
+	return string(sb.buf)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// benchmarkLines is the size of the report both benchmarks build
+const benchmarkLines = 2000
+
+// BenchmarkConcat builds the report with +=, which is what StringBuilder
+// did before it kept a byte buffer
+func BenchmarkConcat(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		var s string
+		for i := range benchmarkLines {
+			s += "line " + fmt.Sprint(i) + "\n"
+		}
+		_ = s
+	}
+}
+
+func BenchmarkBuilder(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		sb := &StringBuilder{}
+		for i := range benchmarkLines {
+			sb.Append("line ").AppendLine(fmt.Sprint(i))
+		}
+		_ = sb.String()
+	}
+}
@@ -0,0 +1,601 @@
+package main
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrPatchPath = errors.New("json patch: path not found")
+	ErrPatchTest = errors.New("json patch: test failed")
+	ErrPatchOp   = errors.New("json patch: invalid operation")
+)
+
+// PatchOp is one RFC 6902 operation. Value holds the raw JSON value for
+// add, replace and test.
+type PatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// JSONPatch is an RFC 6902 document
+type JSONPatch []PatchOp
+
+func (p JSONPatch) String() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+// patchField is one JSON member of a struct: its name and the path of
+// field indexes to it, through embedded structs
+type patchField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	omitZero  bool
+}
+
+// patchFields lists the members encoding/json would write for t:
+// json tags rename or skip fields and untagged embedded structs are
+// flattened into their parent
+func patchFields(t reflect.Type) []patchField {
+	return taggedFields(t, "json")
+}
+
+// taggedFields is patchFields for other encodings: the first of tagKeys
+// present on a field decides its name and options, so yaml tags can
+// fall back to json tags
+func taggedFields(t reflect.Type, tagKeys ...string) []patchField {
+	var fields []patchField
+	seen := make(map[string]bool)
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			var tag string
+			for _, key := range tagKeys {
+				if v, ok := f.Tag.Lookup(key); ok {
+					tag = v
+					break
+				}
+			}
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			path := append(append([]int(nil), index...), i)
+
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+				walk(ft, path)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			if seen[name] {
+				continue // The shallower field wins, as in encoding/json
+			}
+			seen[name] = true
+			fields = append(fields, patchField{
+				name:      name,
+				index:     path,
+				omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+				omitZero:  strings.Contains(","+opts+",", ",omitzero,"),
+			})
+		}
+	}
+	walk(t, nil)
+	return fields
+}
+
+func findPatchField(t reflect.Type, name string) (patchField, bool) {
+	for _, f := range patchFields(t) {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return patchField{}, false
+}
+
+// patchFieldValue walks f.index; nil embedded pointers are allocated when
+// alloc is set and otherwise give an invalid Value
+func patchFieldValue(v reflect.Value, f patchField, alloc bool) reflect.Value {
+	for i, idx := range f.index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(idx)
+	}
+	return v
+}
+
+// present reports whether encoding/json would write the member
+func (f patchField) present(v reflect.Value) bool {
+	if !v.IsValid() {
+		return false
+	}
+	if f.omitZero && v.IsZero() {
+		return false
+	}
+	if f.omitEmpty {
+		switch v.Kind() {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64, reflect.Interface, reflect.Pointer:
+			return !v.IsZero()
+		case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+			return v.Len() > 0
+		}
+	}
+	return true
+}
+
+// isPatchLeaf reports whether t is compared as a whole JSON value rather
+// than walked: custom marshalers, scalars and []byte
+func isPatchLeaf(t reflect.Type) bool {
+	for _, m := range []reflect.Type{reflect.TypeFor[json.Marshaler](), reflect.TypeFor[encoding.TextMarshaler]()} {
+		if t.Implements(m) || reflect.PointerTo(t).Implements(m) {
+			return true
+		}
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Array, reflect.Pointer:
+		return false
+	case reflect.Map:
+		return t.Key().Kind() != reflect.String
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	}
+	return true
+}
+
+// escapePointer escapes one JSON Pointer token (RFC 6901)
+func escapePointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
+
+func unescapePointer(s string) string {
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(s)
+}
+
+// Diff returns the JSON Patch that turns from into to. Members are
+// named by their json tags and fields tagged json:"-" are never compared.
+func Diff[T any](from, to T) (JSONPatch, error) {
+	var patch JSONPatch
+	err := diffValues(&patch, "", reflect.ValueOf(&from).Elem(), reflect.ValueOf(&to).Elem())
+	return patch, err
+}
+
+func diffValues(patch *JSONPatch, path string, a, b reflect.Value) error {
+	t := a.Type()
+	if isPatchLeaf(t) {
+		return diffLeaf(patch, path, a, b)
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() && b.IsNil() {
+				return nil
+			}
+			return diffLeaf(patch, path, a, b)
+		}
+		return diffValues(patch, path, a.Elem(), b.Elem())
+
+	case reflect.Struct:
+		for _, f := range patchFields(t) {
+			av, bv := patchFieldValue(a, f, false), patchFieldValue(b, f, false)
+			p := path + "/" + escapePointer(f.name)
+			switch inA, inB := f.present(av), f.present(bv); {
+			case inA && inB:
+				if err := diffValues(patch, p, av, bv); err != nil {
+					return err
+				}
+			case inB:
+				if err := addOp(patch, "add", p, bv); err != nil {
+					return err
+				}
+			case inA:
+				*patch = append(*patch, PatchOp{Op: "remove", Path: p})
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		if a.IsNil() != b.IsNil() {
+			return addOp(patch, "replace", path, b) // null and {} differ in JSON
+		}
+		keys := make(map[string]bool)
+		for _, k := range a.MapKeys() {
+			keys[k.String()] = true
+		}
+		for _, k := range b.MapKeys() {
+			keys[k.String()] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			key := reflect.ValueOf(k).Convert(t.Key())
+			av, bv := a.MapIndex(key), b.MapIndex(key)
+			p := path + "/" + escapePointer(k)
+			switch {
+			case av.IsValid() && bv.IsValid():
+				if err := diffValues(patch, p, av, bv); err != nil {
+					return err
+				}
+			case bv.IsValid():
+				if err := addOp(patch, "add", p, bv); err != nil {
+					return err
+				}
+			default:
+				*patch = append(*patch, PatchOp{Op: "remove", Path: p})
+			}
+		}
+		return nil
+
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && a.IsNil() != b.IsNil() {
+			return addOp(patch, "replace", path, b)
+		}
+		common := min(a.Len(), b.Len())
+		for i := 0; i < common; i++ {
+			if err := diffValues(patch, path+"/"+strconv.Itoa(i), a.Index(i), b.Index(i)); err != nil {
+				return err
+			}
+		}
+		for i := common; i < b.Len(); i++ {
+			if err := addOp(patch, "add", path+"/"+strconv.Itoa(i), b.Index(i)); err != nil {
+				return err
+			}
+		}
+		// Remove from the end so earlier indexes stay valid
+		for i := a.Len() - 1; i >= common; i-- {
+			*patch = append(*patch, PatchOp{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+		}
+		return nil
+	}
+	return diffLeaf(patch, path, a, b)
+}
+
+func diffLeaf(patch *JSONPatch, path string, a, b reflect.Value) error {
+	aj, err := json.Marshal(a.Interface())
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	bj, err := json.Marshal(b.Interface())
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if !bytes.Equal(aj, bj) {
+		*patch = append(*patch, PatchOp{Op: "replace", Path: path, Value: bj})
+	}
+	return nil
+}
+
+func addOp(patch *JSONPatch, op, path string, v reflect.Value) error {
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	*patch = append(*patch, PatchOp{Op: op, Path: path, Value: b})
+	return nil
+}
+
+// ApplyPatch applies patch to *target. Either every operation succeeds
+// or *target is left unchanged. Fields tagged json:"-" are kept.
+func ApplyPatch[T any](target *T, patch JSONPatch) error {
+	work := clonePatchValue(reflect.ValueOf(target).Elem())
+	for i, op := range patch {
+		if err := applyPatchOp(work, op); err != nil {
+			return fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	reflect.ValueOf(target).Elem().Set(work)
+	return nil
+}
+
+func applyPatchOp(root reflect.Value, op PatchOp) error {
+	switch op.Op {
+	case "add", "replace":
+		if op.Value == nil {
+			return fmt.Errorf("%w: missing value", ErrPatchOp)
+		}
+		return patchAt(root, op.Path, func(parent reflect.Value, key string) error {
+			return patchSet(parent, key, op.Value, op.Op == "add")
+		})
+	case "remove":
+		return patchAt(root, op.Path, patchRemove)
+	case "test":
+		got, err := patchGet(root, op.Path)
+		if err != nil {
+			return err
+		}
+		if !jsonEqual(got, op.Value) {
+			return fmt.Errorf("%w: %s is %s", ErrPatchTest, op.Path, got)
+		}
+		return nil
+	case "move", "copy":
+		value, err := patchGet(root, op.From)
+		if err != nil {
+			return err
+		}
+		if op.Op == "move" {
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				return fmt.Errorf("%w: cannot move %s into itself", ErrPatchOp, op.From)
+			}
+			if err := patchAt(root, op.From, patchRemove); err != nil {
+				return err
+			}
+		}
+		return patchAt(root, op.Path, func(parent reflect.Value, key string) error {
+			return patchSet(parent, key, value, true)
+		})
+	}
+	return fmt.Errorf("%w: unknown op %q", ErrPatchOp, op.Op)
+}
+
+// patchAt walks path and calls fn with the container holding the last
+// token. Map elements are not addressable, so they are copied, changed
+// and stored back on the way out.
+func patchAt(v reflect.Value, path string, fn func(parent reflect.Value, key string) error) error {
+	if path == "" {
+		return fmt.Errorf("%w: whole-document operations are not supported", ErrPatchOp)
+	}
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("%w: path %q must start with /", ErrPatchOp, path)
+	}
+	tokens := strings.Split(path[1:], "/")
+	for i := range tokens {
+		tokens[i] = unescapePointer(tokens[i])
+	}
+	return patchWalk(v, tokens, path, fn)
+}
+
+func patchWalk(v reflect.Value, tokens []string, path string, fn func(reflect.Value, string) error) error {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return fmt.Errorf("%w: %s", ErrPatchPath, path)
+		}
+		v = v.Elem()
+	}
+	if len(tokens) == 1 {
+		return fn(v, tokens[0])
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		f, ok := findPatchField(v.Type(), tokens[0])
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrPatchPath, path)
+		}
+		return patchWalk(patchFieldValue(v, f, true), tokens[1:], path, fn)
+	case reflect.Map:
+		key := reflect.ValueOf(tokens[0]).Convert(v.Type().Key())
+		elem := v.MapIndex(key)
+		if !elem.IsValid() {
+			return fmt.Errorf("%w: %s", ErrPatchPath, path)
+		}
+		copied := reflect.New(elem.Type()).Elem()
+		copied.Set(elem)
+		if err := patchWalk(copied, tokens[1:], path, fn); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, copied)
+		return nil
+	case reflect.Slice, reflect.Array:
+		i, err := strconv.Atoi(tokens[0])
+		if err != nil || i < 0 || i >= v.Len() {
+			return fmt.Errorf("%w: %s", ErrPatchPath, path)
+		}
+		return patchWalk(v.Index(i), tokens[1:], path, fn)
+	}
+	return fmt.Errorf("%w: %s", ErrPatchPath, path)
+}
+
+func patchGet(root reflect.Value, path string) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := patchAt(root, path, func(parent reflect.Value, key string) error {
+		var v reflect.Value
+		switch parent.Kind() {
+		case reflect.Struct:
+			if f, ok := findPatchField(parent.Type(), key); ok {
+				v = patchFieldValue(parent, f, false)
+			}
+		case reflect.Map:
+			v = parent.MapIndex(reflect.ValueOf(key).Convert(parent.Type().Key()))
+		case reflect.Slice, reflect.Array:
+			if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < parent.Len() {
+				v = parent.Index(i)
+			}
+		}
+		if !v.IsValid() {
+			return fmt.Errorf("%w: %s", ErrPatchPath, path)
+		}
+		b, err := json.Marshal(v.Interface())
+		out = b
+		return err
+	})
+	return out, err
+}
+
+// patchSet decodes raw into the member key of parent. With insert set
+// (add, move, copy) slice elements are inserted rather than replaced.
+func patchSet(parent reflect.Value, key string, raw json.RawMessage, insert bool) error {
+	decode := func(t reflect.Type) (reflect.Value, error) {
+		v := reflect.New(t)
+		if err := json.Unmarshal(raw, v.Interface()); err != nil {
+			return reflect.Value{}, fmt.Errorf("%w: %v", ErrPatchOp, err)
+		}
+		return v.Elem(), nil
+	}
+
+	switch parent.Kind() {
+	case reflect.Struct:
+		f, ok := findPatchField(parent.Type(), key)
+		if !ok {
+			return fmt.Errorf("%w: no member %q", ErrPatchPath, key)
+		}
+		fv := patchFieldValue(parent, f, true)
+		v, err := decode(fv.Type())
+		if err != nil {
+			return err
+		}
+		fv.Set(v)
+		return nil
+
+	case reflect.Map:
+		k := reflect.ValueOf(key).Convert(parent.Type().Key())
+		if !insert && !parent.MapIndex(k).IsValid() {
+			return fmt.Errorf("%w: no key %q", ErrPatchPath, key)
+		}
+		v, err := decode(parent.Type().Elem())
+		if err != nil {
+			return err
+		}
+		if parent.IsNil() {
+			parent.Set(reflect.MakeMap(parent.Type()))
+		}
+		parent.SetMapIndex(k, v)
+		return nil
+
+	case reflect.Slice, reflect.Array:
+		n := parent.Len()
+		i, err := strconv.Atoi(key)
+		if key == "-" && insert && parent.Kind() == reflect.Slice {
+			i, err = n, nil
+		}
+		limit := n - 1
+		if insert && parent.Kind() == reflect.Slice {
+			limit = n
+		}
+		if err != nil || i < 0 || i > limit {
+			return fmt.Errorf("%w: index %s", ErrPatchPath, key)
+		}
+		v, err := decode(parent.Type().Elem())
+		if err != nil {
+			return err
+		}
+		if !insert || parent.Kind() == reflect.Array {
+			parent.Index(i).Set(v)
+			return nil
+		}
+		grown := reflect.Append(parent, v)
+		reflect.Copy(grown.Slice(i+1, n+1), parent.Slice(i, n))
+		grown.Index(i).Set(v)
+		parent.Set(grown)
+		return nil
+	}
+	return fmt.Errorf("%w: cannot set %q in a %s", ErrPatchOp, key, parent.Kind())
+}
+
+func patchRemove(parent reflect.Value, key string) error {
+	switch parent.Kind() {
+	case reflect.Struct:
+		f, ok := findPatchField(parent.Type(), key)
+		if !ok {
+			return fmt.Errorf("%w: no member %q", ErrPatchPath, key)
+		}
+		fv := patchFieldValue(parent, f, false)
+		if fv.IsValid() {
+			fv.Set(reflect.Zero(fv.Type()))
+		}
+		return nil
+	case reflect.Map:
+		k := reflect.ValueOf(key).Convert(parent.Type().Key())
+		if !parent.MapIndex(k).IsValid() {
+			return fmt.Errorf("%w: no key %q", ErrPatchPath, key)
+		}
+		parent.SetMapIndex(k, reflect.Value{})
+		return nil
+	case reflect.Slice:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= parent.Len() {
+			return fmt.Errorf("%w: index %s", ErrPatchPath, key)
+		}
+		parent.Set(reflect.AppendSlice(parent.Slice(0, i), parent.Slice(i+1, parent.Len())))
+		return nil
+	}
+	return fmt.Errorf("%w: cannot remove %q from a %s", ErrPatchOp, key, parent.Kind())
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	var av, bv any
+	if json.Unmarshal(a, &av) != nil || json.Unmarshal(b, &bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+// clonePatchValue copies v deeply enough that patching the copy cannot
+// change v: pointers, slices and maps reachable through exported fields
+// are duplicated. Unexported fields are copied shallowly.
+func clonePatchValue(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	deepenPatchClone(c)
+	return c
+}
+
+func deepenPatchClone(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			v.Set(clonePatchValue(v.Elem()).Addr())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.CanSet() {
+				deepenPatchClone(f)
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			deepenPatchClone(v.Index(i))
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return
+		}
+		s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(s, v)
+		for i := 0; i < s.Len(); i++ {
+			deepenPatchClone(s.Index(i))
+		}
+		v.Set(s)
+	case reflect.Map:
+		if v.IsNil() {
+			return
+		}
+		m := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m.SetMapIndex(iter.Key(), clonePatchValue(iter.Value()))
+		}
+		v.Set(m)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// diffDoc has the containers Diff walks into
+type diffDoc struct {
+	Counts map[string]int `json:"counts"`
+	Tags   []string       `json:"tags"`
+}
+
+func patchOp(op, path, value string) PatchOp {
+	p := PatchOp{Op: op, Path: path}
+	if value != "" {
+		p.Value = json.RawMessage(value)
+	}
+	return p
+}
+
+// checkPatch diffs from and to, compares the patch with want and checks
+// that applying it to from gives to
+func checkPatch[T any](t *testing.T, from, to T, want JSONPatch) {
+	t.Helper()
+	got, err := Diff(from, to)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("Diff =\n  %s\nwant\n  %s", got, want)
+	}
+	if err := ApplyPatch(&from, got); err != nil {
+		t.Fatalf("ApplyPatch(%s): %v", got, err)
+	}
+	if !reflect.DeepEqual(from, to) {
+		t.Errorf("patched value = %+v, want %+v", from, to)
+	}
+}
+
+func TestDiffSkipsUntaggedPassword(t *testing.T) {
+	created := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	from := User{ID: 1, Name: "Ann", CreatedAt: created, Password: "$pbkdf2-sha256$old"}
+	to := User{ID: 1, Name: "Anne", CreatedAt: created, Password: "$pbkdf2-sha256$new"}
+
+	patch, err := Diff(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (JSONPatch{patchOp("replace", "/name", `"Anne"`)}); patch.String() != want.String() {
+		t.Errorf("Diff = %s, want %s", patch, want)
+	}
+
+	if err := ApplyPatch(&from, patch); err != nil {
+		t.Fatal(err)
+	}
+	if from.Password != "$pbkdf2-sha256$old" {
+		t.Errorf("ApplyPatch changed the password to %q", from.Password)
+	}
+	for _, path := range []string{"/Password", "/-"} {
+		err := ApplyPatch(&from, JSONPatch{patchOp("replace", path, `"plain:x"`)})
+		if !errors.Is(err, ErrPatchPath) {
+			t.Errorf("replace %s: err = %v, want ErrPatchPath", path, err)
+		}
+	}
+}
+
+func TestDiffAllocatesEmbeddedPointer(t *testing.T) {
+	from := Pet{Owner: "Alice"}
+	to := Pet{Animal: &Animal{ID: 7, Name: "Rex", Species: "Dog"}, Owner: "Alice"}
+	checkPatch(t, from, to, JSONPatch{
+		patchOp("add", "/id", `7`),
+		patchOp("add", "/name", `"Rex"`),
+		patchOp("add", "/species", `"Dog"`),
+	})
+}
+
+func TestDiffRemovesSliceElementsFromTheEnd(t *testing.T) {
+	from := diffDoc{Tags: []string{"a", "b", "c", "d"}}
+	to := diffDoc{Tags: []string{"a", "x"}}
+	checkPatch(t, from, to, JSONPatch{
+		patchOp("replace", "/tags/1", `"x"`),
+		patchOp("remove", "/tags/3", ""),
+		patchOp("remove", "/tags/2", ""),
+	})
+}
+
+func TestDiffEscapesMapKeys(t *testing.T) {
+	from := diffDoc{Counts: map[string]int{"a/b": 1, "m~n": 2}}
+	to := diffDoc{Counts: map[string]int{"a/b": 3, "x/y~z": 4}}
+	checkPatch(t, from, to, JSONPatch{
+		patchOp("replace", "/counts/a~1b", `3`),
+		patchOp("remove", "/counts/m~0n", ""),
+		patchOp("add", "/counts/x~1y~0z", `4`),
+	})
+}
+
+func TestApplyPatchRejectsMoveIntoChild(t *testing.T) {
+	doc := diffDoc{Counts: map[string]int{"a": 1}}
+	err := ApplyPatch(&doc, JSONPatch{{Op: "move", From: "/counts", Path: "/counts/b"}})
+	if !errors.Is(err, ErrPatchOp) {
+		t.Errorf("err = %v, want ErrPatchOp", err)
+	}
+	if len(doc.Counts) != 1 || doc.Counts["a"] != 1 {
+		t.Errorf("failed move changed the document: %+v", doc)
+	}
+
+	err = ApplyPatch(&doc, JSONPatch{{Op: "move", From: "/counts/a", Path: "/counts/b"}})
+	if err != nil || doc.Counts["b"] != 1 || len(doc.Counts) != 1 {
+		t.Errorf("move between keys = %+v, %v", doc.Counts, err)
+	}
+}
+
+func TestApplyPatchIsAtomic(t *testing.T) {
+	rex := &Animal{Name: "Rex", Vaccinations: []Vaccination{{Vaccine: "rabies"}}}
+	counts := map[string]int{"visits": 1}
+	pet := Pet{Animal: rex, Owner: "Alice"}
+	doc := diffDoc{Counts: counts}
+
+	err := ApplyPatch(&pet, JSONPatch{
+		patchOp("replace", "/name", `"Max"`),
+		patchOp("replace", "/vaccinations/0/vaccine", `"distemper"`),
+		patchOp("add", "/vaccinations/-", `{"vaccine": "bordetella"}`),
+		patchOp("replace", "/Owner", `"Bob"`),
+		patchOp("remove", "/vaccinations/5", ""),
+	})
+	if !errors.Is(err, ErrPatchPath) {
+		t.Fatalf("err = %v, want ErrPatchPath", err)
+	}
+	if pet.Animal != rex || pet.Owner != "Alice" || rex.Name != "Rex" ||
+		len(rex.Vaccinations) != 1 || rex.Vaccinations[0].Vaccine != "rabies" {
+		t.Errorf("failed patch changed the pet: %+v, %+v", pet, *rex)
+	}
+
+	err = ApplyPatch(&doc, JSONPatch{patchOp("replace", "/counts/visits", `2`), patchOp("replace", "/counts/missing", `1`)})
+	if !errors.Is(err, ErrPatchPath) {
+		t.Fatalf("err = %v, want ErrPatchPath", err)
+	}
+	if counts["visits"] != 1 {
+		t.Errorf("failed patch changed the shared map: %v", counts)
+	}
+}
+
+func TestApplyPatchTest(t *testing.T) {
+	pet := Pet{Animal: &Animal{Name: "Rex", Vaccinations: []Vaccination{{Vaccine: "rabies"}}}, Owner: "Alice"}
+
+	err := ApplyPatch(&pet, JSONPatch{
+		patchOp("test", "/name", `"Rex"`),
+		patchOp("test", "/vaccinations/0", `{"given": "0001-01-01T00:00:00Z", "vaccine": "rabies"}`),
+		patchOp("replace", "/Owner", `"Bob"`),
+	})
+	if err != nil || pet.Owner != "Bob" {
+		t.Errorf("passing tests: owner %q, err %v", pet.Owner, err)
+	}
+
+	err = ApplyPatch(&pet, JSONPatch{patchOp("test", "/name", `"Max"`), patchOp("replace", "/Owner", `"Carol"`)})
+	if !errors.Is(err, ErrPatchTest) || pet.Owner != "Bob" {
+		t.Errorf("failing test: owner %q, err %v; want Bob and ErrPatchTest", pet.Owner, err)
+	}
+	if err := ApplyPatch(&pet, JSONPatch{patchOp("test", "/nickname", `"Rex"`)}); !errors.Is(err, ErrPatchPath) {
+		t.Errorf("test of a missing member: err = %v, want ErrPatchPath", err)
+	}
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+	maxBodyBytes    = 1 << 20
+)
+
+// UserAPI serves User over HTTP:
+//
+//	POST   /users       create
+//	GET    /users       list with ?name=, ?email=, ?limit= and ?cursor=
+//	GET    /users/{id}  fetch, honours If-None-Match
+//	PATCH  /users/{id}  JSON Merge Patch (RFC 7386), honours If-Match
+//	DELETE /users/{id}  delete, honours If-Match
+type UserAPI struct {
+	repo   UserRepository
+	hasher *PasswordHasher
+	policy PasswordPolicy
+	mux    *http.ServeMux
+}
+
+func NewUserAPI(repo UserRepository, hasher *PasswordHasher, policy PasswordPolicy) *UserAPI {
+	api := &UserAPI{repo: repo, hasher: hasher, policy: policy, mux: http.NewServeMux()}
+	api.mux.HandleFunc("POST /users", api.create)
+	api.mux.HandleFunc("GET /users", api.list)
+	api.mux.HandleFunc("GET /users/{id}", api.get)
+	api.mux.HandleFunc("PATCH /users/{id}", api.patch)
+	api.mux.HandleFunc("DELETE /users/{id}", api.delete)
+	return api
+}
+
+func (api *UserAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mux.ServeHTTP(w, r)
+}
+
+// userInput is the writable part of User
+type userInput struct {
+	Name     string  `json:"name"`
+	Email    string  `json:"email"`
+	Password *string `json:"password,omitempty"`
+}
+
+// userPage is the body of GET /users
+type userPage struct {
+	Items      []*User `json:"items"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+func (api *UserAPI) create(w http.ResponseWriter, r *http.Request) {
+	var in userInput
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	u := &User{Name: strings.TrimSpace(in.Name), Email: strings.TrimSpace(in.Email)}
+	if err := api.apply(u, in.Password, false); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	if err := api.repo.Create(r.Context(), u); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/users/%d", u.ID))
+	writeUser(w, http.StatusCreated, u)
+}
+
+func (api *UserAPI) get(w http.ResponseWriter, r *http.Request) {
+	u, ok := api.load(w, r)
+	if !ok {
+		return
+	}
+	if etagMatches(r.Header.Get("If-None-Match"), userETag(u), true) {
+		w.Header().Set("ETag", userETag(u))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeUser(w, http.StatusOK, u)
+}
+
+func (api *UserAPI) patch(w http.ResponseWriter, r *http.Request) {
+	if ct := r.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, "application/merge-patch+json") &&
+		!strings.HasPrefix(ct, "application/json") {
+		writeProblem(w, r, http.StatusUnsupportedMediaType, "use application/merge-patch+json", nil)
+		return
+	}
+	u, ok := api.load(w, r)
+	if !ok || !checkIfMatch(w, r, u) {
+		return
+	}
+
+	var patch any
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBodyBytes)).Decode(&patch); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	in, err := patchUser(u, patch)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+
+	u.Name = strings.TrimSpace(in.Name)
+	u.Email = strings.TrimSpace(in.Email)
+	if err := api.apply(u, in.Password, true); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	if err := api.repo.Update(r.Context(), u); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeUser(w, http.StatusOK, u)
+}
+
+func (api *UserAPI) delete(w http.ResponseWriter, r *http.Request) {
+	u, ok := api.load(w, r)
+	if !ok || !checkIfMatch(w, r, u) {
+		return
+	}
+	if err := api.repo.Delete(r.Context(), u.ID, u.Version); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *UserAPI) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var errs ValidationErrors
+
+	limit := defaultPageSize
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPageSize {
+			errs.Add("limit", fmt.Sprintf("must be a number between 1 and %d", maxPageSize))
+		}
+		limit = n
+	}
+	after := 0
+	if s := q.Get("cursor"); s != "" {
+		id, err := decodeCursor(s)
+		if err != nil {
+			errs.Add("cursor", "is invalid")
+		}
+		after = id
+	}
+	if err := errs.Err(); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+
+	users, err := api.repo.List(r.Context())
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+
+	name := strings.ToLower(q.Get("name"))
+	email := normalizeEmail(q.Get("email"))
+	page := userPage{Items: []*User{}}
+	for _, u := range users {
+		if u.ID <= after {
+			continue
+		}
+		if name != "" && !strings.Contains(strings.ToLower(u.Name), name) {
+			continue
+		}
+		if email != "" && normalizeEmail(u.Email) != email {
+			continue
+		}
+		if len(page.Items) == limit {
+			page.NextCursor = encodeCursor(page.Items[limit-1].ID)
+			break
+		}
+		page.Items = append(page.Items, u)
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// load fetches the user named in the path or writes an error response
+func (api *UserAPI) load(w http.ResponseWriter, r *http.Request) (*User, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		writeProblem(w, r, http.StatusNotFound, "no such user", nil)
+		return nil, false
+	}
+	u, err := api.repo.Get(r.Context(), id)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return nil, false
+	}
+	return u, true
+}
+
+// apply validates u and hashes password when one was given
+func (api *UserAPI) apply(u *User, password *string, optional bool) error {
+	var errs ValidationErrors
+	if u.Name == "" {
+		errs.Add("name", "is required")
+	}
+	if u.Email != "" {
+		if addr, err := mail.ParseAddress(u.Email); err != nil || addr.Address != u.Email {
+			errs.Add("email", "is not a valid address")
+		}
+	}
+	if password == nil && !optional {
+		errs.Add("password", "is required")
+	}
+	if password != nil {
+		if err := api.policy.Check(*password, u); err != nil {
+			var perrs ValidationErrors
+			if errors.As(err, &perrs) {
+				errs = append(errs, perrs...)
+			}
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return err
+	}
+
+	if password != nil {
+		encoded, err := api.hasher.Hash(*password)
+		if err != nil {
+			return err
+		}
+		u.Password = encoded
+	}
+	return nil
+}
+
+// patchUser applies a merge patch to the writable view of u
+func patchUser(u *User, patch any) (*userInput, error) {
+	if _, ok := patch.(map[string]any); !ok {
+		return nil, ValidationErrors{{Field: "body", Message: "must be a JSON object"}}
+	}
+
+	doc := map[string]any{"name": u.Name, "email": u.Email}
+	merged, ok := mergePatch(doc, patch).(map[string]any)
+	if !ok {
+		return nil, ValidationErrors{{Field: "body", Message: "must be a JSON object"}}
+	}
+
+	var errs ValidationErrors
+	in := &userInput{}
+	for key, value := range merged {
+		switch key {
+		case "name", "email":
+			s, ok := value.(string)
+			if !ok {
+				errs.Add(key, "must be a string")
+			} else if key == "name" {
+				in.Name = s
+			} else {
+				in.Email = s
+			}
+		case "password":
+			s, ok := value.(string)
+			if !ok {
+				errs.Add(key, "must be a string")
+			} else {
+				in.Password = &s
+			}
+		case "id", "created_at", "updated_at", "version":
+			errs.Add(key, "is read-only")
+		default:
+			errs.Add(key, "is not a known field")
+		}
+	}
+	return in, errs.Err()
+}
+
+// mergePatch implements RFC 7386: objects merge recursively, null removes
+// a member and any other value replaces the target
+func mergePatch(target, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = make(map[string]any)
+	}
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+		} else {
+			targetObj[key] = mergePatch(targetObj[key], value)
+		}
+	}
+	return targetObj
+}
+
+func userETag(u *User) string {
+	return fmt.Sprintf(`"u%d-v%d"`, u.ID, u.Version)
+}
+
+// etagMatches reports whether header lists etag. If-None-Match uses the
+// weak comparison, which ignores a W/ prefix; If-Match must use the
+// strong one, where a weak tag never matches (RFC 7232 section 2.3.2).
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch writes 412 when If-Match is set and does not name u's
+// current version. Requests without If-Match update the latest version.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, u *User) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" || etagMatches(header, userETag(u), false) {
+		return true
+	}
+	w.Header().Set("ETag", userETag(u))
+	writeProblem(w, r, http.StatusPreconditionFailed, "the user has changed since it was fetched", nil)
+	return false
+}
+
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("id:" + strconv.Itoa(id)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	s, ok := strings.CutPrefix(string(b), "id:")
+	if !ok {
+		return 0, fmt.Errorf("bad cursor %q", cursor)
+	}
+	return strconv.Atoi(s)
+}
+
+// apiProblem is an RFC 7807 problem body with per-field errors
+type apiProblem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []fieldError `json:"errors,omitempty"`
+}
+
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func writeAPIError(w http.ResponseWriter, r *http.Request, err error) {
+	var verrs ValidationErrors
+	switch {
+	case errors.As(err, &verrs):
+		fields := make([]fieldError, len(verrs))
+		for i, e := range verrs {
+			fields[i] = fieldError{Field: e.Field, Message: e.Message}
+		}
+		writeProblem(w, r, http.StatusUnprocessableEntity, "", fields)
+	case errors.Is(err, ErrUserNotFound):
+		writeProblem(w, r, http.StatusNotFound, "no such user", nil)
+	case errors.Is(err, ErrDuplicateEmail):
+		writeProblem(w, r, http.StatusConflict, "",
+			[]fieldError{{Field: "email", Message: "is already in use"}})
+	case errors.Is(err, ErrVersionConflict):
+		writeProblem(w, r, http.StatusPreconditionFailed, "the user has changed since it was fetched", nil)
+	default:
+		writeProblem(w, r, http.StatusInternalServerError, "", nil)
+	}
+}
+
+func writeDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		writeProblem(w, r, http.StatusUnprocessableEntity, "",
+			[]fieldError{{Field: typeErr.Field, Message: "has the wrong type"}})
+		return
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		writeProblem(w, r, http.StatusUnprocessableEntity, "",
+			[]fieldError{{Field: strings.Trim(field, `"`), Message: "is not a known field"}})
+		return
+	}
+	writeProblem(w, r, http.StatusBadRequest, "request body is not valid JSON", nil)
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string, fields []fieldError) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiProblem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Errors:   fields,
+	})
+}
+
+func writeUser(w http.ResponseWriter, status int, u *User) {
+	w.Header().Set("ETag", userETag(u))
+	writeJSON(w, status, u)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// apiClient sends JSON requests to a test server
+type apiClient struct {
+	base string
+}
+
+type apiResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+func (c apiClient) do(method, path, body string, headers ...string) (*apiResponse, error) {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.base+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	return &apiResponse{Status: resp.StatusCode, Header: resp.Header, Body: b}, err
+}
+
+// expect checks the status and decodes the body into v (when non-nil)
+func (r *apiResponse) expect(status int, v any) error {
+	if r.Status != status {
+		return fmt.Errorf("status = %d, want %d: %s", r.Status, status, bytes.TrimSpace(r.Body))
+	}
+	if v != nil {
+		return json.Unmarshal(r.Body, v)
+	}
+	return nil
+}
+
+// fields lists the field names in a problem response
+func (r *apiResponse) fields() []string {
+	var p apiProblem
+	json.Unmarshal(r.Body, &p)
+	names := make([]string, len(p.Errors))
+	for i, e := range p.Errors {
+		names[i] = e.Field
+	}
+	return names
+}
+
+type apiScenario struct {
+	name string
+	run  func(c apiClient) error
+}
+
+// TestUserAPI runs the end-to-end scenarios, each against a fresh
+// httptest server
+func TestUserAPI(t *testing.T) {
+	// A cheap hasher keeps the scenarios fast
+	hasher := &PasswordHasher{Algorithm: "pbkdf2-sha256", Iterations: 1000, SaltLength: 16, KeyLength: 32}
+
+	for _, s := range userAPIScenarios {
+		t.Run(s.name, func(t *testing.T) {
+			srv := httptest.NewServer(NewUserAPI(NewMemoryUserRepository(), hasher, DefaultPasswordPolicy()))
+			defer srv.Close()
+			if err := s.run(apiClient{base: srv.URL}); err != nil {
+				t.Errorf("%v", err)
+			}
+		})
+	}
+}
+
+func createUser(c apiClient, name, email string) (*User, string, error) {
+	body := fmt.Sprintf(`{"name":%q,"email":%q,"password":"Correct-Horse-42"}`, name, email)
+	resp, err := c.do("POST", "/users", body)
+	if err != nil {
+		return nil, "", err
+	}
+	var u User
+	if err := resp.expect(http.StatusCreated, &u); err != nil {
+		return nil, "", err
+	}
+	return &u, resp.Header.Get("ETag"), nil
+}
+
+var userAPIScenarios = []apiScenario{
+	{"create returns the stored user", func(c apiClient) error {
+		resp, err := c.do("POST", "/users", `{"name":"Ann","email":"ann@example.com","password":"Correct-Horse-42"}`)
+		if err != nil {
+			return err
+		}
+		var u User
+		if err := resp.expect(http.StatusCreated, &u); err != nil {
+			return err
+		}
+		if u.ID == 0 || u.Version != 1 || u.CreatedAt.IsZero() {
+			return fmt.Errorf("got %+v", u)
+		}
+		if loc := resp.Header.Get("Location"); loc != fmt.Sprintf("/users/%d", u.ID) {
+			return fmt.Errorf("Location = %q", loc)
+		}
+		if resp.Header.Get("ETag") == "" {
+			return fmt.Errorf("missing ETag")
+		}
+		if bytes.Contains(resp.Body, []byte("pbkdf2")) || bytes.Contains(resp.Body, []byte("password")) {
+			return fmt.Errorf("password leaked: %s", resp.Body)
+		}
+		return nil
+	}},
+	{"create reports every invalid field", func(c apiClient) error {
+		resp, err := c.do("POST", "/users", `{"name":" ","email":"not-an-email","password":"short"}`)
+		if err != nil {
+			return err
+		}
+		if err := resp.expect(http.StatusUnprocessableEntity, nil); err != nil {
+			return err
+		}
+		got := strings.Join(resp.fields(), ",")
+		if !strings.Contains(got, "name") || !strings.Contains(got, "email") || !strings.Contains(got, "password") {
+			return fmt.Errorf("fields = %s", got)
+		}
+		return nil
+	}},
+	{"create rejects unknown fields and bad JSON", func(c apiClient) error {
+		resp, err := c.do("POST", "/users", `{"name":"Ann","admin":true}`)
+		if err != nil {
+			return err
+		}
+		if err := resp.expect(http.StatusUnprocessableEntity, nil); err != nil {
+			return err
+		}
+		if f := resp.fields(); len(f) != 1 || f[0] != "admin" {
+			return fmt.Errorf("fields = %v", f)
+		}
+		resp, err = c.do("POST", "/users", `{"name":`)
+		if err != nil {
+			return err
+		}
+		return resp.expect(http.StatusBadRequest, nil)
+	}},
+	{"create rejects a duplicate email", func(c apiClient) error {
+		if _, _, err := createUser(c, "Ann", "ann@example.com"); err != nil {
+			return err
+		}
+		resp, err := c.do("POST", "/users", `{"name":"Other","email":"ANN@example.com","password":"Correct-Horse-42"}`)
+		if err != nil {
+			return err
+		}
+		return resp.expect(http.StatusConflict, nil)
+	}},
+	{"get supports conditional requests", func(c apiClient) error {
+		u, etag, err := createUser(c, "Ann", "ann@example.com")
+		if err != nil {
+			return err
+		}
+		path := fmt.Sprintf("/users/%d", u.ID)
+		resp, err := c.do("GET", path, "")
+		if err != nil {
+			return err
+		}
+		if err := resp.expect(http.StatusOK, nil); err != nil {
+			return err
+		}
+		resp, err = c.do("GET", path, "", "If-None-Match", etag)
+		if err != nil {
+			return err
+		}
+		if err := resp.expect(http.StatusNotModified, nil); err != nil {
+			return err
+		}
+		resp, err = c.do("GET", "/users/999", "")
+		if err != nil {
+			return err
+		}
+		return resp.expect(http.StatusNotFound, nil)
+	}},
+	{"weak ETags only satisfy If-None-Match", func(c apiClient) error {
+		u, etag, err := createUser(c, "Ann", "ann@example.com")
+		if err != nil {
+			return err
+		}
+		path := fmt.Sprintf("/users/%d", u.ID)
+		resp, err := c.do("GET", path, "", "If-None-Match", "W/"+etag)
+		if err != nil {
+			return err
+		}
+		if err := resp.expect(http.StatusNotModified, nil); err != nil {
+			return err
+		}
+		// If-Match needs the strong comparison (RFC 7232 section 3.1)
+		resp, err = c.do("PATCH", path, `{"name":"Ann Lee"}`, "If-Match", "W/"+etag)
+		if err != nil {
+			return err
+		}
+		if err := resp.expect(http.StatusPreconditionFailed, nil); err != nil {
+			return err
+		}
+		resp, err = c.do("DELETE", path, "", "If-Match", "W/"+etag)
+		if err != nil {
+			return err
+		}
+		return resp.expect(http.StatusPreconditionFailed, nil)
+	}},
+	{"patch merges fields", func(c apiClient) error {
+		u, etag, err := createUser(c, "Ann", "ann@example.com")
+		if err != nil {
+			return err
+		}
+		path := fmt.Sprintf("/users/%d", u.ID)
+		resp, err := c.do("PATCH", path, `{"name":"Ann Lee"}`, "If-Match", etag,
+			"Content-Type", "application/merge-patch+json")
+		if err != nil {
+			return err
+		}
+		var patched User
+		if err := resp.expect(http.StatusOK, &patched); err != nil {
+			return err
+		}
+		if patched.Name != "Ann Lee" || patched.Email != "ann@example.com" || patched.Version != 2 {
+			return fmt.Errorf("got %+v", patched)
+		}
+		if resp.Header.Get("ETag") == etag {
+			return fmt.Errorf("ETag did not change")
+		}
+
+		// null removes a member
+		resp, err = c.do("PATCH", path, `{"email":null}`)
+		if err != nil {
+			return err
+		}
+		patched = User{}
+		if err := resp.expect(http.StatusOK, &patched); err != nil {
+			return err
+		}
+		if patched.Email != "" {
+			return fmt.Errorf("email = %q, want removed", patched.Email)
+		}
+		return nil
+	}},
+	{"patch checks If-Match and read-only fields", func(c apiClient) error {
+		u, etag, err := createUser(c, "Ann", "ann@example.com")
+		if err != nil {
+			return err
+		}
+		path := fmt.Sprintf("/users/%d", u.ID)
+		if _, err := c.do("PATCH", path, `{"name":"First"}`, "If-Match", etag); err != nil {
+			return err
+		}
+		resp, err := c.do("PATCH", path, `{"name":"Second"}`, "If-Match", etag)
+		if err != nil {
+			return err
+		}
+		if err := resp.expect(http.StatusPreconditionFailed, nil); err != nil {
+			return err
+		}
+		resp, err = c.do("PATCH", path, `{"id":7,"version":9}`)
+		if err != nil {
+			return err
+		}
+		if err := resp.expect(http.StatusUnprocessableEntity, nil); err != nil {
+			return err
+		}
+		if len(resp.fields()) != 2 {
+			return fmt.Errorf("fields = %v", resp.fields())
+		}
+		return nil
+	}},
+	{"list filters and paginates", func(c apiClient) error {
+		for _, name := range []string{"Ann", "Bob", "Annabel", "Cid", "Dan"} {
+			if _, _, err := createUser(c, name, strings.ToLower(name)+"@example.com"); err != nil {
+				return err
+			}
+		}
+
+		var page userPage
+		resp, err := c.do("GET", "/users?name=ann", "")
+		if err != nil {
+			return err
+		}
+		if err := resp.expect(http.StatusOK, &page); err != nil {
+			return err
+		}
+		if len(page.Items) != 2 {
+			return fmt.Errorf("name filter returned %d users", len(page.Items))
+		}
+
+		resp, err = c.do("GET", "/users?email=BOB@example.com", "")
+		if err != nil {
+			return err
+		}
+		if err := resp.expect(http.StatusOK, &page); err != nil {
+			return err
+		}
+		if len(page.Items) != 1 || page.Items[0].Name != "Bob" {
+			return fmt.Errorf("email filter returned %+v", page.Items)
+		}
+
+		var names []string
+		cursor := ""
+		for pages := 0; pages < 10; pages++ {
+			resp, err = c.do("GET", "/users?limit=2&cursor="+cursor, "")
+			if err != nil {
+				return err
+			}
+			page = userPage{}
+			if err := resp.expect(http.StatusOK, &page); err != nil {
+				return err
+			}
+			for _, u := range page.Items {
+				names = append(names, u.Name)
+			}
+			if cursor = page.NextCursor; cursor == "" {
+				break
+			}
+		}
+		if got := strings.Join(names, ","); got != "Ann,Bob,Annabel,Cid,Dan" {
+			return fmt.Errorf("paged through %s", got)
+		}
+		return nil
+	}},
+	{"list rejects bad paging parameters", func(c apiClient) error {
+		resp, err := c.do("GET", "/users?limit=500&cursor=bogus", "")
+		if err != nil {
+			return err
+		}
+		if err := resp.expect(http.StatusUnprocessableEntity, nil); err != nil {
+			return err
+		}
+		if f := strings.Join(resp.fields(), ","); f != "limit,cursor" {
+			return fmt.Errorf("fields = %s", f)
+		}
+		return nil
+	}},
+	{"delete honours If-Match", func(c apiClient) error {
+		u, _, err := createUser(c, "Ann", "ann@example.com")
+		if err != nil {
+			return err
+		}
+		path := fmt.Sprintf("/users/%d", u.ID)
+		resp, err := c.do("DELETE", path, "", "If-Match", `"u1-v9"`)
+		if err != nil {
+			return err
+		}
+		if err := resp.expect(http.StatusPreconditionFailed, nil); err != nil {
+			return err
+		}
+		resp, err = c.do("DELETE", path, "", "If-Match", userETag(u))
+		if err != nil {
+			return err
+		}
+		if err := resp.expect(http.StatusNoContent, nil); err != nil {
+			return err
+		}
+		resp, err = c.do("GET", path, "")
+		if err != nil {
+			return err
+		}
+		return resp.expect(http.StatusNotFound, nil)
+	}},
+}
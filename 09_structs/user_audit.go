@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrAuditTampered = errors.New("audit log hash chain broken")
+
+type AuditAction string
+
+const (
+	AuditCreate AuditAction = "create"
+	AuditUpdate AuditAction = "update"
+	AuditDelete AuditAction = "delete"
+)
+
+// AuditEntry records one mutation of a user. Changes is the JSON Patch
+// from the previous state, so replaying entries rebuilds the user.
+// Password hashes and sensitive:"encrypt" fields such as Email never
+// enter the log, which is not encrypted; a change to them shows up only
+// in Fields.
+type AuditEntry struct {
+	Seq      int         `json:"seq"`
+	UserID   int         `json:"user_id"`
+	Action   AuditAction `json:"action"`
+	Actor    string      `json:"actor"`
+	Reason   string      `json:"reason,omitempty"`
+	At       time.Time   `json:"at"`
+	Fields   []string    `json:"fields"`
+	Changes  JSONPatch   `json:"changes"`
+	PrevHash string      `json:"prev_hash"`
+	Hash     string      `json:"hash"`
+}
+
+// computeHash covers every field but Hash itself, chaining each entry
+// to the one before it
+func (e AuditEntry) computeHash() string {
+	e.Hash = ""
+	b, _ := json.Marshal(e)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditLog is an append-only, hash-chained list of AuditEntry. With a
+// path, every entry is also appended to a JSON Lines file.
+type AuditLog struct {
+	Now func() time.Time
+
+	mu      sync.RWMutex
+	entries []AuditEntry
+	file    *os.File
+}
+
+func NewAuditLog() *AuditLog {
+	return &AuditLog{Now: time.Now}
+}
+
+// OpenAuditLog loads path, verifies its hash chain and appends to it
+func OpenAuditLog(path string) (*AuditLog, error) {
+	l := NewAuditLog()
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		l.entries = append(l.entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	if err := l.Verify(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	l.file = f
+	return l, nil
+}
+
+func (l *AuditLog) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// Record appends the change from before to after; nil before means the
+// user was created and nil after means it was deleted
+func (l *AuditLog) Record(actor, reason string, before, after *User) (AuditEntry, error) {
+	var from, to User
+	e := AuditEntry{Actor: actor, Reason: reason, Action: AuditUpdate}
+	switch {
+	case before == nil && after == nil:
+		return AuditEntry{}, errors.New("audit: nothing to record")
+	case before == nil:
+		e.Action, to = AuditCreate, *after
+	case after == nil:
+		e.Action, from = AuditDelete, *before
+	default:
+		from, to = *before, *after
+	}
+	e.UserID = max(from.ID, to.ID)
+
+	changes, err := Diff(from, to)
+	if err != nil {
+		return AuditEntry{}, fmt.Errorf("audit: %w", err)
+	}
+	e.Fields = changedFields(changes)
+	e.Changes = slices.DeleteFunc(changes, func(op PatchOp) bool {
+		name, _, _ := strings.Cut(strings.TrimPrefix(op.Path, "/"), "/")
+		return slices.Contains(auditedSecrets, unescapePointer(name))
+	})
+	if from.Password != to.Password && e.Action == AuditUpdate {
+		e.Fields = append(e.Fields, "password")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e.Seq = len(l.entries) + 1
+	e.At = l.Now().UTC()
+	if len(l.entries) > 0 {
+		e.PrevHash = l.entries[len(l.entries)-1].Hash
+	}
+	e.Hash = e.computeHash()
+
+	if l.file != nil {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return AuditEntry{}, err
+		}
+		if _, err := l.file.Write(append(line, '\n')); err != nil {
+			return AuditEntry{}, fmt.Errorf("audit: %w", err)
+		}
+	}
+	l.entries = append(l.entries, e)
+	return e, nil
+}
+
+// auditedSecrets are the User members kept out of Changes
+var auditedSecrets = encryptedMembers(reflect.TypeFor[User]())
+
+// changedFields lists the top-level members a patch touches
+func changedFields(patch JSONPatch) []string {
+	var fields []string
+	seen := make(map[string]bool)
+	for _, op := range patch {
+		name, _, _ := strings.Cut(strings.TrimPrefix(op.Path, "/"), "/")
+		if name = unescapePointer(name); !seen[name] {
+			seen[name] = true
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// Verify recomputes the hash chain and reports the first broken entry
+func (l *AuditLog) Verify() error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	prev := ""
+	for i, e := range l.entries {
+		if e.Seq != i+1 || e.PrevHash != prev || e.computeHash() != e.Hash {
+			return fmt.Errorf("%w at entry %d", ErrAuditTampered, i+1)
+		}
+		prev = e.Hash
+	}
+	return nil
+}
+
+// AuditQuery selects entries; zero fields match everything and the time
+// range includes From and excludes To
+type AuditQuery struct {
+	UserID   int
+	From, To time.Time
+}
+
+func (l *AuditLog) Query(q AuditQuery) []AuditEntry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var result []AuditEntry
+	for _, e := range l.entries {
+		switch {
+		case q.UserID != 0 && e.UserID != q.UserID:
+		case !q.From.IsZero() && e.At.Before(q.From):
+		case !q.To.IsZero() && !e.At.Before(q.To):
+		default:
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// UserAt rebuilds user id as it was at t by replaying its entries.
+// Password and encrypted fields such as Email are always empty because
+// the log never stores them.
+func (l *AuditLog) UserAt(id int, t time.Time) (*User, error) {
+	var u *User
+	for _, e := range l.Query(AuditQuery{UserID: id}) {
+		if e.At.After(t) {
+			break
+		}
+		switch e.Action {
+		case AuditDelete:
+			u = nil
+			continue
+		case AuditCreate:
+			u = &User{}
+		}
+		if u == nil {
+			return nil, fmt.Errorf("audit entry %d updates user %d before it exists", e.Seq, id)
+		}
+		if err := ApplyPatch(u, e.Changes); err != nil {
+			return nil, fmt.Errorf("audit entry %d: %w", e.Seq, err)
+		}
+	}
+	if u == nil {
+		return nil, fmt.Errorf("user %d at %s: %w", id, t.Format(time.RFC3339), ErrUserNotFound)
+	}
+	return u, nil
+}
+
+type auditInfoKey struct{}
+
+type auditInfo struct {
+	actor, reason string
+}
+
+// WithAuditInfo tells AuditedUserRepository who is making the changes in
+// ctx and why
+func WithAuditInfo(ctx context.Context, actor, reason string) context.Context {
+	return context.WithValue(ctx, auditInfoKey{}, auditInfo{actor, reason})
+}
+
+func auditInfoFrom(ctx context.Context) auditInfo {
+	if info, ok := ctx.Value(auditInfoKey{}).(auditInfo); ok {
+		return info
+	}
+	return auditInfo{actor: "unknown"}
+}
+
+// AuditedUserRepository records every successful mutation of the
+// wrapped repository in log. Mutations are serialized so the log order
+// matches the order they were applied in. If recording fails the
+// mutation has still happened and the error says so.
+type AuditedUserRepository struct {
+	UserRepository
+	mu  sync.Mutex
+	log *AuditLog
+}
+
+func NewAuditedUserRepository(repo UserRepository, log *AuditLog) *AuditedUserRepository {
+	return &AuditedUserRepository{UserRepository: repo, log: log}
+}
+
+func (r *AuditedUserRepository) Create(ctx context.Context, u *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.UserRepository.Create(ctx, u); err != nil {
+		return err
+	}
+	return r.record(ctx, nil, u)
+}
+
+func (r *AuditedUserRepository) Update(ctx context.Context, u *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	before, err := r.UserRepository.Get(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	if err := r.UserRepository.Update(ctx, u); err != nil {
+		return err
+	}
+	return r.record(ctx, before, u)
+}
+
+func (r *AuditedUserRepository) Delete(ctx context.Context, id int, version int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	before, err := r.UserRepository.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.UserRepository.Delete(ctx, id, version); err != nil {
+		return err
+	}
+	return r.record(ctx, before, nil)
+}
+
+func (r *AuditedUserRepository) record(ctx context.Context, before, after *User) error {
+	info := auditInfoFrom(ctx)
+	if _, err := r.log.Record(info.actor, info.reason, before, after); err != nil {
+		return fmt.Errorf("change applied but not audited: %w", err)
+	}
+	return nil
+}
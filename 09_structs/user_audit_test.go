@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditLogKeepsEncryptedFieldsOut(t *testing.T) {
+	log := NewAuditLog()
+	ann := &User{ID: 1, Name: "Ann", Email: "ann@example.com", Version: 1}
+	if _, err := log.Record("test", "", nil, ann); err != nil {
+		t.Fatal(err)
+	}
+	renamed := *ann
+	renamed.Email = "ann.lee@example.com"
+	renamed.Version = 2
+	e, err := log.Record("test", "", ann, &renamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Contains(e.Fields, "email") {
+		t.Errorf("fields = %v, want email listed", e.Fields)
+	}
+	for _, entry := range log.Query(AuditQuery{UserID: 1}) {
+		line, _ := json.Marshal(entry)
+		if bytes.Contains(line, []byte("example.com")) {
+			t.Errorf("entry %d leaks the email: %s", entry.Seq, line)
+		}
+	}
+	if err := log.Verify(); err != nil {
+		t.Error(err)
+	}
+}
+
+var auditStart = time.Date(2024, time.June, 1, 9, 0, 0, 0, time.UTC)
+
+// auditedHistory writes a day-by-day history to a log file: Carol is
+// created, renamed twice and deleted, and Dan is created on day two
+func auditedHistory(t *testing.T) (path string, carol, dan int) {
+	t.Helper()
+	path = filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	day := 0
+	log.Now = func() time.Time { return auditStart.AddDate(0, 0, day) }
+	repo := NewAuditedUserRepository(NewMemoryUserRepository(), log)
+	ctx := WithAuditInfo(context.Background(), "test", "")
+
+	c := &User{Name: "Carol", Email: "carol@example.com"}
+	d := &User{Name: "Dan", Email: "dan@example.com"}
+	steps := []struct {
+		day int
+		do  func() error
+	}{
+		{0, func() error { return repo.Create(ctx, c) }},
+		{1, func() error { c.Name = "Carol Smith"; return repo.Update(ctx, c) }},
+		{1, func() error { return repo.Create(ctx, d) }},
+		{2, func() error { c.Name = "Carol Jones"; return repo.Update(ctx, c) }},
+		{3, func() error { return repo.Delete(ctx, c.ID, c.Version) }},
+	}
+	for i, step := range steps {
+		day = step.day
+		if err := step.do(); err != nil {
+			t.Fatalf("step %d: %v", i+1, err)
+		}
+	}
+	return path, c.ID, d.ID
+}
+
+func TestAuditLogDetectsTampering(t *testing.T) {
+	path, _, _ := auditedHistory(t)
+	log, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatalf("untouched log: %v", err)
+	}
+	log.Close()
+	if n := len(log.Query(AuditQuery{})); n != 5 {
+		t.Fatalf("loaded %d entries, want 5", n)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	edits := map[string]string{
+		"edited actor":    strings.Replace(string(data), `"actor":"test"`, `"actor":"admin"`, 1),
+		"edited change":   strings.Replace(string(data), "Carol Smith", "Carol White", 1),
+		"dropped entry":   strings.Join(slices.Delete(slices.Clone(lines), 1, 2), ""),
+		"swapped entries": lines[1] + lines[0] + strings.Join(lines[2:], ""),
+	}
+	for name, edited := range edits {
+		t.Run(name, func(t *testing.T) {
+			tampered := filepath.Join(t.TempDir(), "audit.jsonl")
+			if err := os.WriteFile(tampered, []byte(edited), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := OpenAuditLog(tampered); !errors.Is(err, ErrAuditTampered) {
+				t.Errorf("OpenAuditLog = %v, want ErrAuditTampered", err)
+			}
+		})
+	}
+
+	log.entries[2].Reason = "rewritten in memory"
+	if err := log.Verify(); !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("Verify after editing entry 3 = %v, want ErrAuditTampered", err)
+	}
+}
+
+func TestAuditLogUserAt(t *testing.T) {
+	path, carol, dan := auditedHistory(t)
+	log, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	tests := []struct {
+		id      int
+		at      time.Time
+		name    string
+		version int
+	}{
+		{carol, auditStart.Add(-time.Hour), "", 0},
+		{carol, auditStart, "Carol", 1},
+		{carol, auditStart.Add(20 * time.Hour), "Carol", 1},
+		{carol, auditStart.AddDate(0, 0, 1), "Carol Smith", 2},
+		{carol, auditStart.AddDate(0, 0, 2).Add(time.Hour), "Carol Jones", 3},
+		{carol, auditStart.AddDate(0, 0, 3), "", 0},
+		{dan, auditStart, "", 0},
+		{dan, auditStart.AddDate(0, 0, 5), "Dan", 1},
+	}
+	for _, tt := range tests {
+		u, err := log.UserAt(tt.id, tt.at)
+		if tt.name == "" {
+			if !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("UserAt(%d, %s) = %v, %v; want ErrUserNotFound", tt.id, tt.at, u, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("UserAt(%d, %s): %v", tt.id, tt.at, err)
+			continue
+		}
+		if u.ID != tt.id || u.Name != tt.name || u.Version != tt.version || u.Email != "" {
+			t.Errorf("UserAt(%d, %s) = %+v, want %s version %d without an email", tt.id, tt.at, u, tt.name, tt.version)
+		}
+	}
+}
+
+func TestAuditLogQuery(t *testing.T) {
+	path, carol, dan := auditedHistory(t)
+	log, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	day := func(n int) time.Time { return auditStart.AddDate(0, 0, n) }
+	tests := []struct {
+		name string
+		q    AuditQuery
+		want []int // Seq of the matching entries
+	}{
+		{"everything", AuditQuery{}, []int{1, 2, 3, 4, 5}},
+		{"by user", AuditQuery{UserID: carol}, []int{1, 2, 4, 5}},
+		{"other user", AuditQuery{UserID: dan}, []int{3}},
+		{"unknown user", AuditQuery{UserID: 99}, nil},
+		{"From is included", AuditQuery{From: day(1)}, []int{2, 3, 4, 5}},
+		{"To is excluded", AuditQuery{To: day(1)}, []int{1}},
+		{"one day", AuditQuery{From: day(1), To: day(2)}, []int{2, 3}},
+		{"user and range", AuditQuery{UserID: carol, From: day(1), To: day(3)}, []int{2, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, e := range log.Query(tt.q) {
+				got = append(got, e.Seq)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Query = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrDuplicateEmail  = errors.New("email already in use")
+	ErrVersionConflict = errors.New("user was modified concurrently")
+)
+
+// UserRepository stores users. Create fills in ID, timestamps and Version;
+// Update and Delete only succeed when the caller's Version is current.
+type UserRepository interface {
+	Create(ctx context.Context, u *User) error
+	Get(ctx context.Context, id int) (*User, error)
+	Update(ctx context.Context, u *User) error
+	Delete(ctx context.Context, id int, version int) error
+	List(ctx context.Context) ([]*User, error)
+}
+
+// MemoryUserRepository keeps users in a map
+type MemoryUserRepository struct {
+	mu     sync.RWMutex
+	users  map[int]User
+	nextID int
+	now    func() time.Time
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{
+		users:  make(map[int]User),
+		nextID: 1,
+		now:    time.Now,
+	}
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, u *User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, err := r.create(*u)
+	if err != nil {
+		return err
+	}
+	*u = stored
+	return nil
+}
+
+func (r *MemoryUserRepository) Get(ctx context.Context, id int) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	u, ok := r.users[id]
+	if !ok {
+		return nil, fmt.Errorf("get user %d: %w", id, ErrUserNotFound)
+	}
+	return &u, nil
+}
+
+func (r *MemoryUserRepository) Update(ctx context.Context, u *User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, err := r.update(*u)
+	if err != nil {
+		return err
+	}
+	*u = stored
+	return nil
+}
+
+func (r *MemoryUserRepository) Delete(ctx context.Context, id int, version int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.delete(id, version)
+}
+
+func (r *MemoryUserRepository) List(ctx context.Context) ([]*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]*User, 0, len(r.users))
+	for _, u := range r.users {
+		u := u
+		users = append(users, &u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+// The lowercase methods expect r.mu to be held. create and update take
+// the caller's user by value and return what was stored, so a failed
+// save never leaves the caller holding an ID or Version that isn't real.
+
+func (r *MemoryUserRepository) create(u User) (User, error) {
+	if r.emailTaken(u.Email, 0) {
+		return User{}, fmt.Errorf("create user %q: %w", u.Email, ErrDuplicateEmail)
+	}
+	now := r.now()
+	u.ID = r.nextID
+	u.CreatedAt = now
+	u.UpdatedAt = now
+	u.Version = 1
+	r.nextID++
+	r.users[u.ID] = u
+	return u, nil
+}
+
+func (r *MemoryUserRepository) update(u User) (User, error) {
+	stored, ok := r.users[u.ID]
+	if !ok {
+		return User{}, fmt.Errorf("update user %d: %w", u.ID, ErrUserNotFound)
+	}
+	if stored.Version != u.Version {
+		return User{}, fmt.Errorf("update user %d at version %d (current %d): %w",
+			u.ID, u.Version, stored.Version, ErrVersionConflict)
+	}
+	if r.emailTaken(u.Email, u.ID) {
+		return User{}, fmt.Errorf("update user %d: %w", u.ID, ErrDuplicateEmail)
+	}
+	u.CreatedAt = stored.CreatedAt
+	u.UpdatedAt = r.now()
+	u.Version++
+	r.users[u.ID] = u
+	return u, nil
+}
+
+func (r *MemoryUserRepository) delete(id int, version int) error {
+	stored, ok := r.users[id]
+	if !ok {
+		return fmt.Errorf("delete user %d: %w", id, ErrUserNotFound)
+	}
+	if stored.Version != version {
+		return fmt.Errorf("delete user %d at version %d (current %d): %w",
+			id, version, stored.Version, ErrVersionConflict)
+	}
+	delete(r.users, id)
+	return nil
+}
+
+// emailTaken reports whether another user already has email.
+// Empty emails are allowed any number of times.
+func (r *MemoryUserRepository) emailTaken(email string, exceptID int) bool {
+	key := normalizeEmail(email)
+	if key == "" {
+		return false
+	}
+	for id, u := range r.users {
+		if id != exceptID && normalizeEmail(u.Email) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// FileUserRepository persists users to a JSON Lines file, one user per line
+// after a header that records the next ID, so IDs of deleted users are
+// never handed out again. The whole file is rewritten atomically after
+// each change.
+type FileUserRepository struct {
+	mu   sync.Mutex
+	path string
+	mem  *MemoryUserRepository
+	keys *KeyRing // Seals sensitive fields when set
+	mode EncryptionMode
+}
+
+// EncryptionMode says what OpenEncryptedFileUserRepository does with
+// sensitive:"encrypt" fields it finds in plaintext
+type EncryptionMode int
+
+const (
+	// RequireSealed rejects the file with ErrNotSealed, since anyone able
+	// to write it could otherwise replace a sealed value with their own
+	RequireSealed EncryptionMode = iota
+	// MigratePlaintext reads them as they are, for files written before
+	// encryption was enabled; they are sealed on the next save or Reseal
+	MigratePlaintext
+)
+
+// fileHeader is the first line of the file
+type fileHeader struct {
+	NextID int `json:"next_id"`
+}
+
+// userRecord is the on-disk form of User; it keeps Password,
+// which User's json tags leave out
+type userRecord struct {
+	User
+	Password string `json:"password" sensitive:"encrypt"`
+}
+
+func OpenFileUserRepository(path string) (*FileUserRepository, error) {
+	return openFileUserRepository(path, nil, RequireSealed)
+}
+
+// OpenEncryptedFileUserRepository stores fields tagged sensitive:"encrypt"
+// (email and password hash) sealed with keys and bound to the user's ID,
+// so a sealed value copied into another user's record does not open.
+// mode decides whether plaintext fields are an error or a migration.
+func OpenEncryptedFileUserRepository(path string, keys *KeyRing, mode EncryptionMode) (*FileUserRepository, error) {
+	return openFileUserRepository(path, keys, mode)
+}
+
+func openFileUserRepository(path string, keys *KeyRing, mode EncryptionMode) (*FileUserRepository, error) {
+	r := &FileUserRepository{path: path, mem: NewMemoryUserRepository(), keys: keys, mode: mode}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		if line == 1 {
+			var h fileHeader
+			if json.Unmarshal(scanner.Bytes(), &h) == nil && h.NextID > 0 {
+				r.mem.nextID = max(r.mem.nextID, h.NextID)
+				continue
+			}
+		}
+		var rec userRecord
+		if err := r.unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		u := rec.User
+		u.Password = rec.Password
+		r.mem.users[u.ID] = u
+		if u.ID >= r.mem.nextID {
+			r.mem.nextID = u.ID + 1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return r, nil
+}
+
+func (r *FileUserRepository) Create(ctx context.Context, u *User) error {
+	var stored User
+	err := r.mutate(ctx, func() (err error) {
+		stored, err = r.mem.create(*u)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	*u = stored
+	return nil
+}
+
+func (r *FileUserRepository) Get(ctx context.Context, id int) (*User, error) {
+	return r.mem.Get(ctx, id)
+}
+
+func (r *FileUserRepository) Update(ctx context.Context, u *User) error {
+	var stored User
+	err := r.mutate(ctx, func() (err error) {
+		stored, err = r.mem.update(*u)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	*u = stored
+	return nil
+}
+
+func (r *FileUserRepository) Delete(ctx context.Context, id int, version int) error {
+	return r.mutate(ctx, func() error { return r.mem.delete(id, version) })
+}
+
+func (r *FileUserRepository) List(ctx context.Context) ([]*User, error) {
+	return r.mem.List(ctx)
+}
+
+// mutate applies op in memory and saves the result, rolling the
+// in-memory state back if the file cannot be written
+func (r *FileUserRepository) mutate(ctx context.Context, op func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mem.mu.Lock()
+	defer r.mem.mu.Unlock()
+
+	backup := make(map[int]User, len(r.mem.users))
+	for id, u := range r.mem.users {
+		backup[id] = u
+	}
+	backupNextID := r.mem.nextID
+
+	if err := op(); err != nil {
+		return err
+	}
+	if err := r.save(); err != nil {
+		r.mem.users = backup
+		r.mem.nextID = backupNextID
+		return err
+	}
+	return nil
+}
+
+func (r *FileUserRepository) save() error {
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	ids := make([]int, 0, len(r.mem.users))
+	for id := range r.mem.users {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	w := bufio.NewWriter(tmp)
+	header, _ := json.Marshal(fileHeader{NextID: r.mem.nextID})
+	w.Write(append(header, '\n'))
+	for _, id := range ids {
+		u := r.mem.users[id]
+		line, err := r.marshal(userRecord{User: u, Password: u.Password})
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
+
+// Reseal rewrites the file, sealing every record with the active key;
+// run it after KeyRing.Rotate and before retiring the old key
+func (r *FileUserRepository) Reseal() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mem.mu.Lock()
+	defer r.mem.mu.Unlock()
+	return r.save()
+}
+
+func (r *FileUserRepository) marshal(rec userRecord) ([]byte, error) {
+	if r.keys != nil {
+		return r.keys.Marshal(rec, userSealingRecord(rec.ID))
+	}
+	return json.Marshal(rec)
+}
+
+func (r *FileUserRepository) unmarshal(line []byte, rec *userRecord) error {
+	if r.keys == nil {
+		return json.Unmarshal(line, rec)
+	}
+	// The ID is stored in the clear and names the record the sealed
+	// fields were bound to
+	var id struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal(line, &id); err != nil {
+		return err
+	}
+	if r.mode == MigratePlaintext {
+		return r.keys.UnmarshalPlaintext(line, rec, userSealingRecord(id.ID))
+	}
+	return r.keys.Unmarshal(line, rec, userSealingRecord(id.ID))
+}
+
+func userSealingRecord(id int) string {
+	return "user/" + strconv.Itoa(id)
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// repoCase is one conformance case, run against a fresh repository of
+// every backend
+type repoCase struct {
+	name string
+	run  func(ctx context.Context, repo UserRepository) error
+}
+
+var userRepositoryBackends = []struct {
+	name string
+	open func(t *testing.T) (UserRepository, error)
+}{
+	{"memory", func(t *testing.T) (UserRepository, error) {
+		return NewMemoryUserRepository(), nil
+	}},
+	{"audited", func(t *testing.T) (UserRepository, error) {
+		return NewAuditedUserRepository(NewMemoryUserRepository(), NewAuditLog()), nil
+	}},
+	{"file", func(t *testing.T) (UserRepository, error) {
+		return OpenFileUserRepository(filepath.Join(t.TempDir(), "users.jsonl"))
+	}},
+	{"encrypted", func(t *testing.T) (UserRepository, error) {
+		keys, err := NewKeyRing()
+		if err != nil {
+			return nil, err
+		}
+		return OpenEncryptedFileUserRepository(filepath.Join(t.TempDir(), "users.jsonl"), keys, RequireSealed)
+	}},
+}
+
+func TestUserRepository(t *testing.T) {
+	for _, backend := range userRepositoryBackends {
+		for _, c := range userRepositoryCases {
+			t.Run(backend.name+"/"+c.name, func(t *testing.T) {
+				repo, err := backend.open(t)
+				if err != nil {
+					t.Fatalf("open: %v", err)
+				}
+				if err := c.run(context.Background(), repo); err != nil {
+					t.Errorf("%v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestFileUserRepositoryKeepsIDsAfterDelete(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "users.jsonl")
+	repo, err := OpenFileUserRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ann := &User{Name: "Ann"}
+	bob := &User{Name: "Bob"}
+	repo.Create(ctx, ann)
+	repo.Create(ctx, bob)
+	if err := repo.Delete(ctx, bob.ID, bob.Version); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenFileUserRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cat := &User{Name: "Cat"}
+	if err := reopened.Create(ctx, cat); err != nil {
+		t.Fatal(err)
+	}
+	if cat.ID <= bob.ID {
+		t.Errorf("new user got id %d, deleted user had %d", cat.ID, bob.ID)
+	}
+}
+
+func TestFileUserRepositoryFailedSaveLeavesUserUnchanged(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "gone")
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := OpenFileUserRepository(filepath.Join(dir, "users.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &User{Name: "Ann"}
+	if err := repo.Create(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	os.RemoveAll(dir)
+
+	before := *u
+	u.Name = "Ann Lee"
+	if err := repo.Update(ctx, u); err == nil {
+		t.Fatal("update saved to a missing directory")
+	}
+	if u.Version != before.Version || !u.UpdatedAt.Equal(before.UpdatedAt) {
+		t.Errorf("failed update changed the caller's user: version %d, updated %v", u.Version, u.UpdatedAt)
+	}
+	fresh := &User{Name: "Bob"}
+	if err := repo.Create(ctx, fresh); err == nil {
+		t.Fatal("create saved to a missing directory")
+	}
+	if fresh.ID != 0 || fresh.Version != 0 {
+		t.Errorf("failed create changed the caller's user: %+v", fresh)
+	}
+	if got, _ := repo.Get(ctx, u.ID); got.Version != before.Version {
+		t.Errorf("stored version = %d, want %d", got.Version, before.Version)
+	}
+}
+
+var userRepositoryCases = []repoCase{
+	{"create assigns id, timestamps and version", func(ctx context.Context, repo UserRepository) error {
+		a := &User{Name: "Ann", Email: "ann@example.com"}
+		b := &User{Name: "Bob", Email: "bob@example.com"}
+		if err := repo.Create(ctx, a); err != nil {
+			return err
+		}
+		if err := repo.Create(ctx, b); err != nil {
+			return err
+		}
+		if a.ID == 0 || a.ID == b.ID {
+			return fmt.Errorf("ids %d and %d are not unique", a.ID, b.ID)
+		}
+		if a.CreatedAt.IsZero() || !a.UpdatedAt.Equal(a.CreatedAt) {
+			return fmt.Errorf("timestamps not set: %v / %v", a.CreatedAt, a.UpdatedAt)
+		}
+		if a.Version != 1 {
+			return fmt.Errorf("version = %d, want 1", a.Version)
+		}
+		return nil
+	}},
+	{"get returns an isolated copy", func(ctx context.Context, repo UserRepository) error {
+		u := &User{Name: "Ann", Email: "ann@example.com", Password: "hash"}
+		if err := repo.Create(ctx, u); err != nil {
+			return err
+		}
+		got, err := repo.Get(ctx, u.ID)
+		if err != nil {
+			return err
+		}
+		if got.Name != "Ann" || got.Password != "hash" {
+			return fmt.Errorf("got %+v", got)
+		}
+		got.Name = "changed"
+		again, _ := repo.Get(ctx, u.ID)
+		if again.Name != "Ann" {
+			return errors.New("modifying a returned user changed the stored one")
+		}
+		return nil
+	}},
+	{"get unknown id", func(ctx context.Context, repo UserRepository) error {
+		if _, err := repo.Get(ctx, 999); !errors.Is(err, ErrUserNotFound) {
+			return fmt.Errorf("err = %v, want ErrUserNotFound", err)
+		}
+		return nil
+	}},
+	{"email must be unique", func(ctx context.Context, repo UserRepository) error {
+		if err := repo.Create(ctx, &User{Name: "Ann", Email: "ann@example.com"}); err != nil {
+			return err
+		}
+		err := repo.Create(ctx, &User{Name: "Imposter", Email: " ANN@example.com"})
+		if !errors.Is(err, ErrDuplicateEmail) {
+			return fmt.Errorf("err = %v, want ErrDuplicateEmail", err)
+		}
+		// Users without an email don't collide
+		if err := repo.Create(ctx, &User{Name: "X"}); err != nil {
+			return err
+		}
+		return repo.Create(ctx, &User{Name: "Y"})
+	}},
+	{"update bumps version and keeps created_at", func(ctx context.Context, repo UserRepository) error {
+		u := &User{Name: "Ann", Email: "ann@example.com"}
+		if err := repo.Create(ctx, u); err != nil {
+			return err
+		}
+		created := u.CreatedAt
+		u.Name = "Ann Lee"
+		if err := repo.Update(ctx, u); err != nil {
+			return err
+		}
+		got, err := repo.Get(ctx, u.ID)
+		if err != nil {
+			return err
+		}
+		if got.Name != "Ann Lee" || got.Version != 2 || u.Version != 2 {
+			return fmt.Errorf("got %+v", got)
+		}
+		if !got.CreatedAt.Equal(created) || got.UpdatedAt.Before(created) {
+			return fmt.Errorf("timestamps %v / %v", got.CreatedAt, got.UpdatedAt)
+		}
+		return nil
+	}},
+	{"stale update is rejected", func(ctx context.Context, repo UserRepository) error {
+		u := &User{Name: "Ann"}
+		if err := repo.Create(ctx, u); err != nil {
+			return err
+		}
+		first, _ := repo.Get(ctx, u.ID)
+		second, _ := repo.Get(ctx, u.ID)
+		if err := repo.Update(ctx, first); err != nil {
+			return err
+		}
+		if err := repo.Update(ctx, second); !errors.Is(err, ErrVersionConflict) {
+			return fmt.Errorf("err = %v, want ErrVersionConflict", err)
+		}
+		return nil
+	}},
+	{"update cannot steal an email", func(ctx context.Context, repo UserRepository) error {
+		a := &User{Name: "Ann", Email: "ann@example.com"}
+		b := &User{Name: "Bob", Email: "bob@example.com"}
+		repo.Create(ctx, a)
+		repo.Create(ctx, b)
+		b.Email = "ann@example.com"
+		if err := repo.Update(ctx, b); !errors.Is(err, ErrDuplicateEmail) {
+			return fmt.Errorf("err = %v, want ErrDuplicateEmail", err)
+		}
+		return nil
+	}},
+	{"update unknown id", func(ctx context.Context, repo UserRepository) error {
+		if err := repo.Update(ctx, &User{ID: 42, Version: 1}); !errors.Is(err, ErrUserNotFound) {
+			return fmt.Errorf("err = %v, want ErrUserNotFound", err)
+		}
+		return nil
+	}},
+	{"delete checks version", func(ctx context.Context, repo UserRepository) error {
+		u := &User{Name: "Ann"}
+		if err := repo.Create(ctx, u); err != nil {
+			return err
+		}
+		if err := repo.Delete(ctx, u.ID, u.Version+1); !errors.Is(err, ErrVersionConflict) {
+			return fmt.Errorf("err = %v, want ErrVersionConflict", err)
+		}
+		if err := repo.Delete(ctx, u.ID, u.Version); err != nil {
+			return err
+		}
+		if _, err := repo.Get(ctx, u.ID); !errors.Is(err, ErrUserNotFound) {
+			return fmt.Errorf("deleted user still found: %v", err)
+		}
+		if err := repo.Delete(ctx, u.ID, u.Version); !errors.Is(err, ErrUserNotFound) {
+			return fmt.Errorf("err = %v, want ErrUserNotFound", err)
+		}
+		return nil
+	}},
+	{"list is ordered by id", func(ctx context.Context, repo UserRepository) error {
+		for _, name := range []string{"C", "A", "B"} {
+			if err := repo.Create(ctx, &User{Name: name}); err != nil {
+				return err
+			}
+		}
+		users, err := repo.List(ctx)
+		if err != nil {
+			return err
+		}
+		if len(users) != 3 {
+			return fmt.Errorf("len = %d, want 3", len(users))
+		}
+		for i := 1; i < len(users); i++ {
+			if users[i-1].ID >= users[i].ID {
+				return fmt.Errorf("ids out of order: %d, %d", users[i-1].ID, users[i].ID)
+			}
+		}
+		return nil
+	}},
+	{"cancelled context", func(_ context.Context, repo UserRepository) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := repo.Create(ctx, &User{Name: "Ann"}); !errors.Is(err, context.Canceled) {
+			return fmt.Errorf("err = %v, want context.Canceled", err)
+		}
+		return nil
+	}},
+}
@@ -2,10 +2,12 @@ package main
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"sort"
-	"strings"
 )
 
 // Example 1: Interface composition
@@ -113,6 +115,25 @@ func describe(i interface{}) {
 	}
 }
 
+// Example 8: Interface composition with embedding
+type LogWriter interface {
+	io.Writer
+	Log(message string)
+}
+
+type ConsoleLogger struct {
+	prefix string
+}
+
+func (c ConsoleLogger) Write(p []byte) (n int, err error) {
+	fmt.Printf("%s: %s", c.prefix, string(p))
+	return len(p), nil
+}
+
+func (c ConsoleLogger) Log(message string) {
+	c.Write([]byte(message + "\n"))
+}
+
 func main() {
 	// Example 1: Interface composition
 	rw := NewStringReadWriter("Hello")
@@ -172,24 +193,29 @@ func main() {
 	}
 
 	// Example 8: Interface composition with embedding
-	type LogWriter interface {
-		io.Writer
-		Log(message string)
-	}
-
-	type ConsoleLogger struct {
-		prefix string
-	}
+	var logger LogWriter = ConsoleLogger{prefix: "DEBUG"}
+	logger.Log("This is a debug message")
 
-	func (c ConsoleLogger) Write(p []byte) (n int, err error) {
-		fmt.Printf("%s: %s", c.prefix, string(p))
-		return len(p), nil
+	// Example 9: Mapping errors to HTTP problem responses
+	mapper := NewErrorMapper()
+	RegisterError(mapper, func(e NetworkError) Problem {
+		return Problem{Status: e.Code, Detail: e.Message}
+	})
+
+	failures := []error{
+		NetworkError{404, "Page not found"},
+		fmt.Errorf("loading profile: %w", NetworkError{503, "Upstream unavailable"}),
+		errors.Join(
+			FieldViolation{Field: "name", Message: "cannot be empty"},
+			FieldViolation{Field: "age", Message: "must be 18 or older"},
+		),
+		errors.New("database connection reset"),
 	}
 
-	func (c ConsoleLogger) Log(message string) {
-		c.Write([]byte(message + "\n"))
+	fmt.Println("\nProblem responses:")
+	for _, failure := range failures {
+		rec := httptest.NewRecorder()
+		mapper.WriteError(rec, httptest.NewRequest(http.MethodGet, "/users/42", nil), failure)
+		fmt.Printf("%d %s", rec.Code, rec.Body)
 	}
-
-	logger := ConsoleLogger{prefix: "DEBUG"}
-	logger.Log("This is a debug message")
 }
\ No newline at end of file
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Problem is an RFC 7807 problem details body
+type Problem struct {
+	Type     string           `json:"type"`
+	Title    string           `json:"title"`
+	Status   int              `json:"status"`
+	Detail   string           `json:"detail,omitempty"`
+	Instance string           `json:"instance,omitempty"`
+	Errors   []FieldViolation `json:"errors,omitempty"` // Extension member for validation failures
+}
+
+// FieldViolation describes one invalid input field
+type FieldViolation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// FieldViolation is itself an error, so validators can return it directly
+func (v FieldViolation) Error() string {
+	return fmt.Sprintf("validation failed for %s: %s", v.Field, v.Message)
+}
+
+func (v FieldViolation) FieldViolation() FieldViolation {
+	return v
+}
+
+// HTTPStatuser is implemented by errors that know their status code, so
+// they need no registered rule
+type HTTPStatuser interface {
+	HTTPStatus() int
+}
+
+// FieldViolator is implemented by validation errors tied to one field
+type FieldViolator interface {
+	FieldViolation() FieldViolation
+}
+
+// ErrorMapper turns errors into problem details.
+// Registered rules are tried newest first, then the built-in defaults.
+type ErrorMapper struct {
+	mu       sync.RWMutex
+	rules    []func(error) (Problem, bool)
+	defaults []func(error) (Problem, bool)
+}
+
+func NewErrorMapper() *ErrorMapper {
+	m := &ErrorMapper{}
+	m.defaults = []func(error) (Problem, bool){
+		func(err error) (Problem, bool) {
+			if len(fieldViolations(err)) == 0 {
+				return Problem{}, false
+			}
+			return Problem{Status: http.StatusUnprocessableEntity, Title: "Validation failed"}, true
+		},
+		func(err error) (Problem, bool) {
+			var s HTTPStatuser
+			if !errors.As(err, &s) {
+				return Problem{}, false
+			}
+			return Problem{Status: s.HTTPStatus(), Detail: err.Error()}, true
+		},
+		sentinelRule(context.DeadlineExceeded, http.StatusGatewayTimeout, ""),
+		sentinelRule(context.Canceled, 499, "Client Closed Request"),
+	}
+	return m
+}
+
+// RegisterError maps every error in the chain that is an E
+func RegisterError[E error](m *ErrorMapper, fn func(E) Problem) {
+	m.add(func(err error) (Problem, bool) {
+		var target E
+		if !errors.As(err, &target) {
+			return Problem{}, false
+		}
+		return fn(target), true
+	})
+}
+
+// RegisterSentinel maps errors matching target with errors.Is
+func (m *ErrorMapper) RegisterSentinel(target error, status int, title string) {
+	m.add(sentinelRule(target, status, title))
+}
+
+func (m *ErrorMapper) add(rule func(error) (Problem, bool)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rules = append(m.rules, rule)
+}
+
+func sentinelRule(target error, status int, title string) func(error) (Problem, bool) {
+	return func(err error) (Problem, bool) {
+		if !errors.Is(err, target) {
+			return Problem{}, false
+		}
+		return Problem{Status: status, Title: title, Detail: err.Error()}, true
+	}
+}
+
+// Map converts err into a problem. Unknown errors become a 500 whose
+// detail does not leak the internal error message.
+func (m *ErrorMapper) Map(err error) Problem {
+	m.mu.RLock()
+	rules := make([]func(error) (Problem, bool), 0, len(m.rules)+len(m.defaults))
+	for i := len(m.rules) - 1; i >= 0; i-- {
+		rules = append(rules, m.rules[i])
+	}
+	rules = append(rules, m.defaults...)
+	m.mu.RUnlock()
+
+	problem := Problem{Status: http.StatusInternalServerError}
+	for _, rule := range rules {
+		if p, ok := rule(err); ok {
+			problem = p
+			break
+		}
+	}
+
+	if problem.Status == 0 {
+		problem.Status = http.StatusInternalServerError
+	}
+	if problem.Type == "" {
+		problem.Type = "about:blank"
+	}
+	if problem.Title == "" {
+		problem.Title = http.StatusText(problem.Status)
+	}
+	if problem.Errors == nil && problem.Status < 500 {
+		problem.Errors = fieldViolations(err)
+	}
+	return problem
+}
+
+// WriteError writes err as an application/problem+json response
+func (m *ErrorMapper) WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	problem := m.Map(err)
+	if problem.Instance == "" && r != nil {
+		problem.Instance = r.URL.Path
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// HandlerFunc is an http handler that can fail
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// Handler adapts fn so that returned errors are written as problems
+func (m *ErrorMapper) Handler(fn HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := fn(w, r); err != nil {
+			m.WriteError(w, r, err)
+		}
+	})
+}
+
+// fieldViolations collects violations from the whole error tree,
+// including errors joined with errors.Join or Unwrap() []error
+func fieldViolations(err error) []FieldViolation {
+	var result []FieldViolation
+	var walk func(error)
+	walk = func(err error) {
+		if err == nil {
+			return
+		}
+		if v, ok := err.(FieldViolator); ok {
+			result = append(result, v.FieldViolation())
+			return
+		}
+		switch e := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, child := range e.Unwrap() {
+				walk(child)
+			}
+		case interface{ Unwrap() error }:
+			walk(e.Unwrap())
+		}
+	}
+	walk(err)
+	return result
+}
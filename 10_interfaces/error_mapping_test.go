@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRegisterErrorMatchesWrappedErrors(t *testing.T) {
+	m := NewErrorMapper()
+	RegisterError(m, func(e NetworkError) Problem {
+		return Problem{Status: e.Code, Detail: e.Message}
+	})
+
+	err := fmt.Errorf("loading profile: %w", fmt.Errorf("fetch: %w", NetworkError{503, "Upstream unavailable"}))
+	got := m.Map(err)
+	want := Problem{Type: "about:blank", Title: "Service Unavailable", Status: 503, Detail: "Upstream unavailable"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Map(wrapped NetworkError) = %+v, want %+v", got, want)
+	}
+
+	if got := m.Map(errors.New("database connection reset")); got.Status != http.StatusInternalServerError || got.Detail != "" {
+		t.Errorf("unknown error mapped to %+v, want a bare 500", got)
+	}
+}
+
+func TestWriteErrorFieldViolations(t *testing.T) {
+	m := NewErrorMapper()
+	err := fmt.Errorf("create user: %w", errors.Join(
+		FieldViolation{Field: "name", Message: "cannot be empty"},
+		FieldViolation{Field: "age", Message: "must be 18 or older"},
+	))
+
+	rec := httptest.NewRecorder()
+	m.WriteError(rec, httptest.NewRequest(http.MethodPost, "/users", nil), err)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type = %q, want application/problem+json", ct)
+	}
+	var got Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode body %q: %v", rec.Body, err)
+	}
+	want := Problem{
+		Type:     "about:blank",
+		Title:    "Validation failed",
+		Status:   http.StatusUnprocessableEntity,
+		Instance: "/users",
+		Errors: []FieldViolation{
+			{Field: "name", Message: "cannot be empty"},
+			{Field: "age", Message: "must be 18 or older"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("body = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite testdata/*.golden")
+
+// goldenCases are generated from the real lesson files
+var goldenCases = []struct {
+	golden string
+	cfg    config
+}{
+	{"computer_builder.golden", config{"Computer", "builder", "../../09_structs/advanced_structs.go"}},
+	{"server_options.golden", config{"Server", "options", "../../08_functions/advanced_functions.go"}},
+}
+
+func TestGoldens(t *testing.T) {
+	for _, c := range goldenCases {
+		t.Run(c.golden, func(t *testing.T) {
+			got, err := generate(c.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", c.golden)
+			if *updateGolden {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("generated output differs from %s; run go test -update to accept it", path)
+			}
+		})
+	}
+}